@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// logFormat is how requests are written to accessLog, "text" or "json", set by -logformat
+var logFormat = "text"
+
+// statusWriter records the status and size of a response as it is written
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader records the status before sending it
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes of the body, which are sent with status 200 if no other was set
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += n
+	return n, err
+}
+
+// requestEntry is a request as written to accessLog in JSON
+type requestEntry struct {
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	Size       int     `json:"size"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// logRequests writes a line to accessLog for every request handled by h, giving its
+// method, path, response status and size, and how long it took
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.status == 0 { // Nothing was written at all
+			sw.status = http.StatusOK
+		}
+
+		entry := requestEntry{
+			Time:       start.Format(time.RFC3339),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     sw.status,
+			Size:       sw.size,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if logFormat == "json" {
+			line, _ := json.Marshal(entry)
+			accessLog.Println(string(line))
+			return
+		}
+		accessLog.Printf("%s %s %q %d %d %.1fms", entry.Time, entry.Method, entry.Path,
+			entry.Status, entry.Size, entry.DurationMS)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// textEntry matches a request written to accessLog as text
+var textEntry = regexp.MustCompile(`^(\S+) (\S+) "([^"]*)" (\d+) (\d+) ([\d.]+)ms\n$`)
+
+// loggedRequest sends a request through logRequests in the given format, returning what
+// was written to accessLog
+func loggedRequest(t *testing.T, format string, h http.HandlerFunc, method, target string) string {
+	t.Helper()
+	defer func(f string) { logFormat = f; accessLog.SetOutput(io.Discard) }(logFormat)
+	logFormat = format
+	var buf bytes.Buffer
+	accessLog.SetOutput(&buf)
+	logRequests(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	return buf.String()
+}
+
+func TestLogRequests(t *testing.T) {
+	const body = "short and stout"
+	teapot := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, body)
+	}
+	silent := func(w http.ResponseWriter, r *http.Request) {} // Writes nothing, which is sent as 200
+	tests := []struct {
+		name           string
+		h              http.HandlerFunc
+		method, target string
+		path           string
+		status, size   int
+		minMS          float64
+	}{
+		{"teapot", teapot, "POST", "/map?id=1", "/map", http.StatusTeapot, len(body), 5},
+		{"nothing written", silent, "GET", "/health", "/health", http.StatusOK, 0, 0},
+	}
+	for _, tt := range tests {
+		line := loggedRequest(t, "text", tt.h, tt.method, tt.target)
+		m := textEntry.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("%s: text entry %q not in the expected form", tt.name, line)
+		} else {
+			ms, _ := strconv.ParseFloat(m[6], 64)
+			if _, err := time.Parse(time.RFC3339, m[1]); err != nil || m[2] != tt.method || m[3] != tt.path ||
+				m[4] != strconv.Itoa(tt.status) || m[5] != strconv.Itoa(tt.size) || ms < tt.minMS {
+				t.Errorf("%s: got text entry %q", tt.name, line)
+			}
+		}
+
+		var entry requestEntry
+		line = loggedRequest(t, "json", tt.h, tt.method, tt.target)
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("%s: JSON entry %q can't be read: %v", tt.name, line, err)
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, entry.Time); err != nil || entry.Method != tt.method || entry.Path != tt.path ||
+			entry.Status != tt.status || entry.Size != tt.size || entry.DurationMS < tt.minMS {
+			t.Errorf("%s: got JSON entry %+v", tt.name, entry)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// apiRequest is the JSON body accepted by "/api/map"
+type apiRequest struct {
+	Taxon        string  `json:"taxon"`
+	MapType      string  `json:"maptype"`
+	Coordinates  string  `json:"coordinates"`
+	ScaleBar     bool    `json:"scalebar"`
+	NorthArrow   bool    `json:"northarrow"`
+	Legend       bool    `json:"legend"`
+	FitToData    bool    `json:"fit"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	KeepOrder    bool    `json:"keeporder"`
+	PlotSea      bool    `json:"plotsea"`   // Whether records that fall in the sea are plotted anyway
+	CellSize     float64 `json:"cellsize"`  // Side of grid map cells in km, 10 if left out
+	Precision    int     `json:"precision"` // Decimal places coordinates are rounded to, the server's default if left out
+	Zone         int     `json:"zone"`      // UTM zone of any eastings and northings, 55 if left out
+	From         int     `json:"from"`      // First year of the records mapped, if limited
+	To           int     `json:"to"`        // Last year of the records mapped, if limited
+	Undated      bool    `json:"undated"`   // Whether records without a date are mapped when the years are limited
+	MinLat       float64 `json:"minlat"`    // Edges of a box the records mapped are limited to, all four needed
+	MinLon       float64 `json:"minlon"`
+	MaxLat       float64 `json:"maxlat"`
+	MaxLon       float64 `json:"maxlon"`
+	Clip         bool    `json:"clip"`         // Whether the map is cropped to the box
+	MarkerColour string  `json:"markercolour"` // Hex colour of the markers, black if left out
+	ObsColour    string  `json:"obscolour"`    // Hex colour of observations on voucher maps
+	MarkerRadius int     `json:"markerradius"` // Radius in pixels of the markers, 9 if left out
+	Title        bool    `json:"title"`        // Whether the taxon name is written above the map
+	Attribution  string  `json:"attribution"`  // Data source credited below the map, the server's default if left out
+	Thin         bool    `json:"thin"`         // Whether the points of plain maps of many records are thinned
+	Graticule    float64 `json:"graticule"`    // Degrees between lines of latitude and longitude drawn on the map, if any
+	Locator      bool    `json:"locator"`      // Whether zoomed-in maps show where they are on a small map of the region
+	LocatorSize  int     `json:"locatorsize"`  // Width of the locator map as a percentage of the map's width
+	Corner       string  `json:"corner"`       // Corner the locator map is drawn in
+	ClusterKm    float64 `json:"clusterkm"`    // Distance in km within which records are merged into one point, if any
+	FullDetail   bool    `json:"fulldetail"`   // Whether the coastline is kept in full rather than simplified
+	Theme        string  `json:"theme"`        // Colour theme the map is drawn in, the default if left out
+	Categories   string  `json:"categories"`   // Legend definition for category maps, a category and optional =colour per line
+	Format       string  `json:"format"`       // "ascii" for a text map instead of the SVG, "svg" if left out
+	Cols         int     `json:"cols"`         // Width in characters of a text map
+	Rows         int     `json:"rows"`         // Height in characters of a text map, worked out from the width if left out
+	Decimals     int     `json:"decimals"`     // Decimal places of exported coordinates, as mapped if left out
+	Reference    string  `json:"reference"`    // Coordinate that distances are measured from on distance maps
+	ShowRef      bool    `json:"showref"`      // Whether the reference coordinate is drawn on distance maps
+	Dedupe       bool    `json:"dedupe"`       // Whether records at the same locality are merged
+	DedupePlaces int     `json:"dedupeplaces"` // Decimal places localities are told apart to, 3 if left out
+	ScaleCount   bool    `json:"scalecount"`   // Whether points are sized by the number of records merged into them
+	Margin       float64 `json:"margin"`       // Empty border in pixels added around the map
+	Layers       bool    `json:"layers"`       // Whether the map is split into named layers for editing
+	Snap         bool    `json:"snap"`         // Whether points just offshore are moved onto land
+	SnapKm       float64 `json:"snapkm"`       // Distance in km from the coast within which points are snapped, 2 if left out
+	PlotOutside  bool    `json:"plotoutside"`  // Whether records outside the area covered by the map are plotted anyway
+}
+
+// apiResponse is the JSON body returned by "/api/map", holding either the map or an error
+type apiResponse struct {
+	SVG      string   `json:"svg,omitempty"`
+	ASCII    string   `json:"ascii,omitempty"` // Text map, for requests with format "ascii"
+	Filename string   `json:"filename,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"` // Notes about lines left off the map
+}
+
+// apiMap handles "/api/map", which draws a map from a JSON request for use by scripts and
+// data pipelines, responding with the SVG map and its file name, or with a text map for
+// requests with format "ascii"
+func apiMap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "maps must be requested with POST")
+		return
+	}
+
+	var req apiRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPI(w, http.StatusBadRequest, apiResponse{Error: "the request body is not valid JSON: " + err.Error()})
+		return
+	}
+	if req.MapType == "" {
+		req.MapType = "plain"
+	}
+	if !knownMapTypes[req.MapType] {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown map type %q", req.MapType))
+		return
+	}
+
+	data := req.mapData()
+	switch req.Format {
+	case "", "svg":
+	case "ascii": // A text map for terminals, drawn from the records alone
+		text, err := asciiText(data, req.Cols, req.Rows)
+		if err != nil {
+			writeAPI(w, http.StatusBadRequest, apiResponse{Error: err.Error()})
+			return
+		}
+		writeAPI(w, http.StatusOK, apiResponse{ASCII: text, Warnings: unescapeAll(data.Warnings)})
+		return
+	default:
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown format %q, use svg or ascii", req.Format))
+		return
+	}
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	svgMap, _, err := mapSVG(ctx, data)
+	warnings := unescapeAll(data.Warnings)
+	if err != nil {
+		writeAPI(w, renderStatus(err), apiResponse{Error: err.Error(), Warnings: warnings})
+		return
+	}
+	writeAPI(w, http.StatusOK, apiResponse{SVG: svgMap, Filename: mapFileName(data.TaxonName, data.MapType), Warnings: warnings})
+}
+
+// mapData returns the data for the map an API request asks for
+func (req apiRequest) mapData() *mapData {
+	data := baseMapData(req.Taxon, req.MapType, req.Coordinates, parseZone(strconv.Itoa(req.Zone)))
+	data.ScaleBar, data.NorthArrow, data.Legend = req.ScaleBar, req.NorthArrow, req.Legend
+	data.FitToData, data.KeepOrder, data.PlotSea = req.FitToData, req.KeepOrder, req.PlotSea
+	data.Width, data.Height = clampSize(req.Width), clampSize(req.Height)
+	data.CellKm = parseCellSize(fmt.Sprint(req.CellSize))
+	data.Precision = parsePrecision(strconv.Itoa(req.Precision))
+	data.YearFrom, data.YearTo = parseYear(strconv.Itoa(req.From)), parseYear(strconv.Itoa(req.To))
+	data.Undated = req.Undated
+	data.Bounds = parseBounds(edge(req.MinLat), edge(req.MinLon), edge(req.MaxLat), edge(req.MaxLon))
+	data.ClipToBounds = req.Clip
+	data.MarkerColour, data.ObsColour = req.MarkerColour, req.ObsColour
+	data.MarkerRadius = parseRadius(strconv.Itoa(req.MarkerRadius))
+	data.Title, data.Attribution, data.Thin = req.Title, req.Attribution, req.Thin
+	data.Graticule, data.GraticuleStep = req.Graticule > 0, parseGraticuleStep(fmt.Sprint(req.Graticule))
+	data.Locator, data.LocatorSize = req.Locator, parseLocatorSize(strconv.Itoa(req.LocatorSize))
+	data.LocatorCorner = parseLocatorCorner(req.Corner)
+	data.ClusterKm = parseClusterKm(fmt.Sprint(req.ClusterKm))
+	data.FullDetail, data.Theme = req.FullDetail, parseTheme(req.Theme)
+	data.CategoryKey = req.Categories
+	data.Reference, data.ShowReference = cleanCoords(req.Reference), req.ShowRef
+	data.Dedupe, data.ScaleByCount = req.Dedupe, req.ScaleCount
+	if req.DedupePlaces > 0 {
+		data.DedupePlaces = int(math.Min(float64(req.DedupePlaces), maxDedupePlaces))
+	}
+	data.Margin = parseMargin(fmt.Sprint(req.Margin))
+	data.Layers, data.SnapToLand, data.PlotOutside = req.Layers, req.Snap, req.PlotOutside
+	if req.SnapKm > 0 {
+		data.SnapTolerance = math.Min(req.SnapKm, maxSnapTolerance)
+	}
+	if data.Attribution == "" {
+		data.Attribution = defaultAttribution
+	}
+	return data
+}
+
+// edge formats an edge of the box asked for in an API request, or gives "" if it was left
+// out, which no edge of a box around Tasmania can be mistaken for
+func edge(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeAPI writes a JSON response with the given status
+func writeAPI(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		errorLog.Printf("Error writing API response: %s", err)
+	}
+}
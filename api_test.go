@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIMap(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		svg    bool
+	}{
+		{"valid", `{"taxon": "Aus bus", "maptype": "grid", "coordinates": "-42.1,147.2\n-41.5,146.5"}`, http.StatusOK, true},
+		{"type left out", `{"coordinates": "-42.1,147.2"}`, http.StatusOK, true},
+		{"not JSON", `{"taxon": "Aus bus",`, http.StatusBadRequest, false},
+		{"unknown type", `{"maptype": "globe", "coordinates": "-42.1,147.2"}`, http.StatusBadRequest, false},
+		{"no coordinates", `{"taxon": "Aus bus", "coordinates": "garbage"}`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		rec := postJSON(apiMap, "/api/map", tt.body)
+		var resp apiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: response is not JSON: %v", tt.name, err)
+			continue
+		}
+		if rec.Code != tt.status || (resp.SVG != "") != tt.svg || (resp.Error == "") != tt.svg {
+			t.Errorf("%s: got %d with svg %t and error %q", tt.name, rec.Code, resp.SVG != "", resp.Error)
+		}
+		if tt.svg && !strings.HasSuffix(resp.Filename, ".svg") {
+			t.Errorf("%s: file name %q", tt.name, resp.Filename)
+		}
+	}
+}
+
+func TestAPIMapOptions(t *testing.T) {
+	var req apiRequest
+	body := `{"reference": "-42.88, 147.32", "showref": true, "dedupe": true, "dedupeplaces": 9, "scalecount": true,
+		"margin": 20, "layers": true, "snap": true, "snapkm": 5, "plotoutside": true}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	data := req.mapData()
+	if data.Reference != "-42.88,147.32" || !data.ShowReference || !data.Dedupe || data.DedupePlaces != maxDedupePlaces ||
+		!data.ScaleByCount || data.Margin != 20 || !data.Layers || !data.SnapToLand || data.SnapTolerance != 5 || !data.PlotOutside {
+		t.Errorf("options not carried over: %+v", data)
+	}
+
+	data = apiRequest{}.mapData()
+	if data.DedupePlaces != defaultDedupePlaces || data.SnapTolerance != defaultSnapTolerance || data.Margin != 0 {
+		t.Errorf("defaults not kept: places %d, tolerance %g, margin %g", data.DedupePlaces, data.SnapTolerance, data.Margin)
+	}
+
+	rec := postJSON(apiMap, "/api/map", `{"coordinates": "-42.1,147.2", "layers": true}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "inkscape:groupmode") {
+		t.Errorf("layered map not drawn, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// arrowShape is an arrow pointing north centred on the origin, rotated into place for
+// each record
+const arrowShape = "M0 -16L8 10L0 4L-8 10Z"
+
+// positionsOnly returns a copy of the records with everything but their positions
+// removed, for handing to the mapper, which doesn't understand bearings
+func positionsOnly(records []record) []record {
+	plain := make([]record, len(records))
+	for i, rec := range records {
+		plain[i] = record{lat: rec.lat, lon: rec.lon}
+	}
+	return plain
+}
+
+// arrowMap draws the Tasmania outline with an arrow for each record pointing in the
+// direction of its bearing. Records without a bearing are drawn as plain dots.
+func arrowMap(reg *baseRegion, rl *mapper.RecordList, records []record, w io.Writer) {
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid("arrows")
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		if rec.hasBearing {
+			transform := fmt.Sprintf(`transform="translate(%d %d) rotate(%g)"`, x, y, rec.bearing)
+			canvas.Path(arrowShape, transform, "fill:black")
+		} else {
+			canvas.Circle(x, y, 9, "fill:black")
+		}
+	}
+	canvas.Gend()
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
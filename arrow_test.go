@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestArrowRotatedToBearing(t *testing.T) {
+	doc, err := renderMap("Aus bus", "arrow", "-42.0,146.5,90\n-41.5,147.0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := tasmania.project(-42.0, 146.5)
+	want := fmt.Sprintf(`transform="translate(%d %d) rotate(90)"`, x, y)
+	if !strings.Contains(doc, want) {
+		t.Errorf("no arrow with %s", want)
+	}
+	if n := strings.Count(doc, `d="`+arrowShape+`"`); n != 1 {
+		t.Errorf("%d arrows drawn, want 1 for the record with a bearing", n)
+	}
+	x, y = tasmania.project(-41.5, 147.0)
+	if dot := fmt.Sprintf(`<circle cx="%d" cy="%d"`, x, y); !strings.Contains(doc, dot) {
+		t.Error("record without a bearing not drawn as a dot")
+	}
+}
+
+func TestParseLineBearing(t *testing.T) {
+	tests := []struct {
+		line       string
+		bearing    float64
+		hasBearing bool
+		ok         bool
+	}{
+		{"-42.0,146.5,270", 270, true, true},
+		{"-42.0,146.5,12.5", 12.5, true, true},
+		{"-42.0,146.5", 0, false, true},
+		{"-42.0,146.5,v", 0, false, true},
+		{"-42.0,146.5,400", 0, false, false},
+	}
+	for _, tt := range tests {
+		rec, ok := parseLine(tt.line)
+		if ok != tt.ok || (ok && (rec.bearing != tt.bearing || rec.hasBearing != tt.hasBearing)) {
+			t.Errorf("parseLine(%q) = bearing %g %v, ok %v", tt.line, rec.bearing, rec.hasBearing, ok)
+		}
+	}
+}
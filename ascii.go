@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	asciiDefaultCols = 60  // Default width of an ASCII map in characters
+	asciiMinCols     = 10  // Narrowest ASCII map that still shows the outline
+	asciiMaxCols     = 300 // Widest ASCII map that will be drawn
+)
+
+// asciiMap draws the records on a character grid of cols by rows covering the map canvas.
+// Land is drawn as '.', cells containing at least one record as '#' and the sea is left
+// blank. If rows is 0 it is derived from cols, allowing for characters being about twice
+// as tall as they are wide.
+func asciiMap(reg *baseRegion, records []record, cols, rows int) string {
+	if rows <= 0 {
+		rows = cols * canvasHeight / canvasWidth / 2
+	}
+	cellW := float64(canvasWidth) / float64(cols)
+	cellH := float64(canvasHeight) / float64(rows)
+
+	grid := make([][]byte, rows)
+	for r := range grid {
+		grid[r] = make([]byte, cols)
+		for c := range grid[r] {
+			grid[r][c] = ' '
+			if onLand(reg, pixel{(float64(c) + 0.5) * cellW, (float64(r) + 0.5) * cellH}) {
+				grid[r][c] = '.'
+			}
+		}
+	}
+
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		c, r := int(float64(x)/cellW), int(float64(y)/cellH)
+		if c >= 0 && c < cols && r >= 0 && r < rows {
+			grid[r][c] = '#'
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range grid {
+		sb.WriteString(strings.TrimRight(string(line), " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// asciiSize keeps a requested grid size within sensible limits, using the default width
+// when none is given and deriving the height from the width when it is missing
+func asciiSize(cols, rows int) (int, int) {
+	switch {
+	case cols == 0:
+		cols = asciiDefaultCols
+	case cols < asciiMinCols:
+		cols = asciiMinCols
+	case cols > asciiMaxCols:
+		cols = asciiMaxCols
+	}
+	if rows < 0 || rows > 2*asciiMaxCols {
+		rows = 0
+	}
+	return cols, rows
+}
+
+// errNoASCIIRecords is given for a text map of data without a single record in it
+var errNoASCIIRecords = errors.New("None of the data can be mapped")
+
+// asciiText draws a text map of the records in data, cols by rows characters as limited
+// by asciiSize
+func asciiText(data *mapData, cols, rows int) (string, error) {
+	records := parseRecords(data.RawCoords)
+	if len(records) == 0 {
+		debugParseFailure(data, "ascii")
+		return "", errNoASCIIRecords
+	}
+	cols, rows = asciiSize(cols, rows)
+	return asciiMap(data.region(), records, cols, rows), nil
+}
+
+// serveASCII responds to a map request made with format=ascii with a plain text map
+func serveASCII(w http.ResponseWriter, r *http.Request, data *mapData) {
+	cols, _ := strconv.Atoi(r.FormValue("cols"))
+	rows, _ := strconv.Atoi(r.FormValue("rows"))
+	text, err := asciiText(data, cols, rows)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, text)
+}
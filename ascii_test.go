@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestASCIIMapMarksRecordCells(t *testing.T) {
+	const cols, rows = 91, 126 // Cells of 10 by 10 canvas pixels
+	records := parseRecords("-42.0,146.5\n-41.1,148.2\n")
+	lines := strings.Split(asciiMap(tasmania, records, cols, rows), "\n")
+	if len(lines) != rows+1 { // Ending with a newline
+		t.Fatalf("got %d lines, want %d", len(lines)-1, rows)
+	}
+	for _, rec := range records {
+		x, y := tasmania.project(rec.lat, rec.lon)
+		line := lines[y/10]
+		if c := x / 10; c >= len(line) || line[c] != '#' {
+			t.Errorf("record at %g,%g doesn't mark cell %d,%d", rec.lat, rec.lon, x/10, y/10)
+		}
+	}
+	if marked := strings.Count(strings.Join(lines, ""), "#"); marked != len(records) {
+		t.Errorf("%d cells marked, want %d", marked, len(records))
+	}
+	if _, y := tasmania.project(records[0].lat, records[0].lon); !strings.Contains(lines[y/10], ".") {
+		t.Error("no land drawn around the inland record")
+	}
+}
+
+func TestASCIISize(t *testing.T) {
+	tests := []struct{ cols, rows, wantCols, wantRows int }{
+		{0, 0, asciiDefaultCols, 0},
+		{3, 0, asciiMinCols, 0},
+		{1000, 10, asciiMaxCols, 10},
+		{80, -4, 80, 0},
+	}
+	for _, tt := range tests {
+		c, r := asciiSize(tt.cols, tt.rows)
+		if c != tt.wantCols || r != tt.wantRows {
+			t.Errorf("asciiSize(%d, %d) = %d, %d, want %d, %d", tt.cols, tt.rows, c, r, tt.wantCols, tt.wantRows)
+		}
+	}
+}
+
+func TestASCIIFromFormAndAPI(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"-42.0,146.5"}, "format": {"ascii"}, "cols": {"40"},
+	})
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") || strings.Count(rec.Body.String(), "#") != 1 {
+		t.Errorf("form gave %q:\n%s", rec.Header().Get("Content-Type"), rec.Body)
+	}
+	form := rec.Body.String()
+
+	rec = postJSON(apiMap, "/api/map", `{"coordinates":"-42.0,146.5","format":"ascii","cols":40}`)
+	var resp apiResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != 200 {
+		t.Fatalf("API gave %d: %v", rec.Code, err)
+	}
+	if resp.ASCII != form || resp.SVG != "" {
+		t.Errorf("API text map differs from the form's:\n%s", resp.ASCII)
+	}
+
+	if rec = postJSON(apiMap, "/api/map", `{"coordinates":"nonsense","format":"ascii"}`); rec.Code != 400 {
+		t.Errorf("API text map of nothing gave %d, want 400", rec.Code)
+	}
+	if rec = postJSON(apiMap, "/api/map", `{"coordinates":"-42.0,146.5","format":"gif"}`); rec.Code != 400 {
+		t.Errorf("unknown format gave %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmt "html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// embeddedAssets holds the page templates, stylesheet and icon built into the binary, so
+// that the server runs without an assets directory alongside it
+//
+//go:embed assets
+var embeddedAssets embed.FS
+
+var (
+	embeddedOnce  sync.Once
+	embeddedPages *pageTemplates
+	embeddedErr   error
+)
+
+// pageTemplates are the parsed templates used to build every page, one for each body
+// that can be set inside the page layout
+type pageTemplates struct {
+	pages map[string]*htmt.Template
+}
+
+// bodyTemplates are the templates that can make up the body of a page
+var bodyTemplates = []string{"dataEntry.html", "error.html", "svg.html"}
+
+// templateFuncs are the functions the page templates can call
+var templateFuncs = htmt.FuncMap{
+	// escaped marks text that was escaped when the map was drawn, such as the taxon name, the
+	// warnings and the SVG map itself, so that it is written as it stands
+	"escaped": func(s string) htmt.HTML { return htmt.HTML(s) },
+}
+
+// loadTemplates returns the page templates. The embedded templates are parsed once and
+// reused, while templates in a directory given with -assets are read again for every page
+// so that changes show up straight away while working on a theme.
+func loadTemplates() (*pageTemplates, error) {
+	if assetsDir != "" {
+		return parseTemplates(os.DirFS(assetsDir))
+	}
+
+	embeddedOnce.Do(func() {
+		assets, err := fs.Sub(embeddedAssets, "assets")
+		if err != nil {
+			embeddedErr = err
+			return
+		}
+		embeddedPages, embeddedErr = parseTemplates(assets)
+	})
+	return embeddedPages, embeddedErr
+}
+
+// assetFiles returns the assets directory given with -assets, or the embedded assets
+func assetFiles() fs.FS {
+	if assetsDir != "" {
+		return os.DirFS(assetsDir)
+	}
+	assets, _ := fs.Sub(embeddedAssets, "assets") // The directory is always embedded
+	return assets
+}
+
+// pageLayout is the data a page is built from: the title for its head, and the data its body
+// template is executed with
+type pageLayout struct {
+	Title string
+	Body  interface{}
+}
+
+// render builds a page by executing the layout with the given body template, and sends it
+// with the given status. The page is built in full before any of it is written, so a template
+// that fails to execute sends nothing, leaving the caller to send an error page in its place.
+func (pt *pageTemplates) render(w http.ResponseWriter, status int, body string, page pageLayout) error {
+	tmpl, ok := pt.pages[body]
+	if !ok {
+		err := fmt.Errorf("no page template for %s", body)
+		errorLog.Printf("Error executing template: %s", err)
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(buf, "layout.html", page); err != nil {
+		errorLog.Printf("Error executing template %s: %s", body, err)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		errorLog.Printf("Error sending page: %s", err)
+	}
+	return nil
+}
+
+// readAsset returns the contents of a file from the assets
+func readAsset(name string) ([]byte, error) {
+	return fs.ReadFile(assetFiles(), name)
+}
+
+// parseTemplates parses the page templates found in assets. The layout, head, header and
+// footer are shared, and each body template is parsed into its own copy of them as "body".
+func parseTemplates(assets fs.FS) (*pageTemplates, error) {
+	layout, err := htmt.New("layout.html").Funcs(templateFuncs).ParseFS(assets, "layout.html", "head.html", "header.html", "footer.html")
+	if err != nil {
+		return nil, err
+	}
+	pt := &pageTemplates{pages: make(map[string]*htmt.Template, len(bodyTemplates))}
+	for _, name := range bodyTemplates {
+		src, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return nil, err
+		}
+		page, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := page.New("body").Parse(string(src)); err != nil {
+			return nil, fmt.Errorf("template: %s: %w", name, err)
+		}
+		pt.pages[name] = page
+	}
+	return pt, nil
+}
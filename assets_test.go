@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyAssets writes the embedded assets to a temporary directory, returning its path
+func copyAssets(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	assets, _ := fs.Sub(embeddedAssets, "assets")
+	err := fs.WalkDir(assets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, name), b, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestServeFromAssetsDir(t *testing.T) {
+	dir := copyAssets(t)
+	header := filepath.Join(dir, "header.html")
+	b, _ := os.ReadFile(header)
+	os.WriteFile(header, []byte(strings.Replace(string(b), "Tasmanian Herbarium (HO)", "Test Herbarium", 1)), 0o644)
+
+	assetsDir = dir
+	defer func() { assetsDir = "" }()
+	if err := checkAssetsDir(assetsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(newMapStore().dataEntry)) // Listens on an ephemeral port
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Test Herbarium") || !strings.Contains(string(page), "<form") {
+		t.Errorf("got %d without the form from the assets directory", resp.StatusCode)
+	}
+}
+
+func TestAssetsDirReloaded(t *testing.T) {
+	dir := copyAssets(t)
+	assetsDir = dir
+	defer func() { assetsDir = "" }()
+	form := func() string {
+		rec := httptest.NewRecorder()
+		newMapStore().dataEntry(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Body.String()
+	}
+	if page := form(); !strings.Contains(page, "Tasmanian Herbarium (HO)") {
+		t.Fatal("form not served from the assets directory")
+	}
+
+	header := filepath.Join(dir, "header.html")
+	b, _ := os.ReadFile(header)
+	os.WriteFile(header, []byte(strings.Replace(string(b), "Tasmanian Herbarium (HO)", "Edited Herbarium", 1)), 0o644)
+	if page := form(); !strings.Contains(page, "Edited Herbarium") {
+		t.Error("change to a template not picked up")
+	}
+}
+
+func TestRenderLayout(t *testing.T) {
+	pages, err := loadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := pages.render(rec, http.StatusOK, "error.html", pageLayout{Title: "Not Found", Body: errorPage{Status: 404, Title: "Not Found"}}); err != nil {
+		t.Fatal(err)
+	}
+	page := strings.TrimSpace(rec.Body.String())
+	if !strings.HasPrefix(page, "<!DOCTYPE html>") || !strings.HasSuffix(page, "</html>") || strings.Count(page, "<html>") != 1 ||
+		!strings.Contains(page, "<title>Not Found</title>") || !strings.Contains(page, "Tasmanian Herbarium (HO)") {
+		t.Errorf("error page not built from the layout:\n%s", page)
+	}
+
+	for _, body := range []string{"svg.html", "missing.html"} {
+		rec := httptest.NewRecorder()
+		if err := pages.render(rec, http.StatusOK, body, pageLayout{Title: "Broken", Body: pageText{}}); err == nil || rec.Body.Len() != 0 {
+			t.Errorf("%s with the wrong data gave %v and sent %d bytes", body, err, rec.Body.Len())
+		}
+	}
+}
+
+// BenchmarkTemplates compares building the form from the templates parsed once with
+// parsing them again for every page, as is done for an assets directory
+func BenchmarkTemplates(b *testing.B) {
+	assets, _ := fs.Sub(embeddedAssets, "assets")
+	for _, bm := range []struct {
+		name string
+		load func() (*pageTemplates, error)
+	}{
+		{"cached", loadTemplates},
+		{"parsed", func() (*pageTemplates, error) { return parseTemplates(assets) }},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pages, err := bm.load()
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = pages.render(httptest.NewRecorder(), http.StatusOK, "dataEntry.html",
+					pageLayout{Title: "Data entry form", Body: pageText{}})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAssetsDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "style.css")
+	os.WriteFile(file, nil, 0o644)
+	for _, missing := range []string{filepath.Join(dir, "missing"), file} {
+		if err := checkAssetsDir(missing); err == nil {
+			t.Errorf("%s accepted as an assets directory", missing)
+		}
+	}
+	if checkAssetsDir("") != nil || checkAssetsDir(dir) != nil {
+		t.Error("embedded assets or an existing directory refused")
+	}
+}
+
+func TestEnvOr(t *testing.T) {
+	os.Unsetenv("MAPSERVER_TEST_ADDR")
+	if got := envOr("MAPSERVER_TEST_ADDR", ":9090"); got != ":9090" {
+		t.Errorf("unset variable gave %q", got)
+	}
+	os.Setenv("MAPSERVER_TEST_ADDR", ":8080")
+	defer os.Unsetenv("MAPSERVER_TEST_ADDR")
+	if got := envOr("MAPSERVER_TEST_ADDR", ":9090"); got != ":8080" {
+		t.Errorf("set variable gave %q", got)
+	}
+}
+
+func TestEmbeddedAssetsWithoutDirectory(t *testing.T) {
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir()) // No assets directory alongside
+	defer os.Chdir(wd)
+
+	first, err := loadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := loadTemplates(); again != first {
+		t.Error("embedded templates parsed again")
+	}
+
+	rec := httptest.NewRecorder()
+	newMapStore().dataEntry(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<form") {
+		t.Errorf("form page gave %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	static(rec, httptest.NewRequest("GET", "/static/style.css", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("stylesheet gave %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	favicon(rec, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" {
+		t.Errorf("icon gave %d", rec.Code)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	rec := httptest.NewRecorder()
+	favicon(rec, httptest.NewRequest("GET", "/favicon.ico", nil))
+	icon, _ := fs.ReadFile(embeddedAssets, "assets/favicon.ico")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" || rec.Body.String() != string(icon) {
+		t.Errorf("icon gave %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(rec.Body.String(), "<html") || !strings.Contains(rec.Header().Get("Cache-Control"), "max-age") {
+		t.Error("icon sent as a page, or without caching")
+	}
+
+	dir := copyAssets(t)
+	os.Remove(filepath.Join(dir, "favicon.ico"))
+	assetsDir = dir
+	defer func() { assetsDir = "" }()
+	rec = httptest.NewRecorder()
+	favicon(rec, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("assets without an icon gave %d", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const maxBatchMaps = 100 // Largest number of maps that can be asked for in one batch
+
+// batchWorkers is the number of maps of a batch drawn at once, set with -workers. The
+// mapper draws one map at a time, but reading the data and drawing the server's own
+// overlays are done alongside it.
+var batchWorkers = runtime.GOMAXPROCS(0)
+
+// batchMap is one map of a batch once it has been drawn, or failed to be
+type batchMap struct {
+	svgMap   string
+	err      error
+	warnings []string
+}
+
+// drawBatch draws the maps of a batch on up to batchWorkers goroutines, returning them in
+// the order they were asked for. Each map has its own data, and everything else a map is
+// drawn from is either read only or guarded, as for maps drawn for separate requests.
+func drawBatch(ctx context.Context, reqs []apiRequest) []batchMap {
+	maps := make([]batchMap, len(reqs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < batchWorkers && n < len(reqs); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				data := reqs[i].mapData()
+				svgMap, _, err := mapSVG(ctx, data)
+				maps[i] = batchMap{svgMap: svgMap, err: err, warnings: unescapeAll(data.Warnings)}
+			}
+		}()
+	}
+	for i, req := range reqs {
+		if knownMapTypes[req.MapType] {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return maps
+}
+
+// apiBatch handles "/api/batch", which draws a map for each of a JSON list of map requests,
+// as accepted by "/api/map", and responds with them in a zip archive with a manifest. A map
+// that can't be drawn is described in the manifest instead of failing the whole batch.
+// A batch sent with an Idempotency-Key header is kept in bs, so that sending it again with
+// the same key, such as when retrying after a dropped connection, gets the same archive
+// without the maps being drawn twice.
+func (bs *batchStore) apiBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "maps must be requested with POST")
+		return
+	}
+
+	var reqs []apiRequest
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err == nil {
+		err = json.Unmarshal(body, &reqs)
+	}
+	if err != nil {
+		writeAPI(w, http.StatusBadRequest, apiResponse{Error: "the request body is not a valid JSON list of maps: " + err.Error()})
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchMaps {
+		writeAPI(w, http.StatusBadRequest, apiResponse{Error: fmt.Sprintf("a batch must have from 1 to %d maps", maxBatchMaps)})
+		return
+	}
+	ctx, cancel := renderContext(r) // The whole batch shares one deadline
+	defer cancel()
+
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(key) > maxIdempotencyKey {
+		writeAPI(w, http.StatusBadRequest, apiResponse{Error: fmt.Sprintf("the Idempotency-Key can be at most %d characters", maxIdempotencyKey)})
+		return
+	}
+	if key == "" {
+		writeBatch(w, batchZip(ctx, reqs), false)
+		return
+	}
+	job, created := bs.job(key, body)
+	if job == nil {
+		writeAPI(w, http.StatusUnprocessableEntity, apiResponse{Error: "the Idempotency-Key was already used for a different batch"})
+		return
+	}
+	if created {
+		zip := batchZip(ctx, reqs)
+		if ctx.Err() != nil { // Maps cut short aren't kept, so a retry draws them again
+			bs.finish(key, job, nil)
+		} else {
+			bs.finish(key, job, zip)
+		}
+		writeBatch(w, zip, false)
+		return
+	}
+
+	select { // The batch was sent before, and may still be being drawn
+	case <-job.done:
+		if job.zip != nil {
+			writeBatch(w, job.zip, true)
+			return
+		}
+	case <-ctx.Done():
+	}
+	writeAPI(w, http.StatusServiceUnavailable, apiResponse{Error: "the batch sent earlier with this Idempotency-Key wasn't finished; please send it again"})
+}
+
+// writeBatch sends the archive of a batch, saying if it was drawn for an earlier submission
+func writeBatch(w http.ResponseWriter, zip []byte, replayed bool) {
+	w.Header().Set("Content-Type", "application/zip")
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	setAttachment(w, "maps.zip")
+	if _, err := w.Write(zip); err != nil {
+		errorLog.Printf("Error writing batch of maps: %s", err)
+	}
+}
+
+// batchZip draws the maps of a batch and returns them in a zip archive with a manifest
+func batchZip(ctx context.Context, reqs []apiRequest) []byte {
+	for i := range reqs {
+		if reqs[i].MapType == "" {
+			reqs[i].MapType = "plain"
+		}
+	}
+	maps := drawBatch(ctx, reqs)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	var manifest strings.Builder
+	names := make(map[string]int)
+	for i, req := range reqs {
+		entry := fmt.Sprintf("map %d (%s, %s)", i+1, req.Taxon, req.MapType)
+		if !knownMapTypes[req.MapType] {
+			fmt.Fprintf(&manifest, "%s: error: unknown map type %q\n", entry, req.MapType)
+			continue
+		}
+
+		if svgMap, err := maps[i].svgMap, maps[i].err; err != nil {
+			fmt.Fprintf(&manifest, "%s: error: %s\n", entry, err)
+		} else {
+			name := mapFileName(req.Taxon, req.MapType)
+			if names[name]++; names[name] > 1 { // Maps of the same taxon and type are numbered
+				name = fmt.Sprintf("%s-%d.svg", strings.TrimSuffix(name, ".svg"), names[name])
+			}
+			f, err := zw.Create(name) // Writing to memory can't fail
+			if err == nil {
+				fmt.Fprint(f, svgMap)
+			}
+			fmt.Fprintf(&manifest, "%s: %s\n", entry, name)
+		}
+		for _, warning := range maps[i].warnings {
+			fmt.Fprintf(&manifest, "    %s\n", warning)
+		}
+	}
+
+	if f, err := zw.Create("manifest.txt"); err == nil {
+		fmt.Fprint(f, manifest.String())
+	}
+	zw.Close()
+	return buf.Bytes()
+}
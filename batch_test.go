@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBatchZip(t *testing.T) {
+	body := `[
+		{"taxon": "Aus bus", "maptype": "grid", "coordinates": "-42.1,147.2\n-41.5,146.5"},
+		{"taxon": "Aus bus", "maptype": "grid", "coordinates": "-42.3,147.0"},
+		{"taxon": "Cus dus", "coordinates": "-41.8,145.9"},
+		{"taxon": "Eus fus", "maptype": "plain", "coordinates": "garbage"},
+		{"taxon": "Gus hus", "maptype": "voucher", "coordinates": "-42.1,147.2"}
+	]`
+	rec := postJSON(newBatchStore().apiBatch, "/api/batch", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("batch gave %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+		names = append(names, f.Name)
+	}
+
+	want := []string{"aus-bus.grid.svg", "aus-bus.grid-2.svg", "cus-dus.plain.svg", "manifest.txt"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("zip holds %v, want %v", names, want)
+	}
+	for _, name := range want[:3] {
+		if !strings.Contains(files[name], `id="dots"`) {
+			t.Errorf("%s is not a map", name)
+		}
+	}
+	manifest := files["manifest.txt"]
+	for _, line := range []string{
+		"map 1 (Aus bus, grid): aus-bus.grid.svg",
+		"map 2 (Aus bus, grid): aus-bus.grid-2.svg",
+		"map 3 (Cus dus, plain): cus-dus.plain.svg",
+		"map 4 (Eus fus, plain): error: None of the data can be mapped",
+		`map 5 (Gus hus, voucher): error: unknown map type "voucher"`,
+	} {
+		if !strings.Contains(manifest, line+"\n") {
+			t.Errorf("manifest has no line %q:\n%s", line, manifest)
+		}
+	}
+}
+
+func TestBatchRefused(t *testing.T) {
+	tests := []struct {
+		name, method, body string
+		want               int
+	}{
+		{"GET", "GET", "", http.StatusMethodNotAllowed},
+		{"not JSON", "POST", "taxon=Aus+bus", http.StatusBadRequest},
+		{"not a list", "POST", `{"taxon": "Aus bus"}`, http.StatusBadRequest},
+		{"empty", "POST", "[]", http.StatusBadRequest},
+		{"too many", "POST", "[" + strings.Repeat(`{"coordinates": "-42.1,147.2"},`, maxBatchMaps) + "{}]", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/batch", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		newBatchStore().apiBatch(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+// batchRequests returns n map requests of several types and sizes, as a batch might hold
+func batchRequests(n int) []apiRequest {
+	types := []string{"grid", "plain", "web", "region", "heat", "proportional"}
+	reqs := make([]apiRequest, n)
+	for i := range reqs {
+		reqs[i] = apiRequest{Taxon: fmt.Sprintf("Aus species%d", i), MapType: types[i%len(types)],
+			Coordinates: spreadCoords(20 + 10*i), Legend: i%2 == 0, ScaleBar: true}
+	}
+	reqs[n-1].Coordinates = "garbage" // One map fails, but the rest are still drawn
+	return reqs
+}
+
+func TestBatchWorkersMatchSequential(t *testing.T) {
+	defer func(mc *mapCache, n int) { renderCache, batchWorkers = mc, n }(renderCache, batchWorkers)
+	renderCache = newMapCache(0) // Every map is drawn afresh
+	reqs := batchRequests(12)
+
+	want := make([]batchMap, len(reqs))
+	for i, req := range reqs {
+		data := req.mapData()
+		svgMap, _, err := mapSVG(context.Background(), data)
+		want[i] = batchMap{svgMap: svgMap, err: err, warnings: unescapeAll(data.Warnings)}
+	}
+	for _, workers := range []int{1, 4, len(reqs) + 1} {
+		batchWorkers = workers
+		for i, got := range drawBatch(context.Background(), reqs) {
+			if got.svgMap != want[i].svgMap || fmt.Sprint(got.err) != fmt.Sprint(want[i].err) ||
+				!equalStrings(got.warnings, want[i].warnings) {
+				t.Errorf("%d workers: map %d differs from the one drawn on its own (%v)", workers, i+1, got.err)
+			}
+		}
+	}
+}
+
+func BenchmarkDrawBatch(b *testing.B) {
+	defer func(mc *mapCache, n int) { renderCache, batchWorkers = mc, n }(renderCache, batchWorkers)
+	renderCache = newMapCache(0)
+	reqs := batchRequests(24)
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			batchWorkers = workers
+			for i := 0; i < b.N; i++ {
+				drawBatch(context.Background(), reqs)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// bounds is a box of latitudes and longitudes that the records mapped are limited to
+type bounds struct {
+	set            bool // Whether the records are limited at all
+	minLat, minLon float64
+	maxLat, maxLon float64
+}
+
+// parseBounds reads the corners of a box to limit the records to. All four edges must be
+// numbers for the box to be used, and edges given the wrong way round are swapped.
+func parseBounds(minLat, minLon, maxLat, maxLon string) bounds {
+	var edges [4]float64
+	for i, value := range []string{minLat, minLon, maxLat, maxLon} {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return bounds{}
+		}
+		edges[i] = v
+	}
+	return bounds{
+		set:    true,
+		minLat: math.Min(edges[0], edges[2]), maxLat: math.Max(edges[0], edges[2]),
+		minLon: math.Min(edges[1], edges[3]), maxLon: math.Max(edges[1], edges[3]),
+	}
+}
+
+// contains reports whether a record lies in the box, counting those on its edges as inside
+func (b bounds) contains(rec record) bool {
+	return rec.lat >= b.minLat && rec.lat <= b.maxLat && rec.lon >= b.minLon && rec.lon <= b.maxLon
+}
+
+// String describes the box for messages to the user
+func (b bounds) String() string {
+	return fmt.Sprintf("%g,%g to %g,%g", b.minLat, b.minLon, b.maxLat, b.maxLon)
+}
+
+// filterByBounds keeps the records inside the box, returning a warning about the records
+// left out, if any were
+func filterByBounds(records []record, b bounds) (kept []record, warning string) {
+	if !b.set {
+		return records, ""
+	}
+	outside := 0
+	for _, rec := range records {
+		if b.contains(rec) {
+			kept = append(kept, rec)
+		} else {
+			outside += rec.weight()
+		}
+	}
+	if outside > 0 {
+		warning = fmt.Sprintf("%d record(s) outside %s were left off the map", outside, b)
+	}
+	return kept, warning
+}
+
+// clipToBounds narrows the viewBox of a map to the box, with margin pixels around it. The
+// frame is worked out from where the corners of the box are drawn.
+func clipToBounds(reg *baseRegion, doc string, b bounds, margin float64) string {
+	if !b.set {
+		return doc
+	}
+	debugf("Clipping map to %s", b)
+	left, top := math.Inf(1), math.Inf(1)
+	right, bottom := math.Inf(-1), math.Inf(-1)
+	for _, lat := range []float64{b.minLat, b.maxLat} {
+		for _, lon := range []float64{b.minLon, b.maxLon} {
+			x, y := reg.project(lat, lon)
+			left, right = math.Min(left, float64(x)), math.Max(right, float64(x))
+			top, bottom = math.Min(top, float64(y)), math.Max(bottom, float64(y))
+		}
+	}
+	return frameViewBox(doc, left, top, right, bottom, margin)
+}
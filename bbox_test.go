@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseBounds(t *testing.T) {
+	if b := parseBounds("-41", "148", "-43", "146"); !b.set || b.minLat != -43 || b.maxLat != -41 || b.minLon != 146 || b.maxLon != 148 {
+		t.Errorf("edges given the wrong way round gave %+v", b)
+	}
+	for _, edges := range [][4]string{{"", "146", "-41", "148"}, {"-43", "146", "NaN", "148"}, {"-43", "west", "-41", "148"}} {
+		if b := parseBounds(edges[0], edges[1], edges[2], edges[3]); b.set {
+			t.Errorf("edges %q gave a box", edges)
+		}
+	}
+}
+
+func TestFilterByBounds(t *testing.T) {
+	b := parseBounds("-42", "146", "-41", "147")
+	records := []record{
+		{lat: -42, lon: 146}, {lat: -41, lon: 147}, // Corners
+		{lat: -41.5, lon: 146}, {lat: -41.5, lon: 146.5},
+		{lat: -42.0001, lon: 146.5}, {lat: -41.5, lon: 147.0001, count: 3},
+	}
+	kept, warning := filterByBounds(records, b)
+	if len(kept) != 4 || warning != "4 record(s) outside -42,146 to -41,147 were left off the map" {
+		t.Errorf("kept %d with %q", len(kept), warning)
+	}
+
+	if kept, warning := filterByBounds(records, parseBounds("-40", "144", "-39.5", "145")); len(kept) != 0 || warning == "" {
+		t.Errorf("box away from the records kept %d with %q", len(kept), warning)
+	}
+	if kept, warning := filterByBounds(records, bounds{}); len(kept) != len(records) || warning != "" {
+		t.Errorf("no box kept %d with %q", len(kept), warning)
+	}
+}
+
+func TestNoRecordsInRange(t *testing.T) {
+	coords := "-42.1,147.2\n-41.5,146.5"
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {coords},
+		"minlat": {"-40"}, "minlon": {"144"}, "maxlat": {"-39.5"}, "maxlon": {"145"},
+	})
+	page := rec.Body.String()
+	if rec.Code != http.StatusBadRequest || !strings.Contains(page, "No records are in range of -40,144 to -39.5,145") {
+		t.Errorf("got %d without the range message", rec.Code)
+	}
+	if !strings.Contains(page, coords) {
+		t.Error("the form lost the coordinates as they were entered")
+	}
+}
+
+func TestClipToBounds(t *testing.T) {
+	viewWidth := func(clip bool) float64 {
+		data := baseMapData("Aus bus", "plain", "-42.1,147.2\n-41.5,146.5", defaultZone)
+		data.Bounds, data.ClipToBounds = parseBounds("-42.5", "146", "-41", "147.5"), clip
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseFloat(viewBoxAttr.FindStringSubmatch(doc)[3])
+	}
+	if clipped, full := viewWidth(true), viewWidth(false); clipped >= full {
+		t.Errorf("clipped map is %g wide, the full one %g", clipped, full)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultCacheSize = 100 // Number of drawn maps kept for identical requests, set by -cachesize
+
+// cachedMap is a map drawn for a request, with what drawing it found out about the data
+type cachedMap struct {
+	key      string
+	svg      string
+	records  []record
+	warnings []string
+}
+
+// mapCache keeps the most recently drawn maps so that identical requests, such as a page
+// being reloaded, don't draw them again. The least recently used map is dropped when it
+// is full. Maps are keyed on everything that goes into drawing them, so entries never
+// need invalidating.
+type mapCache struct {
+	mu           sync.Mutex
+	size         int
+	entries      map[string]*list.Element
+	lru          *list.List // Most recently used first
+	hits, misses int
+}
+
+// renderCache is the cache of maps drawn by mapSVG
+var renderCache = newMapCache(defaultCacheSize)
+
+// newMapCache creates an empty cache holding up to size maps, or none if size is 0
+func newMapCache(size int) *mapCache {
+	return &mapCache{size: size, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// cacheKey returns the key a request is cached under, a hash of its map type and every
+// option and coordinate that affects the map. The date is included because the mapper
+// prints it on each map.
+func cacheKey(data *mapData) string {
+	opts := *data
+	opts.SVGmap, opts.Thumbnail, opts.MapID, opts.Warnings, opts.Summary = "", "", "", nil, recordSummary{}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%#v", time.Now().Format("2006-01-02"), opts)))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the map cached under key, if there is one, and counts the hit or miss
+func (mc *mapCache) get(key string) (*cachedMap, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if el, ok := mc.entries[key]; ok {
+		mc.hits++
+		mc.lru.MoveToFront(el)
+		return el.Value.(*cachedMap), true
+	}
+	mc.misses++
+	return nil, false
+}
+
+// add caches a map, dropping the least recently used maps once the cache is full
+func (mc *mapCache) add(m *cachedMap) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.size <= 0 {
+		return
+	}
+	if el, ok := mc.entries[m.key]; ok {
+		el.Value = m
+		mc.lru.MoveToFront(el)
+		return
+	}
+	mc.entries[m.key] = mc.lru.PushFront(m)
+	for mc.lru.Len() > mc.size {
+		oldest := mc.lru.Back()
+		mc.lru.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*cachedMap).key)
+	}
+}
+
+// cacheStats are the figures reported by "/stats" about the map cache
+type cacheStats struct {
+	Size     int `json:"size"`
+	Capacity int `json:"capacity"`
+	Hits     int `json:"hits"`
+	Misses   int `json:"misses"`
+}
+
+// stats returns the current figures for the cache
+func (mc *mapCache) stats() cacheStats {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return cacheStats{Size: mc.lru.Len(), Capacity: mc.size, Hits: mc.hits, Misses: mc.misses}
+}
+
+// stats handles "/stats", reporting how well the map cache is doing as JSON
+func stats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]cacheStats{"cache": renderCache.stats()})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdenticalRequestsCached(t *testing.T) {
+	defer func(mc *mapCache) { renderCache = mc }(renderCache)
+	renderCache = newMapCache(2)
+
+	draw := func(mapType, coords string) (string, []string) {
+		data := baseMapData("Aus bus", mapType, coords, defaultZone)
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc, data.Warnings
+	}
+	const reversed = "147.2,-42.1\n146.5,-41.5" // Drawn with a warning
+	first, warnings := draw("plain", reversed)
+	second, cachedWarnings := draw("plain", reversed)
+	if s := renderCache.stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("two identical requests gave %d hits and %d misses", s.Hits, s.Misses)
+	}
+	if first != second || strings.Join(warnings, "\n") != strings.Join(cachedWarnings, "\n") {
+		t.Error("cached map or its warnings differ from the map drawn")
+	}
+
+	draw("plain", "-42.1,147.2")
+	draw("grid", reversed)
+	if s := renderCache.stats(); s.Hits != 1 || s.Misses != 3 || s.Size != 2 {
+		t.Errorf("changed inputs gave %+v, want 1 hit, 3 misses and 2 maps kept", s)
+	}
+	draw("plain", reversed) // Dropped as the least recently used
+	if s := renderCache.stats(); s.Misses != 4 {
+		t.Errorf("evicted map gave %+v", s)
+	}
+
+	renderCache = newMapCache(0)
+	draw("plain", reversed)
+	draw("plain", reversed)
+	if s := renderCache.stats(); s.Hits != 0 || s.Size != 0 {
+		t.Errorf("cache of no maps gave %+v", s)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	defer func(mc *mapCache) { renderCache = mc }(renderCache)
+	renderCache = newMapCache(5)
+	renderCache.get("missing")
+
+	rec := httptest.NewRecorder()
+	stats(rec, httptest.NewRequest("GET", "/stats", nil))
+	var got map[string]cacheStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got["cache"] != (cacheStats{Capacity: 5, Misses: 1}) {
+		t.Errorf("stats gave %q (%v)", rec.Body, err)
+	}
+}
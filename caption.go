@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+const (
+	titleHeight       = 70 // Space in pixels reserved above the map for its title
+	attributionHeight = 40 // Space in pixels reserved below the map for its attribution
+)
+
+// defaultAttribution is the data source credited at the foot of maps unless a request gives
+// another, set with -attribution
+var defaultAttribution = ""
+
+// captionMap adds the taxon name in italics as a title above the map and an attribution
+// line below it, either of which can be left out. The viewBox grows to make room for them,
+// so they never overlap the map.
+func captionMap(doc, taxon, attribution string) string {
+	title, attribution := strings.TrimSpace(html.UnescapeString(taxon)), strings.TrimSpace(attribution)
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil || (title == "" && attribution == "") {
+		return doc
+	}
+	x0, _ := strconv.ParseFloat(m[1], 64)
+	y0, _ := strconv.ParseFloat(m[2], 64)
+	width, _ := strconv.ParseFloat(m[3], 64)
+	height, _ := strconv.ParseFloat(m[4], 64)
+	centre := x0 + width/2
+
+	var buf bytes.Buffer
+	if title != "" {
+		y0 -= titleHeight
+		height += titleHeight
+		fmt.Fprintf(&buf, "<g id=\"title\">\n<text x=\"%g\" y=\"%g\" style=\"font-size:36px;font-family:Arial;"+
+			"font-style:italic;fill:#000000;text-anchor:middle\">%s</text>\n</g>\n", centre, y0+48, escapeText(title))
+	}
+	if attribution != "" {
+		fmt.Fprintf(&buf, "<g id=\"attribution\">\n<text x=\"%g\" y=\"%g\" style=\"font-size:18px;font-family:Arial;"+
+			"fill:#444444;text-anchor:middle\">%s</text>\n</g>\n", centre, y0+height+26, escapeText(attribution))
+		height += attributionHeight
+	}
+
+	viewBox := fmt.Sprintf(`viewBox="%g %g %g %g"`, x0, y0, width, height)
+	return appendToSVG(strings.Replace(doc, m[0], viewBox, 1), buf.String())
+}
+
+// escapeText escapes text for an SVG text element
+func escapeText(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var captionText = regexp.MustCompile(`<g id="(title|attribution)">\n<text x="[^"]*" y="([^"]*)"[^>]*>([^<]*)</text>`)
+
+func TestCaptionedMap(t *testing.T) {
+	draw := func(title bool, attribution string) string {
+		data := baseMapData("Aus & bus <var. cus>", "plain", "-42.1,147.2", defaultZone)
+		data.Title, data.Attribution = title, attribution
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	plain, captioned := draw(false, ""), draw(true, "Herbarium & partners <TAS>")
+	if err := wellFormed(captioned); err != nil {
+		t.Fatalf("captioned map is not well-formed: %v", err)
+	}
+
+	captions := make(map[string][]string)
+	for _, m := range captionText.FindAllStringSubmatch(captioned, -1) {
+		captions[m[1]] = m[2:]
+	}
+	if got := captions["title"]; got == nil || got[1] != "Aus &amp; bus &lt;var. cus&gt;" {
+		t.Errorf("title written as %q", got)
+	}
+	if got := captions["attribution"]; got == nil || got[1] != "Herbarium &amp; partners &lt;TAS&gt;" {
+		t.Errorf("attribution written as %q", got)
+	}
+
+	// The viewBox grows by the room the captions take, above and below the map
+	before, after := viewBoxAttr.FindStringSubmatch(plain), viewBoxAttr.FindStringSubmatch(captioned)
+	top, height := parseFloat(before[2]), parseFloat(before[4])
+	if parseFloat(after[2]) != top-titleHeight || parseFloat(after[4]) != height+titleHeight+attributionHeight {
+		t.Errorf("viewBox went from %q to %q", before[0], after[0])
+	}
+	if y := parseFloat(captions["title"][0]); y >= top {
+		t.Errorf("title at %g overlaps the map, which starts at %g", y, top)
+	}
+	if y := parseFloat(captions["attribution"][0]); y <= top+height {
+		t.Errorf("attribution at %g overlaps the map, which ends at %g", y, top+height)
+	}
+}
+
+func TestCaptionLeftOut(t *testing.T) {
+	doc := `<svg viewBox="0 0 100 100"><g id="dots"/></svg>`
+	if got := captionMap(doc, "  ", ""); got != doc {
+		t.Errorf("map without captions changed to %s", got)
+	}
+	if got := captionMap(doc, "", "TAS"); strings.Contains(got, `id="title"`) || !strings.Contains(got, `viewBox="0 0 100 140"`) {
+		t.Errorf("attribution alone gave %s", got)
+	}
+}
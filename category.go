@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+const maxLegendEntries = 10 // Most categories a legend definition can list, as many as fit in the legend
+
+// legendEntry is a category listed in a legend definition, with the colour it is drawn in
+type legendEntry struct {
+	name string // Category as it appears in the coordinates
+	fill string // Hex colour of the category's markers
+}
+
+// hasCategories reports whether any of the records was given a category
+func hasCategories(records []record) bool {
+	for _, rec := range records {
+		if rec.category != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCategoryLegend reads a legend definition for category maps, one category on each
+// line in the order they are listed in the legend, each optionally followed by "=" and the
+// hex colour it is drawn in. Categories without a colour take the palette's colour for
+// their place in the list. Giving the same definition to a series of maps keeps their
+// colours and legends the same, whichever categories each of them holds.
+func parseCategoryLegend(text string) ([]legendEntry, error) {
+	var entries []legendEntry
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(lineEndings.Replace(text), "\n") {
+		name, colour := line, ""
+		if i := strings.LastIndex(line, "="); i >= 0 {
+			name, colour = line[:i], line[i+1:]
+		}
+		// Categories are read from coordinates that have had their spaces removed and been
+		// escaped, so the names are changed the same way to match them
+		name = html.EscapeString(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))
+		if name == "" {
+			if strings.TrimSpace(colour) != "" {
+				return nil, fmt.Errorf("The legend line %q has a colour but no category", strings.TrimSpace(line))
+			}
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("The category %q is listed twice in the legend", html.UnescapeString(name))
+		}
+		fill, err := markerColour(colour)
+		if err != nil {
+			return nil, fmt.Errorf("The legend colour %q for %q is not a hex colour such as #1f78b4",
+				strings.TrimSpace(colour), html.UnescapeString(name))
+		}
+		if fill == "" {
+			fill = sourceFills[len(entries)%len(sourceFills)]
+		}
+		seen[name] = true
+		entries = append(entries, legendEntry{name, fill})
+	}
+	if len(entries) > maxLegendEntries {
+		return nil, fmt.Errorf("The legend lists %d categories, more than the %d allowed", len(entries), maxLegendEntries)
+	}
+	return entries, nil
+}
+
+// categoryMap draws the Tasmania outline with the records of each category in their own
+// colour and shape, and a legend naming the categories with their record counts. Any
+// categories given in legend come first in the order and colours listed, whether or not
+// the records include them.
+func categoryMap(reg *baseRegion, rl *mapper.RecordList, records []record, legend []legendEntry, w io.Writer) {
+	groupedMap(reg, rl, records, "categories", "Category", func(rec record) string { return rec.category }, legend, w)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+var (
+	groupFill   = regexp.MustCompile(`style="fill:(#[0-9a-f]+);stroke:black" data-group="([^"]*)"`)
+	legendLabel = regexp.MustCompile(`<text x="80" y="\d+" [^>]*>([^<(]+) \(\d+\)</text>`)
+)
+
+// drawCategories draws a category map of coords with the given legend definition,
+// returning the fill of each category's markers and the categories in legend order
+func drawCategories(t *testing.T, coords, legend string) (fills map[string]string, order []string) {
+	t.Helper()
+	data := baseMapData("Aus bus", "category", coords, defaultZone)
+	data.CategoryKey = legend
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fills = make(map[string]string)
+	for _, m := range groupFill.FindAllStringSubmatch(doc, -1) {
+		fills[m[2]] = m[1]
+	}
+	for _, m := range legendLabel.FindAllStringSubmatch(doc, -1) {
+		order = append(order, m[1])
+	}
+	return fills, order
+}
+
+func TestCategoryLegendFixesColourAndOrder(t *testing.T) {
+	const legend = "1980s=#ff0000\n1990s\n2000s=#00ff00"
+	fills1, order1 := drawCategories(t, "-42.0,146.5,,2000s\n-41.5,147.0,,1990s\n", legend)
+	fills2, order2 := drawCategories(t, "-42.2,146.9,,1990s\n-41.2,146.0,,1980s\n-41.9,147.5,,1970s\n", legend)
+
+	if fills1["2000s"] != "#00ff00" || fills2["1980s"] != "#ff0000" {
+		t.Errorf("listed colours not used: 2000s %s, 1980s %s", fills1["2000s"], fills2["1980s"])
+	}
+	if fills1["1990s"] == "" || fills1["1990s"] != fills2["1990s"] {
+		t.Errorf("1990s drawn in %q on one map and %q on the other", fills1["1990s"], fills2["1990s"])
+	}
+	want1 := []string{"1980s", "1990s", "2000s"}
+	want2 := []string{"1980s", "1990s", "2000s", "1970s"} // Unlisted categories follow the listed ones
+	if !equalStrings(order1, want1) || !equalStrings(order2, want2) {
+		t.Errorf("legends listed %v and %v, want %v and %v", order1, order2, want1, want2)
+	}
+}
+
+func TestParseCategoryLegend(t *testing.T) {
+	entries, err := parseCategoryLegend("HO=#FF0000\r\n\nMEL\n Tas Herb = #00ff00 \n")
+	want := []legendEntry{{"HO", "#ff0000"}, {"MEL", sourceFills[1]}, {"TasHerb", "#00ff00"}}
+	if err != nil || len(entries) != len(want) {
+		t.Fatalf("got %v, %v, want %v", entries, err, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d is %v, want %v", i, entries[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"HO=red", "HO\nHO", "=#ff0000", "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk"} {
+		if _, err := parseCategoryLegend(bad); err == nil {
+			t.Errorf("legend %q accepted", bad)
+		}
+	}
+}
+
+// equalStrings reports whether a and b hold the same strings in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestThreeCategories(t *testing.T) {
+	coords := "-42.0,146.5,,HO\n-41.5,147.0,1,MEL\n-42.2,146.9,,NSW\n-41.2,146.0,0,HO\n"
+	fills, order := drawCategories(t, coords, "")
+	if !equalStrings(order, []string{"HO", "MEL", "NSW"}) {
+		t.Errorf("legend lists %v, want HO, MEL and NSW", order)
+	}
+	if len(fills) != 3 || fills["HO"] == fills["MEL"] || fills["MEL"] == fills["NSW"] || fills["HO"] == fills["NSW"] {
+		t.Errorf("categories drawn in %v, want three colours", fills)
+	}
+	again, _ := drawCategories(t, coords, "")
+	for name, fill := range fills {
+		if again[name] != fill {
+			t.Errorf("%s drawn in %s, then %s", name, fill, again[name])
+		}
+	}
+}
+
+func TestCategoryField(t *testing.T) {
+	tests := []struct {
+		line, rest, category string
+	}{
+		{"-42.0,146.5,,1990s", "-42.0,146.5", "1990s"},
+		{"-42.0,146.5,1,HO", "-42.0,146.5,1", "HO"},
+		{"42,0,0,146,30,0,,MEL", "42,0,0,146,30,0", "MEL"},
+		{"-42.0,146.5,1", "-42.0,146.5,1", ""},
+		{"-42.0,146.5,1,", "-42.0,146.5,1", ""},
+	}
+	for _, tt := range tests {
+		if rest, category, _, _ := splitExtras(tt.line); rest != tt.rest || category != tt.category {
+			t.Errorf("splitExtras(%q) = %q, %q, want %q, %q", tt.line, rest, category, tt.rest, tt.category)
+		}
+	}
+
+	doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "category", "-42.0,146.5\n-41.5,147.0", defaultZone))
+	if err != nil || len(records) != 2 || groupFill.MatchString(doc) {
+		t.Errorf("records without categories not drawn as a plain map (%v)", err)
+	}
+}
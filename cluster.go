@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+const maxClusterKm = 20.0 // Largest distance in km within which records can be clustered
+
+// parseClusterKm reads the distance in km within which records are clustered, limited to
+// maxClusterKm, giving 0, for no clustering, for anything that isn't a positive number
+func parseClusterKm(value string) float64 {
+	km, err := strconv.ParseFloat(value, 64)
+	if err != nil || km <= 0 || math.IsNaN(km) {
+		return 0
+	}
+	return math.Min(km, maxClusterKm)
+}
+
+// clusterRecords merges records that lie within km of each other, such as records of one
+// locality whose coordinates were rounded differently, which dedupeRecords would keep apart
+// when they straddle a rounding boundary. Each cluster starts from the first record not yet
+// in one, takes in every later record within km of that record and is drawn at the mean
+// position of its records, with their count and voucher status merged as for duplicates.
+// Records of different taxa are never clustered. It returns how many records were merged
+// into others.
+func clusterRecords(records []record, km float64) (clustered []record, merged int) {
+	type cell struct {
+		col, row int
+		taxon    string
+	}
+	type cluster struct {
+		seed           record  // First record of the cluster, which the others are within km of
+		sumLat, sumLon float64 // Positions of the records in the cluster, weighted by their counts
+		total          int     // Number of records the cluster stands for
+		index          int     // Position of the cluster in clustered
+	}
+
+	// Clusters are found through a grid of cells at least km across, so that only the
+	// clusters in the cells around a record are compared with it. Degrees of longitude are
+	// narrowest furthest from the equator, so the cells are as wide as km there.
+	furthest := 0.0
+	for _, rec := range records {
+		furthest = math.Max(furthest, math.Abs(rec.lat))
+	}
+	latStep := km / (math.Pi / 180 * earthRadiusKm)
+	lonStep := latStep / math.Max(math.Cos(furthest*math.Pi/180), 0.01)
+	cellOf := func(rec record) (col, row int) {
+		return int(math.Floor(rec.lon / lonStep)), int(math.Floor(rec.lat / latStep))
+	}
+	grid := make(map[cell][]*cluster)
+	var clusters []*cluster
+	for _, rec := range records {
+		col, row := cellOf(rec)
+		var found *cluster
+	search:
+		for dc := -1; dc <= 1; dc++ {
+			for dr := -1; dr <= 1; dr++ {
+				for _, c := range grid[cell{col + dc, row + dr, rec.taxon}] {
+					if greatCircleKm(c.seed.lat, c.seed.lon, rec.lat, rec.lon) <= km {
+						found = c
+						break search
+					}
+				}
+			}
+		}
+
+		w := rec.weight()
+		if found == nil {
+			rec.count = w
+			c := &cluster{seed: rec, sumLat: rec.lat * float64(w), sumLon: rec.lon * float64(w), total: w,
+				index: len(clustered)}
+			clusters = append(clusters, c)
+			grid[cell{col, row, rec.taxon}] = append(grid[cell{col, row, rec.taxon}], c)
+			clustered = append(clustered, rec)
+			continue
+		}
+		kept := &clustered[found.index]
+		kept.count += w
+		kept.voucher = kept.voucher || rec.voucher
+		kept.focal = kept.focal || rec.focal
+		found.sumLat += rec.lat * float64(w)
+		found.sumLon += rec.lon * float64(w)
+		found.total += w
+		merged++
+	}
+
+	for _, c := range clusters {
+		clustered[c.index].lat = c.sumLat / float64(c.total)
+		clustered[c.index].lon = c.sumLon / float64(c.total)
+		clustered[c.index].rounded = false
+	}
+	return clustered, merged
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestClusterRecords(t *testing.T) {
+	base := record{lat: -42.0, lon: 146.5}
+	offset := func(km float64) record { // A record km north of base
+		return record{lat: base.lat + km/(math.Pi/180*earthRadiusKm), lon: base.lon}
+	}
+	tests := []struct {
+		name    string
+		records []record
+		km      float64
+		points  int
+	}{
+		{"within the distance", []record{base, offset(0.9)}, 1, 1},
+		{"just beyond it", []record{base, offset(1.1)}, 1, 2},
+		{"chained past it", []record{base, offset(0.8), offset(1.6)}, 1, 2}, // Each is within km of the first only
+		{"other taxa", []record{base, {lat: base.lat, lon: base.lon, taxon: "Cus dus"}}, 1, 2},
+		{"far apart", parseRecords(spreadCoords(20)), 0.1, 20},
+	}
+	for _, tt := range tests {
+		clustered, merged := clusterRecords(tt.records, tt.km)
+		if len(clustered) != tt.points || merged != len(tt.records)-tt.points {
+			t.Errorf("%s: %d records clustered into %d points with %d merged, want %d points", tt.name,
+				len(tt.records), len(clustered), merged, tt.points)
+		}
+	}
+
+	dup := offset(0.5)
+	dup.count, dup.voucher = 3, true // Already stands for three records
+	clustered, _ := clusterRecords([]record{base, dup}, 1)
+	c := clustered[0]
+	if want := base.lat + 3.0/4*(dup.lat-base.lat); c.weight() != 4 || !c.voucher || math.Abs(c.lat-want) > 1e-9 || c.lon != base.lon {
+		t.Errorf("merged point %+v, want 4 records at %g,%g with a voucher", c, want, base.lon)
+	}
+}
+
+func TestParseClusterKm(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 0}, {"2.5", 2.5}, {"-1", 0}, {"near", 0}, {"NaN", 0}, {"500", maxClusterKm},
+	}
+	for _, tt := range tests {
+		if got := parseClusterKm(tt.value); got != tt.want {
+			t.Errorf("parseClusterKm(%q) = %g, want %g", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClusteredMap(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.1,147.2\n-42.1004,147.2005\n-41.5,146.5\n", defaultZone)
+	data.ClusterKm = 1
+	_, records, err := mapSVG(context.Background(), data)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("got %d records (%v), want 2", len(records), err)
+	}
+	if w := strings.Join(data.Warnings, "\n"); !strings.Contains(w, "1 record(s) within 1 km of another were merged") {
+		t.Errorf("got warnings %q", data.Warnings)
+	}
+}
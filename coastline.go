@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// pixel is a position on the map canvas
+type pixel struct {
+	x, y float64
+}
+
+var (
+	coastOnce  sync.Once
+	coastRings [][]pixel // Closed outlines of the main island and every other island drawn
+
+	pathToken = regexp.MustCompile(`[A-Za-z]|-?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+)
+
+// coastline returns the outline of Tasmania drawn by the mapper as a set of closed rings in
+// canvas pixels. It is extracted from the mapper's own output the first time it is needed,
+// so that it always matches the coastline on the maps.
+func coastline() [][]pixel {
+	coastOnce.Do(func() {
+		buf := new(bytes.Buffer)
+		mapperMu.Lock()
+		mapper.ExactMap(&mapper.RecordList{}, buf)
+		mapperMu.Unlock()
+		doc := buf.String()
+
+		const attr = `<path d="`
+		start := strings.Index(doc, attr)
+		if start < 0 {
+			errorLog.Println("Could not find the coastline in the mapper output")
+			return
+		}
+		start += len(attr)
+		end := strings.Index(doc[start:], `"`)
+		coastRings = parsePath(doc[start : start+end])
+	})
+	return coastRings
+}
+
+// parsePath converts SVG path data into closed rings of points. Curves and arcs are
+// replaced by straight lines to their end points, which is close enough at the scale of
+// the coastline for testing whether something is on land.
+func parsePath(d string) (rings [][]pixel) {
+	tokens := pathToken.FindAllString(d, -1)
+	var ring []pixel
+	var cur, start pixel
+	var cmd string
+
+	// Number of arguments taken by each command
+	argCount := map[string]int{"m": 2, "l": 2, "h": 1, "v": 1, "c": 6, "s": 4, "q": 4, "t": 2, "a": 7}
+
+	closeRing := func() {
+		if len(ring) > 2 {
+			rings = append(rings, ring)
+		}
+		ring = nil
+	}
+
+	for i := 0; i < len(tokens); {
+		if t := tokens[i]; (t[0] >= 'A' && t[0] <= 'Z') || (t[0] >= 'a' && t[0] <= 'z') {
+			cmd = t
+			i++
+			if strings.ToLower(cmd) == "z" {
+				closeRing()
+				cur = start
+				continue
+			}
+		}
+
+		lower := strings.ToLower(cmd)
+		n := argCount[lower]
+		if n == 0 || i+n > len(tokens) {
+			break
+		}
+		args := make([]float64, n)
+		for j := range args {
+			args[j], _ = strconv.ParseFloat(tokens[i+j], 64)
+		}
+		i += n
+
+		relative := cmd == lower
+		next := cur
+		switch lower {
+		case "h":
+			next.x = args[0]
+			if relative {
+				next.x += cur.x
+			}
+		case "v":
+			next.y = args[0]
+			if relative {
+				next.y += cur.y
+			}
+		default: // Every other command ends at its last pair of arguments
+			next = pixel{args[n-2], args[n-1]}
+			if relative {
+				next.x += cur.x
+				next.y += cur.y
+			}
+		}
+
+		if lower == "m" {
+			closeRing()
+			start = next
+			cmd = "L" // Further pairs of arguments after a move are lines
+			if relative {
+				cmd = "l"
+			}
+		}
+		ring = append(ring, next)
+		cur = next
+	}
+	closeRing()
+
+	return rings
+}
+
+// onLand reports whether a canvas position falls inside the coastline, using the even-odd
+// rule across all rings so that lakes drawn as separate rings count as water
+func onLand(reg *baseRegion, p pixel) bool {
+	in := false
+	for _, ring := range reg.outline() {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a.y > p.y) != (b.y > p.y) && p.x < (b.x-a.x)*(p.y-a.y)/(b.y-a.y)+a.x {
+				in = !in
+			}
+		}
+	}
+	return in
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// compositeTypes returns the map types requested together with the maptypes form value,
+// given either as repeated values or as a comma separated list such as "grid,plain"
+func compositeTypes(r *http.Request) (types []string) {
+	seen := make(map[string]bool)
+	for _, value := range r.Form["maptypes"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" && !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// serveComposite draws one map of each requested type from a single parse of the data,
+// and responds with all of them in a zip archive. All the maps together must be drawn
+// within renderTimeout.
+func serveComposite(w http.ResponseWriter, r *http.Request, data *mapData, types []string) {
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	p := parseMapData(ctx, data)
+
+	maps := make([]string, len(types))
+	for i, t := range types {
+		if !knownMapTypes[t] {
+			serveError(w, http.StatusBadRequest, fmt.Sprintf("Unknown map type %q.", t))
+			return
+		}
+		svgMap, err := drawMap(ctx, data, p, t)
+		if err != nil {
+			serveError(w, renderStatus(err), err.Error())
+			return
+		}
+		maps[i] = svgMap
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	setAttachment(w, safeFileName(data.TaxonName)+".maps.zip")
+
+	zw := zip.NewWriter(w)
+	for i, t := range types {
+		f, err := zw.Create(mapFileName(data.TaxonName, t))
+		if err != nil {
+			errorLog.Printf("Error writing composite map: %s", err)
+			return
+		}
+		fmt.Fprint(f, maps[i])
+	}
+	if err := zw.Close(); err != nil {
+		errorLog.Printf("Error writing composite maps: %s", err)
+	}
+}
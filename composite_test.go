@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCompositeGridAndPlain(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"taxon": {"Aus bus"}, "coordinates": {"-42.0,146.5\n-41.5,147.0\n"}, "maptypes": {"grid,plain"},
+	})
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("composite request gave %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maps := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		maps[f.Name] = string(b)
+	}
+	grid, plain := maps["aus-bus.grid.svg"], maps["aus-bus.plain.svg"]
+	if len(maps) != 2 || !strings.Contains(grid, "<svg") || !strings.Contains(plain, "<svg") {
+		t.Fatalf("archive holds %d files, want a grid and a plain map", len(maps))
+	}
+	if grid == plain {
+		t.Error("grid and plain maps are the same")
+	}
+	if want, err := renderMap("Aus bus", "plain", "-42.0,146.5\n-41.5,147.0\n"); err != nil || plain != want {
+		t.Error("plain map from the composite request differs from one drawn on its own")
+	}
+}
+
+func TestCompositeUnknownType(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"coordinates": {"-42.0,146.5"}, "maptypes": {"grid", "nosuch"},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown type in a composite request gave %d, want 400", rec.Code)
+	}
+}
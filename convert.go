@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// conversionSlots holds a token for each map being converted to PNG or PDF, as each can take
+// a second or more and tens of MB, so that only as many are converted at once as there are
+// processors
+var conversionSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// isConversion reports whether a request to "/mapfile" converts the map to another format,
+// rather than sending the SVG that is already drawn
+func isConversion(r *http.Request) bool {
+	format := r.FormValue("format")
+	return format == "png" || format == "pdf"
+}
+
+// limitConversions sends the requests to h that convert a map through rl, like those that
+// draw maps, and waits for one of conversionSlots before converting. A request that gets
+// no slot before its renderContext runs out is refused with 503. Other requests go straight
+// to h.
+func limitConversions(rl *rateLimiter, h http.HandlerFunc) http.HandlerFunc {
+	limited := rl.limit(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := renderContext(r)
+		defer cancel()
+		select {
+		case conversionSlots <- struct{}{}:
+			defer func() { <-conversionSlots }()
+		case <-ctx.Done():
+			writeError(w, r, http.StatusServiceUnavailable, "Too many maps are being converted at once. Please try again shortly.")
+			return
+		}
+		h(w, r)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isConversion(r) {
+			limited(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
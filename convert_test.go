@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConversionsLimited(t *testing.T) {
+	ms := newMapStore()
+	doc, err := renderMap("Aus bus", "plain", "-42.1,147.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ms.add(&svgMap{mapName: "aus-bus.plain.svg", svgMap: doc})
+	h := limitConversions(newRateLimiter(0.001, 1), ms.mapAsFile) // One conversion, then none for a long while
+	get := func(query string) int {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/mapfile?id="+id+query, nil))
+		return rec.Code
+	}
+
+	if code := get("&format=png&dpi=100000"); code != http.StatusOK {
+		t.Errorf("first conversion gave %d", code)
+	}
+	if code := get("&format=pdf"); code != http.StatusTooManyRequests {
+		t.Errorf("conversion past the limit gave %d, want 429", code)
+	}
+	for i := 0; i < 3; i++ {
+		if code := get(""); code != http.StatusOK {
+			t.Errorf("SVG download gave %d, want it never limited", code)
+		}
+	}
+
+	defer func(d time.Duration) { renderTimeout = d }(renderTimeout)
+	renderTimeout = 50 * time.Millisecond
+	for i := 0; i < cap(conversionSlots); i++ { // Every slot is taken by conversions in progress
+		conversionSlots <- struct{}{}
+	}
+	rec := httptest.NewRecorder()
+	limitConversions(newRateLimiter(0, 1), ms.mapAsFile)(rec, httptest.NewRequest("GET", "/mapfile?id="+id+"&format=png", nil))
+	for i := 0; i < cap(conversionSlots); i++ {
+		<-conversionSlots
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("conversion with no slot free gave %d, want 503", rec.Code)
+	}
+}
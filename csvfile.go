@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errNoCoordColumns = errors.New("no latitude and longitude columns could be found in the file")
+
+// Column names recognised in the header row of an uploaded CSV file
+var (
+	latHeaders     = map[string]bool{"lat": true, "latitude": true, "decimallatitude": true}
+	lonHeaders     = map[string]bool{"lon": true, "long": true, "lng": true, "longitude": true, "decimallongitude": true}
+	voucherHeaders = map[string]bool{"voucher": true, "vouchered": true, "voucherstatus": true}
+)
+
+// csvCoords reads a CSV file of records and rebuilds it as comma separated coordinate lines
+// the mapper can read. A first row that isn't numeric is taken as a header naming the
+// latitude, longitude and optional voucher columns, including the Darwin Core columns of
+// GBIF occurrence downloads, where a basisOfRecord of PreservedSpecimen marks a vouchered
+// record. Without a header the first two columns are the latitude and longitude, and a
+// third column is the voucher status. Tab separated files, as GBIF exports, are read too.
+// Rows without a latitude or longitude are skipped and counted.
+func csvCoords(file io.Reader) (coords string, skipped int, err error) {
+	buffered := bufio.NewReader(file)
+	var next func() ([]string, error) // Reads one row at a time, so the file is never held as rows
+	if first, _ := buffered.Peek(4096); strings.Count(string(first), "\t") > strings.Count(string(first), ",") {
+		next = tabRows(buffered)
+	} else {
+		reader := csv.NewReader(buffered)
+		reader.FieldsPerRecord = -1 // Spreadsheets don't always write the same number of fields on every row
+		reader.TrimLeadingSpace = true
+		reader.ReuseRecord = true
+		next = reader.Read
+	}
+
+	row, err := next()
+	if err == io.EOF {
+		return "", 0, errNoCoordColumns
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	latCol, lonCol, voucherCol, basisCol := 0, 1, 2, -1
+	if _, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64); err != nil { // Header row
+		latCol, lonCol, voucherCol = -1, -1, -1
+		for i, name := range row {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch {
+			case latHeaders[name]:
+				latCol = i
+			case lonHeaders[name]:
+				lonCol = i
+			case voucherHeaders[name]:
+				voucherCol = i
+			case name == "basisofrecord":
+				basisCol = i
+			}
+		}
+		if latCol < 0 || lonCol < 0 {
+			return "", 0, errNoCoordColumns
+		}
+		row, err = next()
+	}
+
+	var sb strings.Builder
+	for ; err == nil; row, err = next() {
+		if latCol >= len(row) || lonCol >= len(row) ||
+			strings.TrimSpace(row[latCol]) == "" || strings.TrimSpace(row[lonCol]) == "" {
+			skipped++
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(row[latCol] + "," + row[lonCol])
+		if voucherCol >= 0 && voucherCol < len(row) && strings.TrimSpace(row[voucherCol]) != "" {
+			sb.WriteString("," + row[voucherCol])
+		} else if voucherCol < 0 && basisCol >= 0 && basisCol < len(row) {
+			// Darwin Core writes PreservedSpecimen, while GBIF downloads write PRESERVED_SPECIMEN
+			if basis := strings.ReplaceAll(strings.TrimSpace(row[basisCol]), "_", ""); strings.EqualFold(basis, "PreservedSpecimen") {
+				sb.WriteString(",v")
+			} else {
+				sb.WriteString(",a")
+			}
+		}
+	}
+	if err != io.EOF {
+		return "", 0, err
+	}
+	return sb.String(), skipped, nil
+}
+
+// tabRows returns a function reading a tab separated file a row of fields at a time,
+// skipping blank lines. Fields aren't quoted in these files, so quotes in free text
+// columns are kept as they are.
+func tabRows(file io.Reader) func() ([]string, error) {
+	scanner := lineScanner(file) // Occurrence rows can be long
+	return func() ([]string, error) {
+		for scanner.Scan() {
+			if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+				return strings.Split(line, "\t"), nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// addCSVFile merges the coordinates in a CSV file uploaded with the form into data, along
+// with any coordinates typed into the form. It reports false after serving an error page
+// if the file can't be read.
+func addCSVFile(w http.ResponseWriter, r *http.Request, data *mapData) bool {
+	if r.MultipartForm == nil { // Only multipart forms can include a file
+		return true
+	}
+	file, _, err := r.FormFile("csvfile")
+	if err == http.ErrMissingFile {
+		return true
+	} else if err != nil {
+		errorLog.Printf("Error reading uploaded CSV file: %s", err)
+		serveError(w, http.StatusBadRequest, "The uploaded file could not be read.")
+		return false
+	}
+	defer file.Close()
+
+	coords, skipped, err := csvCoords(file)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, "The uploaded file could not be used: "+err.Error()+".")
+		return false
+	}
+	if skipped > 0 {
+		data.Warnings = append(data.Warnings,
+			fmt.Sprintf("%d record(s) in the uploaded file without a latitude or longitude were skipped", skipped))
+	}
+	data.mergeSources(dataSource{"csv", data.readCoords(coords)}, dataSource{"typed", data.RawCoords})
+	return true
+}
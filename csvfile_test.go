@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSVCoords(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    string
+		skipped int
+	}{
+		{"no header", "-42.1,147.2\n-41.5,146.5,1\n", "-42.1,147.2\n-41.5,146.5,1", 0},
+		{"header", "Name,Latitude,Longitude,Voucher\nAus bus,-42.1,147.2,1\nAus bus,-41.5,146.5,\n", "-42.1,147.2,1\n-41.5,146.5", 0},
+		{"missing position", "lat,lon\n-42.1,147.2\n,146.5\n", "-42.1,147.2", 1},
+		{"tab separated", "decimalLatitude\tdecimalLongitude\tbasisOfRecord\n-42.1\t147.2\tPRESERVED_SPECIMEN\n-41.5\t146.5\tHUMAN_OBSERVATION\n",
+			"-42.1,147.2,v\n-41.5,146.5,a", 0},
+		{"quoted fields", "latitude,longitude,notes\n\"-42.1\",\"147.2\",\"wet, shady\"\n", "-42.1,147.2", 0},
+	}
+	for _, tt := range tests {
+		coords, skipped, err := csvCoords(strings.NewReader(tt.file))
+		if err != nil || coords != tt.want || skipped != tt.skipped {
+			t.Errorf("%s: got %q, %d skipped, %v, want %q, %d skipped", tt.name, coords, skipped, err, tt.want, tt.skipped)
+		}
+	}
+
+	for _, file := range []string{"", "name,place\nAus bus,Hobart\n"} {
+		if _, _, err := csvCoords(strings.NewReader(file)); err != errNoCoordColumns {
+			t.Errorf("file %q gave %v, want errNoCoordColumns", file, err)
+		}
+	}
+}
+
+// uploadCSV posts the form with a CSV file attached, returning the response
+func uploadCSV(file []byte) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("maptype", "plain")
+	f, _ := mw.CreateFormFile("csvfile", "records.csv")
+	f.Write(file)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/map", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	newMapStore().mapDisplay(rec, req)
+	return rec
+}
+
+func TestCSVUpload(t *testing.T) {
+	if rec := uploadCSV([]byte("latitude,longitude\n-42.1,147.2\n-41.5,146.5\n")); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), `id="dots"`) {
+		t.Errorf("uploaded file gave %d without a map", rec.Code)
+	}
+	if rec := uploadCSV([]byte("name,place\nAus bus,Hobart\n")); rec.Code != http.StatusBadRequest ||
+		!strings.Contains(rec.Body.String(), errNoCoordColumns.Error()) {
+		t.Errorf("file without coordinates gave %d", rec.Code)
+	}
+	if rec := uploadCSV(make([]byte, maxUploadSize+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized file gave %d, want 413", rec.Code)
+	}
+}
+
+func TestDarwinCoreColumns(t *testing.T) {
+	file := "gbifID,scientificName,decimalLatitude,decimalLongitude,basisOfRecord,eventDate\n" +
+		"1,Aus bus,-42.1,147.2,PreservedSpecimen,2001-01-01\n" +
+		"2,Aus bus,-41.5,146.5,HumanObservation,\n" +
+		"3,Aus bus,-41.2,,PRESERVED_SPECIMEN,\n" +
+		"4,Aus bus,-41.8,145.9,MaterialSample,\n"
+	coords, skipped, err := csvCoords(strings.NewReader(file))
+	if want := "-42.1,147.2,v\n-41.5,146.5,a\n-41.8,145.9,a"; err != nil || coords != want || skipped != 1 {
+		t.Errorf("got %q with %d skipped (%v), want %q with 1 skipped", coords, skipped, err, want)
+	}
+
+	rec := uploadCSV([]byte(file))
+	page := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(page, "1 record(s) in the uploaded file without a latitude or longitude were skipped") {
+		t.Errorf("skipped record not reported, got %d", rec.Code)
+	}
+}
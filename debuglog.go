@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const debugInputLimit = 200 // Number of characters of submitted coordinates kept when truncating
+
+var (
+	debugLogging bool         // Whether debug messages are written to errorLog, set by -loglevel
+	debugInput   = "truncate" // How submitted coordinates appear in debug messages, set by -debuginput
+	digits       = regexp.MustCompile(`\d`)
+)
+
+// setLogLevel configures which messages are logged. Only "info", the default, and "debug"
+// are recognised.
+func setLogLevel(level string) error {
+	switch level {
+	case "info":
+		debugLogging = false
+	case "debug":
+		debugLogging = true
+	default:
+		return fmt.Errorf("unknown log level %q, use info or debug", level)
+	}
+	return nil
+}
+
+// debugf writes a message to errorLog when debug logging is enabled
+func debugf(format string, v ...interface{}) {
+	if debugLogging {
+		errorLog.Printf("DEBUG "+format, v...)
+	}
+}
+
+// describeInput returns submitted coordinates in the form chosen for debug logs: "full"
+// keeps them as they are, "redact" replaces every digit so only the layout of the data is
+// visible, and "truncate" keeps only the start of the data
+func describeInput(coords string) string {
+	switch debugInput {
+	case "full":
+		return coords
+	case "redact":
+		return digits.ReplaceAllString(coords, "#")
+	default:
+		if len(coords) > debugInputLimit {
+			return coords[:debugInputLimit] + fmt.Sprintf("... (%d bytes in total)", len(coords))
+		}
+		return coords
+	}
+}
+
+// debugParseFailure logs what the user submitted when their data couldn't be mapped, to
+// help diagnose problems without asking them to send it again
+func debugParseFailure(data *mapData, format string) {
+	if !debugLogging {
+		return
+	}
+	lines := strings.Count(data.RawCoords, "\n") + 1
+	debugf("Could not map submission: taxon=%q maptype=%q format=%q lines=%d coordinates=%q",
+		data.TaxonName, data.MapType, format, lines, describeInput(data.RawCoords))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// logParseFailure submits coords that can't be mapped with debug logging set as given,
+// returning what was written to errorLog
+func logParseFailure(t *testing.T, debug bool, coords string) string {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	errorLog.SetOutput(buf)
+	debugLogging = debug
+	defer func() {
+		errorLog.SetOutput(io.Discard)
+		debugLogging = false
+	}()
+
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{"maptype": {"plain"}, "coordinates": {coords}})
+	if rec.Code != 400 {
+		t.Fatalf("unmappable submission gave %d, want 400", rec.Code)
+	}
+	return buf.String()
+}
+
+func TestDebugLogsParseFailure(t *testing.T) {
+	coords := strings.Repeat("nonsense\n", 100)
+	logged := logParseFailure(t, true, coords)
+	if !strings.Contains(logged, "DEBUG Could not map submission") || !strings.Contains(logged, `maptype="plain"`) {
+		t.Fatalf("parse failure not logged with debug on: %q", logged)
+	}
+	if !strings.Contains(logged, `coordinates="nonsense\nnonsense\n`) ||
+		!strings.Contains(logged, "bytes in total)") || strings.Count(logged, "nonsense") > debugInputLimit/len("nonsense\n")+1 {
+		t.Errorf("submitted input not logged truncated: %q", logged)
+	}
+
+	if logged := logParseFailure(t, false, coords); strings.Contains(logged, "DEBUG") {
+		t.Errorf("debug message logged with debug off: %q", logged)
+	}
+}
+
+func TestDescribeInput(t *testing.T) {
+	defer func() { debugInput = "truncate" }()
+	tests := []struct{ mode, coords, want string }{
+		{"truncate", "-42.1,147.2", "-42.1,147.2"},
+		{"redact", "-42.1,147.2 Aus bus", "-##.#,###.# Aus bus"},
+		{"full", strings.Repeat("x", 300), strings.Repeat("x", 300)},
+	}
+	for _, tt := range tests {
+		debugInput = tt.mode
+		if got := describeInput(tt.coords); got != tt.want {
+			t.Errorf("%s: describeInput(%q) = %q, want %q", tt.mode, tt.coords, got, tt.want)
+		}
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer setLogLevel("info")
+	if err := setLogLevel("debug"); err != nil || !debugLogging {
+		t.Errorf("debug level gave %v, debugLogging %v", err, debugLogging)
+	}
+	if err := setLogLevel("verbose"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+const (
+	defaultDedupePlaces = 3 // Decimal places coordinates are rounded to when merging duplicates, about 100 m
+	maxDedupePlaces     = 6
+	markerRadius        = 9 // Radius of the circles the mapper draws for each record
+)
+
+// dedupeRecords merges records whose coordinates are the same when rounded to the given
+// number of decimal places, keeping the first of each group with a count of the records
+// merged into it. A group is vouchered if any of its records is.
+func dedupeRecords(records []record, places int) (merged []record, removed int) {
+	scale := math.Pow(10, float64(places))
+	type place struct {
+		lat, lon float64
+		taxon    string // Records of different taxa are never merged
+	}
+	index := make(map[place]int)
+	for _, rec := range records {
+		key := place{math.Round(rec.lat * scale), math.Round(rec.lon * scale), rec.taxon}
+		if i, ok := index[key]; ok {
+			merged[i].count += rec.weight()
+			merged[i].voucher = merged[i].voucher || rec.voucher
+			merged[i].focal = merged[i].focal || rec.focal
+			removed++
+			continue
+		}
+		rec.count = rec.weight()
+		index[key] = len(merged)
+		merged = append(merged, rec)
+	}
+	return merged, removed
+}
+
+// weight returns the number of records a record stands for once duplicates are merged
+func (rec record) weight() int {
+	if rec.count == 0 {
+		return 1
+	}
+	return rec.count
+}
+
+// countMarkers replaces the mapper's points with circles whose area is proportional to the
+// number of records merged into each, so that shared localities stand out. A single record
+// is drawn at the radius of m.
+func countMarkers(reg *baseRegion, doc string, records []record, m markerStyle) string {
+	buf := new(bytes.Buffer)
+	canvas := svg.New(buf)
+	canvas.Gid("counts")
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		r := int(math.Round(float64(m.radius) * math.Sqrt(float64(rec.weight()))))
+		canvas.Circle(x, y, r, "fill:"+m.colour, fmt.Sprintf(`data-count="%d"`, rec.weight()))
+	}
+	canvas.Gend()
+	return appendToSVG(emptyGroup(doc, "dots"), buf.String())
+}
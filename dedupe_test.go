@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+var countCircle = regexp.MustCompile(`<circle cx="\d+" cy="\d+" r="(\d+)" style="[^"]*" data-count="(\d+)"`)
+
+func TestDedupeRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		coords  string
+		places  int
+		counts  []int
+		removed int
+	}{
+		{"exact duplicates", "-42.1,147.2\n-42.1,147.2\n-42.1,147.2\n-41.5,146.5", 3, []int{3, 1}, 2},
+		{"within the tolerance", "-42.1001,147.2001\n-42.1004,147.1999", 3, []int{2}, 1},
+		{"outside the tolerance", "-42.1001,147.2001\n-42.1009,147.2001", 3, []int{1, 1}, 0},
+		{"coarser tolerance", "-42.1001,147.2001\n-42.1009,147.2001", 2, []int{2}, 1},
+	}
+	for _, tt := range tests {
+		merged, removed := dedupeRecords(parseRecords(tt.coords), tt.places)
+		var counts []int
+		for _, rec := range merged {
+			counts = append(counts, rec.weight())
+		}
+		if removed != tt.removed || len(counts) != len(tt.counts) {
+			t.Errorf("%s: got counts %v with %d removed, want %v", tt.name, counts, removed, tt.counts)
+			continue
+		}
+		for i := range counts {
+			if counts[i] != tt.counts[i] {
+				t.Errorf("%s: got counts %v, want %v", tt.name, counts, tt.counts)
+				break
+			}
+		}
+	}
+}
+
+func TestDedupeKeepsVouchers(t *testing.T) {
+	merged, _ := dedupeRecords(parseRecords("-42.1,147.2,0\n-42.1,147.2,1\n-42.1,147.2,0"), 3)
+	if len(merged) != 1 || !merged[0].voucher || merged[0].weight() != 3 {
+		t.Errorf("group with a vouchered record merged to %+v", merged)
+	}
+	again, _ := dedupeRecords(merged, 3) // Its count carries over when merged again
+	if again[0].weight() != 3 {
+		t.Errorf("merged again with a count of %d", again[0].weight())
+	}
+}
+
+func TestMarkersScaledByCount(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.1,147.2\n-42.1,147.2\n-42.1,147.2\n-42.1,147.2\n-41.5,146.5", defaultZone)
+	data.Dedupe, data.ScaleByCount = true, true
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := countCircle.FindAllStringSubmatch(doc, -1)
+	if len(m) != 2 || m[0][2] != "4" || m[0][1] != "18" || m[1][2] != "1" || m[1][1] != "9" {
+		t.Errorf("got markers %v, want radius 18 for 4 records and 9 for 1", m)
+	}
+}
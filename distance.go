@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+const earthRadiusKm = 6371.0 // Mean radius of the Earth
+
+// distanceRamp is the sequence of fills used for points from nearest to furthest from the
+// reference coordinate
+var distanceRamp = []string{"#440154", "#3b528b", "#21918c", "#5ec962", "#fde725"}
+
+// greatCircleKm returns the great-circle distance in km between two coordinates, using the
+// haversine formula
+func greatCircleKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// distanceMap draws the Tasmania outline with each record coloured along a ramp by its
+// distance from ref, and a legend of the distance bands. If showRef is set the reference
+// is marked with a star, provided it falls on the map; distances are worked out wherever
+// it is.
+func distanceMap(reg *baseRegion, rl *mapper.RecordList, records []record, ref record, showRef bool, w io.Writer) {
+	dists := make([]float64, len(records))
+	max := 0.0
+	for i, rec := range records {
+		dists[i] = greatCircleKm(ref.lat, ref.lon, rec.lat, rec.lon)
+		max = math.Max(max, dists[i])
+	}
+	band := max / float64(len(distanceRamp))
+
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid("distances")
+	for i, rec := range records {
+		idx := 0
+		if band > 0 {
+			idx = int(math.Min(dists[i]/band, float64(len(distanceRamp)-1)))
+		}
+		x, y := reg.project(rec.lat, rec.lon)
+		canvas.Circle(x, y, 9, "fill:"+distanceRamp[idx]+";stroke:black", fmt.Sprintf(`data-km="%.1f"`, dists[i]))
+	}
+	canvas.Gend()
+
+	if showRef {
+		if x, y := reg.project(ref.lat, ref.lon); x > 0 && x < canvasWidth && y > 0 && y < canvasHeight {
+			canvas.Gid("reference")
+			canvas.Path(starPath(x, y, 16), "fill:#e41a1c;stroke:black;stroke-width:2px")
+			canvas.Gend()
+		}
+	}
+
+	labels := make([]string, len(distanceRamp))
+	for i := range distanceRamp {
+		labels[i] = fmt.Sprintf("%.0f-%.0f km", float64(i)*band, float64(i+1)*band)
+	}
+	rampLegend(canvas, "Distance from reference", distanceRamp, labels, 1,
+		fmt.Sprintf("Reference: %.4f, %.4f", ref.lat, ref.lon))
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
+
+// starPath returns SVG path data for a five pointed star of the given outer radius
+// centred on x, y
+func starPath(x, y, radius int) string {
+	var b bytes.Buffer
+	for i := 0; i < 10; i++ {
+		r := float64(radius)
+		if i%2 == 1 {
+			r *= 0.45
+		}
+		angle := float64(i)*math.Pi/5 - math.Pi/2
+		cmd := "L"
+		if i == 0 {
+			cmd = "M"
+		}
+		fmt.Fprintf(&b, "%s%.1f %.1f", cmd, float64(x)+r*math.Cos(angle), float64(y)+r*math.Sin(angle))
+	}
+	b.WriteString("Z")
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var distanceCircle = regexp.MustCompile(`<circle [^>]*style="fill:(#[0-9a-f]+);stroke:black" data-km="([\d.]+)"`)
+
+// drawDistances draws a distance map of coords from ref, returning its SVG
+func drawDistances(t *testing.T, coords, ref string, showRef bool) string {
+	t.Helper()
+	data := baseMapData("Aus bus", "distance", coords, defaultZone)
+	data.Reference, data.ShowReference = ref, showRef
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDistanceRampColours(t *testing.T) {
+	doc := drawDistances(t, "-42.89,147.33\n-41.5,146.3\n", "-42.88,147.32", true)
+	m := distanceCircle.FindAllStringSubmatch(doc, -1)
+	if len(m) != 2 {
+		t.Fatalf("%d points drawn, want 2", len(m))
+	}
+	if m[0][1] == m[1][1] {
+		t.Errorf("near (%s km) and far (%s km) points both drawn in %s", m[0][2], m[1][2], m[0][1])
+	}
+	if m[0][1] != distanceRamp[0] || m[1][1] != distanceRamp[len(distanceRamp)-1] {
+		t.Errorf("near point drawn in %s and far one in %s, want the ends of the ramp", m[0][1], m[1][1])
+	}
+	if !strings.Contains(doc, `<g id="reference">`) {
+		t.Error("reference on the map not marked")
+	}
+}
+
+func TestDistanceFromReferenceOffMap(t *testing.T) {
+	doc := drawDistances(t, "-42.89,147.33\n-41.5,146.3\n", "-37.81,144.96", true) // Melbourne
+	m := distanceCircle.FindAllStringSubmatch(doc, -1)
+	if len(m) != 2 || m[0][2] == "0.0" || m[1][2] == "0.0" {
+		t.Fatalf("distances from a reference off the map not worked out: %v", m)
+	}
+	if strings.Contains(doc, `<g id="reference">`) {
+		t.Error("reference off the map was drawn")
+	}
+}
+
+func TestGreatCircleKm(t *testing.T) {
+	tests := []struct {
+		lat1, lon1, lat2, lon2, want float64
+	}{
+		{-42.88, 147.33, -42.88, 147.33, 0},
+		{-42.88, 147.33, -41.43, 147.14, 162}, // Hobart to Launceston
+		{0, 0, 0, 180, math.Pi * earthRadiusKm},
+	}
+	for _, tt := range tests {
+		if got := greatCircleKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > 2 {
+			t.Errorf("greatCircleKm(%g, %g, %g, %g) = %.1f, want about %g", tt.lat1, tt.lon1, tt.lat2, tt.lon2, got, tt.want)
+		}
+	}
+}
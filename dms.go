@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dmsCoord matches a single coordinate in degrees, minutes and optional seconds with a
+// hemisphere letter, written with symbols such as 42°07'24"S or as plain text such as
+// 42 07 24 S
+const dmsCoord = `(\d{1,3})\s*[°º]?\s*(\d{1,2})\s*['′]?\s*(?:(\d{1,2}(?:\.\d+)?)\s*(?:"|″|'')?)?\s*([NSEWnsew])`
+
+// dmsSymbolLine matches a line holding two such coordinates, separated by spaces, commas
+// or a semicolon and optionally followed by a voucher status or bearing
+var dmsSymbolLine = regexp.MustCompile(`^\s*` + dmsCoord + `[\s,;]*` + dmsCoord + `(?:[\s,]+([av]|\d{1,3}(?:\.\d+)?))?\s*$`)
+
+// convertDMS rewrites every line of raw input written as degrees, minutes and seconds with
+// hemisphere letters into signed decimal degrees that the mapper can read. Other lines,
+// including decimal and comma separated degrees, minutes and seconds, are left as they are,
+// so lines that look like this but can't be converted are reported as unparseable later.
+func convertDMS(raw string) string {
+	if !strings.ContainsAny(raw, "NSEWnsew") { // Most input has no hemisphere letters at all
+		return raw
+	}
+	return mapLines(raw, func(line string) (string, bool) {
+		rest, focal := splitFocal(line)
+		if converted, ok := dmsToDecimalLine(rest); ok {
+			return markFocal(converted, focal), true
+		}
+		return line, true
+	})
+}
+
+// dmsToDecimalLine converts a single line of hemisphere-lettered degrees, minutes and
+// seconds into a "lat,lon" line in decimal degrees, keeping any trailing field
+func dmsToDecimalLine(line string) (string, bool) {
+	m := dmsSymbolLine.FindStringSubmatch(line)
+	if m == nil {
+		return line, false
+	}
+	first, ok1 := hemisphereDegrees(m[1], m[2], m[3], m[4])
+	second, ok2 := hemisphereDegrees(m[5], m[6], m[7], m[8])
+	if !ok1 || !ok2 {
+		return line, false
+	}
+
+	firstLat := strings.ContainsAny(m[4], "NSns")
+	secondLat := strings.ContainsAny(m[8], "NSns")
+	if firstLat == secondLat { // Both coordinates are latitudes, or both longitudes
+		return line, false
+	}
+	lat, lon := first, second
+	if !firstLat { // The longitude was given first
+		lat, lon = second, first
+	}
+
+	out := fmt.Sprintf("%.6f,%.6f", lat, lon)
+	if m[9] != "" {
+		out += "," + m[9]
+	}
+	return out, true
+}
+
+// hemisphereDegrees converts degrees, minutes and seconds fields to decimal degrees,
+// negative in the southern and western hemispheres. Minutes or seconds of 60 or more
+// can't be converted.
+func hemisphereDegrees(deg, min, sec, hemisphere string) (float64, bool) {
+	d, _ := strconv.ParseFloat(deg, 64)
+	m, _ := strconv.ParseFloat(min, 64)
+	s := parseFloat(sec)
+	if m >= 60 || s >= 60 {
+		return 0, false
+	}
+
+	dd := d + m/60 + s/3600
+	if strings.ContainsAny(hemisphere, "SWsw") {
+		dd = -dd
+	}
+	return dd, true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDMSToDecimalLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{`42°07'24"S 147°25'59"E`, "-42.123333,147.433056", true},
+		{"42 07 24 S 147 25 59 E", "-42.123333,147.433056", true},
+		{"147°25'59\"E, 42°07'24\"S", "-42.123333,147.433056", true}, // Longitude first
+		{"42°07'S 147°26'E,v", "-42.116667,147.433333,v", true},
+		{"42 07 24 N 147 25 59 W", "42.123333,-147.433056", true},
+		{"42°67'24\"S 147°25'59\"E", "", false}, // Minutes past 59
+		{"42°07'24\"S 43°25'59\"S", "", false},  // Two latitudes
+		{"42°07'S", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := dmsToDecimalLine(tt.line)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("dmsToDecimalLine(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestConvertDMSMixedLines(t *testing.T) {
+	raw := "-42.1,147.2\n42°07'24\"S 147°25'59\"E\n42°67'24\"S 147°25'59\"E\n"
+	want := "-42.1,147.2\n-42.123333,147.433056\n42°67'24\"S 147°25'59\"E"
+	if got := convertDMS(raw); got != want {
+		t.Errorf("convertDMS gave\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMalformedDMSReported(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"42°07'24\"S 147°25'59\"E\n42°67'24\"S 147°25'59\"E\n"},
+	})
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "line 2:") || !strings.Contains(rec.Body.String(), "could not be parsed") {
+		t.Errorf("malformed DMS line not reported, got %d", rec.Code)
+	}
+}
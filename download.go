@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// contentETag returns a strong entity tag for a response body, from a hash of its content
+func contentETag(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header names the entity tag, allowing for a
+// list of tags, weak tags and "*"
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDownload writes the body of a file download with its length and an entity tag, so
+// that browsers can show the progress of the download and check whether a copy they already
+// have is still current. A repeat request with a matching If-None-Match gets 304 Not
+// Modified without the body. Browsers are asked to check every time, as the maps expire.
+func writeDownload(w http.ResponseWriter, r *http.Request, body string) {
+	etag := contentETag(body)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if _, err := io.WriteString(w, body); err != nil { // Sent as it is, without a copy as bytes
+		errorLog.Printf("Error sending map: %s", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestDownloadHeaders(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2"},
+	})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no download link on the results page")
+	}
+	download := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/mapfile?id="+m[1]+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		dl := httptest.NewRecorder()
+		ms.mapAsFile(dl, req)
+		return dl
+	}
+
+	first := download("", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || len(etag) < 3 || etag[0] != '"' {
+		t.Fatalf("download gave %d with ETag %q", first.Code, etag)
+	}
+	if cl := first.Header().Get("Content-Length"); cl != strconv.Itoa(first.Body.Len()) {
+		t.Errorf("Content-Length %q for %d bytes", cl, first.Body.Len())
+	}
+	if cc := first.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Cache-Control %q", cc)
+	}
+	if again := download("", ""); again.Header().Get("ETag") != etag {
+		t.Error("the same map gave another ETag")
+	}
+	if pretty := download("&pretty=1", ""); pretty.Header().Get("ETag") == etag {
+		t.Error("the pretty map has the minified map's ETag")
+	}
+
+	for _, match := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+		if dl := download("", match); dl.Code != http.StatusNotModified || dl.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s gave %d with %d bytes", match, dl.Code, dl.Body.Len())
+		}
+	}
+	if dl := download("", `"other"`); dl.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match gave %d", dl.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// errorPage holds the details shown to the user on an error page
+type errorPage struct {
+	Status  int
+	Title   string
+	Message string
+}
+
+// errorMessages are the explanations shown for common error conditions when a handler
+// doesn't give a more specific one
+var errorMessages = map[int]string{
+	http.StatusBadRequest:            "The request could not be understood. Please check the data you entered and try again.",
+	http.StatusNotFound:              "The page or map you asked for could not be found.",
+	http.StatusRequestEntityTooLarge: "The data you sent is too large to be mapped.",
+	http.StatusInternalServerError:   "Something went wrong on the server while preparing your page.",
+}
+
+// serveError responds with a styled error page and the given HTTP status code. If message
+// is empty, the default message for the status is shown. Should the page templates
+// themselves be unusable, or fail to execute, it falls back to a plain text response.
+func serveError(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		message = errorMessages[status]
+	}
+	page := errorPage{Status: status, Title: http.StatusText(status), Message: message}
+
+	pages, err := loadTemplates()
+	if err != nil {
+		errorLog.Printf("Error parsing error page templates: %s", err)
+		plainError(w, page)
+		return
+	}
+	if err := pages.render(w, status, "error.html", pageLayout{Title: page.Title, Body: page}); err != nil {
+		plainError(w, page)
+	}
+}
+
+// plainError responds with an error page as plain text, built without any templates so
+// that something readable is sent even when the assets are missing or broken
+func plainError(w http.ResponseWriter, page errorPage) {
+	w.Header().Set("Cache-Control", "no-store") // The page is back to normal once the assets are fixed
+	http.Error(w, fmt.Sprintf("%d %s\n\n%s", page.Status, page.Title, page.Message), page.Status)
+}
+
+// writeError responds with an error in the form the client expects: a JSON envelope for
+// the API routes and for clients that ask for JSON, and the styled error page otherwise
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		if message == "" {
+			message = errorMessages[status]
+		}
+		writeAPI(w, status, apiResponse{Error: message})
+		return
+	}
+	serveError(w, status, message)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeErrorPages(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		want    string
+	}{
+		{http.StatusBadRequest, "", errorMessages[http.StatusBadRequest]},
+		{http.StatusNotFound, "", errorMessages[http.StatusNotFound]},
+		{http.StatusRequestEntityTooLarge, "", errorMessages[http.StatusRequestEntityTooLarge]},
+		{http.StatusInternalServerError, "", errorMessages[http.StatusInternalServerError]},
+		{http.StatusBadRequest, "The CSV file has no latitude column.", "The CSV file has no latitude column."},
+		{http.StatusBadRequest, "Bad <input> & more", "Bad &lt;input&gt; &amp; more"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		serveError(rec, tt.status, tt.message)
+		body := rec.Body.String()
+		if rec.Code != tt.status {
+			t.Errorf("status %d page sent with %d", tt.status, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("status %d page has content type %q", tt.status, ct)
+		}
+		for _, part := range []string{`class="error-page"`, http.StatusText(tt.status), tt.want, "</html>"} {
+			if !strings.Contains(body, part) {
+				t.Errorf("status %d page is missing %q", tt.status, part)
+			}
+		}
+	}
+}
+
+func TestErrorConditions(t *testing.T) {
+	ms := newMapStore()
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		method string
+		target string
+		status int
+	}{
+		{"unknown path", ms.dataEntry, "GET", "/nosuch", http.StatusNotFound},
+		{"form posted to", ms.dataEntry, "POST", "/", http.StatusMethodNotAllowed},
+		{"expired map", ms.mapAsFile, "GET", "/mapfile?id=gone", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s gave %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if !strings.Contains(rec.Body.String(), `class="error-page"`) {
+			t.Errorf("%s didn't get the styled error page", tt.name)
+		}
+	}
+}
+
+func TestWriteErrorJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, httptest.NewRequest("POST", "/api/map", nil), http.StatusBadRequest, "bad")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"error":"bad"`) {
+		t.Errorf("API error gave %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	ms, us := newMapStore(), newUploadStore()
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		method string
+		target string
+		body   string
+		status int
+		json   bool
+	}{
+		{"API map with GET", apiMap, "GET", "/api/map", "", http.StatusMethodNotAllowed, true},
+		{"API unknown map type", apiMap, "POST", "/api/map", `{"coordinates":"-42.1,147.2","maptype":"nosuch"}`, http.StatusBadRequest, true},
+		{"API bad coordinates", apiMap, "POST", "/api/map", `{"coordinates":"garbage"}`, http.StatusBadRequest, true},
+		{"API unreadable JSON", apiMap, "POST", "/api/map", `{"coordinates":`, http.StatusBadRequest, true},
+		{"API expired records", ms.apiGeoJSON, "GET", "/api/geojson?id=gone", "", http.StatusNotFound, true},
+		{"API records with PUT", ms.apiGeoJSON, "PUT", "/api/geojson", "", http.StatusMethodNotAllowed, true},
+		{"expired map", ms.mapAsFile, "GET", "/mapfile?id=gone", "", http.StatusNotFound, false},
+		{"bad upload id", us.uploadChunk, "GET", "/upload?id=../x", "", http.StatusBadRequest, false},
+		{"unknown upload", us.uploadChunk, "GET", "/upload?id=0123456789abcdef01234567", "", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		for _, accept := range []string{"", "application/json"} {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			rec := httptest.NewRecorder()
+			tt.h(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("%s gave %d, want %d", tt.name, rec.Code, tt.status)
+			}
+
+			wantJSON := tt.json || accept != ""
+			var resp apiResponse
+			if ct := rec.Header().Get("Content-Type"); wantJSON != strings.HasPrefix(ct, "application/json") {
+				t.Errorf("%s (Accept %q) sent as %q", tt.name, accept, ct)
+			} else if wantJSON && (json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Error == "") {
+				t.Errorf("%s (Accept %q) has no error in %q", tt.name, accept, rec.Body)
+			}
+		}
+	}
+
+	rec := postForm(ms.mapDisplay, "/map", url.Values{"maptype": {"nosuch"}, "coordinates": {"-42.1,147.2"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown map type from the form gave %d, want 400", rec.Code)
+	}
+}
+
+func TestErrorWithoutTemplates(t *testing.T) {
+	tests := []struct {
+		name, file, contents string // A template broken in the assets directory, or removed if contents is ""
+	}{
+		{"layout missing", "layout.html", ""},
+		{"head missing", "head.html", ""},
+		{"head unparsable", "head.html", "<title>{{ .Title"},
+		{"error page unusable", "error.html", "{{ .NoSuchField }}"},
+	}
+	ms := newMapStore()
+	defer func() { assetsDir = "" }()
+	for _, tt := range tests {
+		assetsDir = copyAssets(t)
+		file := filepath.Join(assetsDir, tt.file)
+		if tt.contents == "" {
+			os.Remove(file)
+		} else {
+			os.WriteFile(file, []byte(tt.contents), 0o644)
+		}
+
+		notFound := httptest.NewRecorder()
+		ms.dataEntry(notFound, httptest.NewRequest("GET", "/nosuch", nil))
+		responses := map[*httptest.ResponseRecorder]int{notFound: http.StatusNotFound}
+		if tt.file != "error.html" { // Otherwise only the error page itself can't be drawn
+			form := httptest.NewRecorder()
+			ms.dataEntry(form, httptest.NewRequest("GET", "/", nil))
+			responses[form] = http.StatusInternalServerError
+			responses[postForm(ms.mapDisplay, "/map", url.Values{"maptype": {"plain"}, "coordinates": {"-42.1,147.2"}})] = http.StatusInternalServerError
+		}
+		for rec, status := range responses {
+			want := fmt.Sprintf("%d %s\n\n%s\n", status, http.StatusText(status), errorMessages[status])
+			if rec.Code != status || rec.Body.String() != want ||
+				!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") || rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("%s: got %d as %q with %.80q, want %q", tt.name, rec.Code, rec.Header().Get("Content-Type"), rec.Body, want)
+			}
+		}
+	}
+}
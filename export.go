@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// exportFileName returns the name the records for a taxon are downloaded as, with the
+// given extension
+func exportFileName(taxon, ext string) string {
+	return strings.TrimSuffix(mapFileName(taxon, "records"), ".svg") + "." + ext
+}
+
+// exportRecords returns the records a request to one of the export routes asks for, with
+// the unescaped taxon and the decimal places localities are told apart to. "?id=" gives the
+// records of a map already generated, as linked from the results page, while a POST with
+// the same JSON body as "/api/map" parses new records. If the records can't be had the
+// error is written and ok is false.
+//
+// Coordinates are exported as they were given, with every digit of the input rather than
+// at the precision of the map, unless "?decimals=" or "decimals" in the body asks for
+// fewer decimal places, for databases that only take so many. Every export format is
+// rounded the same way.
+func (ms *mapStore) exportRecords(w http.ResponseWriter, r *http.Request) (records []record, taxon string, places int, ok bool) {
+	var decimals int
+	switch r.Method {
+	case "GET":
+		svm, found := ms.get(r.FormValue("id"))
+		if !found {
+			writeError(w, r, http.StatusNotFound, "there is no map in memory with that id")
+			return nil, "", 0, false
+		}
+		records, taxon, places = svm.records, svm.taxon, svm.places
+		decimals = parseDecimals(r.FormValue("decimals"))
+	case "POST":
+		var req apiRequest
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPI(w, http.StatusBadRequest, apiResponse{Error: "the request body is not valid JSON: " + err.Error()})
+			return nil, "", 0, false
+		}
+		data := baseMapData(req.Taxon, "", req.Coordinates, parseZone(strconv.Itoa(req.Zone)))
+		data.Precision = parsePrecision(strconv.Itoa(req.Precision))
+		ctx, cancel := renderContext(r)
+		defer cancel()
+		p := parseMapData(ctx, data)
+		if p.err != nil {
+			writeAPI(w, renderStatus(p.err), apiResponse{Error: p.err.Error(), Warnings: unescapeAll(data.Warnings)})
+			return nil, "", 0, false
+		}
+		records, taxon, places = p.records, data.TaxonName, defaultDedupePlaces
+		decimals = parseDecimals(strconv.Itoa(req.Decimals))
+		if len(records) == 0 {
+			writeAPI(w, http.StatusBadRequest, apiResponse{Error: "None of the data can be mapped", Warnings: unescapeAll(data.Warnings)})
+			return nil, "", 0, false
+		}
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "records must be requested with GET or POST")
+		return nil, "", 0, false
+	}
+	records = append([]record(nil), records...) // The map's own records are left as they are
+	if decimals > 0 {
+		roundRecords(records, decimals)
+		if decimals < places { // Localities can't be told apart more finely than they are given
+			places = decimals
+		}
+	} else {
+		for i := range records {
+			records[i].lat, records[i].lon = records[i].given()
+		}
+	}
+	return records, html.UnescapeString(taxon), places, true
+}
+
+// apiCSV handles "/api/csv", which serves the cleaned records of a map as CSV with a row
+// for each locality, as drawn after rounding and with duplicates merged. Voucher status is
+// given as v or a, and left empty if the data didn't give it.
+func (ms *mapStore) apiCSV(w http.ResponseWriter, r *http.Request) {
+	records, taxon, places, ok := ms.exportRecords(w, r)
+	if !ok {
+		return
+	}
+	localities, _ := dedupeRecords(records, places)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	setAttachment(w, exportFileName(taxon, "csv"))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"latitude", "longitude", "voucher", "count"})
+	for _, rec := range localities {
+		voucher := ""
+		if rec.hasVoucher && rec.voucher {
+			voucher = "v"
+		} else if rec.hasVoucher {
+			voucher = "a"
+		}
+		cw.Write([]string{strconv.FormatFloat(rec.lat, 'f', -1, 64), strconv.FormatFloat(rec.lon, 'f', -1, 64),
+			voucher, strconv.Itoa(rec.weight())})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		errorLog.Printf("Error writing CSV: %s", err)
+	}
+}
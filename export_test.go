@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// exportCoords picks out the coordinates in each export format
+var exportCoords = map[string]*regexp.Regexp{
+	"csv":     regexp.MustCompile(`(?m)^(-?[\d.]+),(-?[\d.]+),`),
+	"geojson": regexp.MustCompile(`"coordinates":\[(-?[\d.]+),(-?[\d.]+)\]`),
+	"kml":     regexp.MustCompile(`<coordinates>(-?[\d.]+),(-?[\d.]+),0</coordinates>`),
+}
+
+// exportHandlers are the export routes of a map store by format
+func exportHandlers(ms *mapStore) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{"csv": ms.apiCSV, "geojson": ms.apiGeoJSON, "kml": ms.apiKML}
+}
+
+// exported returns the coordinates found in an export, in the order given
+func exported(t *testing.T, format, body string) (values []string) {
+	t.Helper()
+	for _, m := range exportCoords[format].FindAllStringSubmatch(body, -1) {
+		values = append(values, m[1], m[2])
+	}
+	if len(values) == 0 {
+		t.Fatalf("no coordinates in the %s export:\n%s", format, body)
+	}
+	return values
+}
+
+func TestExportDecimals(t *testing.T) {
+	ms := newMapStore()
+	const coords = `"-42.123456,146.987654\n-41.5,147.25"`
+	for format, h := range exportHandlers(ms) {
+		rec := postJSON(h, "/api/"+format, `{"coordinates":`+coords+`,"decimals":4}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s export gave %d: %s", format, rec.Code, rec.Body)
+		}
+		values := exported(t, format, rec.Body.String())
+		for _, want := range []string{"-42.1235", "146.9877", "-41.5", "147.25"} {
+			if !contains(values, want) {
+				t.Errorf("%s export %v is missing %s", format, values, want)
+			}
+		}
+		for _, v := range values {
+			if i := strings.Index(v, "."); i >= 0 && len(v)-i-1 > 4 {
+				t.Errorf("%s export has %s, with more than 4 decimal places", format, v)
+			}
+		}
+
+		// Left out, the coordinates are exported with every digit they were given
+		rec = postJSON(h, "/api/"+format, `{"coordinates":`+coords+`}`)
+		values = exported(t, format, rec.Body.String())
+		for _, want := range []string{"-42.123456", "146.987654", "-41.5", "147.25"} {
+			if !contains(values, want) {
+				t.Errorf("%s export without decimals gave %v, want the given %s", format, values, want)
+			}
+		}
+	}
+}
+
+func TestExportDecimalsOfStoredMap(t *testing.T) {
+	ms := newMapStore()
+	records := parseRecords("-42.123456,146.987654\n")
+	id := ms.add(&svgMap{mapName: "map.plain.svg", records: records, places: defaultDedupePlaces})
+	for format, h := range exportHandlers(ms) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/api/"+format+"?id="+id+"&decimals=4", nil))
+		if values := exported(t, format, rec.Body.String()); !contains(values, "-42.1235") {
+			t.Errorf("%s export of a stored map gave %v, want -42.1235", format, values)
+		}
+	}
+	if records[0].lat != -42.123456 {
+		t.Errorf("exporting rounded the map's own records, to %g", records[0].lat)
+	}
+
+	// A map rounds its records, but they are exported as they were given
+	roundRecords(records, coordPrecision)
+	for format, h := range exportHandlers(ms) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/api/"+format+"?id="+id, nil))
+		values := exported(t, format, rec.Body.String())
+		if !contains(values, "-42.123456") || !contains(values, "146.987654") {
+			t.Errorf("%s export of a stored map without decimals gave %v, want -42.123456 and 146.987654", format, values)
+		}
+	}
+}
+
+// contains reports whether values holds s
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCSVExport(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "taxon": {"Aus bus"},
+		"coordinates": {"-42.1,147.2,1\n-42.1,147.2,0\n-41.5,146.5,0\n-41.2,146.1,1\n-41.2,146.1,1"},
+	})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no map drawn")
+	}
+	dl := httptest.NewRecorder()
+	ms.apiCSV(dl, httptest.NewRequest("GET", "/api/csv?id="+m[1], nil))
+	if ct, cd := dl.Header().Get("Content-Type"), dl.Header().Get("Content-Disposition"); !strings.HasPrefix(ct, "text/csv") ||
+		!strings.Contains(cd, "aus-bus.records.csv") {
+		t.Errorf("CSV sent as %q named %q", ct, cd)
+	}
+
+	rows, err := csv.NewReader(dl.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"latitude", "longitude", "voucher", "count"},
+		{"-42.1", "147.2", "v", "2"}, // Merged with the observation at the same place
+		{"-41.5", "146.5", "a", "1"},
+		{"-41.2", "146.1", "v", "2"},
+	}
+	svm, _ := ms.get(m[1])
+	if localities := distinctLocalities(svm.records, svm.places); len(rows)-1 != localities || len(rows) != len(want) {
+		t.Fatalf("got rows %q, want one for each of %d localities", rows, localities)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d is %q, want %q", i, rows[i], want[i])
+		}
+	}
+
+	if rows := postJSON(ms.apiCSV, "/api/csv", `{"coordinates":"-42.1,147.2\n-41.5,146.5"}`).Body.String(); !strings.Contains(rows, "-42.1,147.2,,1\n") {
+		t.Errorf("records without voucher status exported as %q", rows)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// safeFileName turns a taxon name into the start of a file name, lower case with hyphens
+// for spaces. Letters, including accented ones, digits, dots and underscores are kept and
+// anything else that could break a path or a header, such as slashes, quotes and newlines,
+// becomes a hyphen. A name with nothing left in it gives "map".
+func safeFileName(taxon string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(html.UnescapeString(taxon)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '.' || c == '_':
+			b.WriteRune(c)
+		case !strings.HasSuffix(b.String(), "-"): // Runs of unsafe characters give one hyphen
+			b.WriteByte('-')
+		}
+	}
+	if name := strings.Trim(b.String(), "-."); name != "" {
+		return name
+	}
+	return "map"
+}
+
+// setAttachment has a response downloaded as a file with the given name, which must have
+// been made safe already. Names with characters outside ASCII are also given in the RFC 5987
+// form, with an ASCII fallback for older browsers.
+func setAttachment(w http.ResponseWriter, name string) {
+	value := fmt.Sprintf(`attachment; filename="%s"`, asciiName(name))
+	if asciiName(name) != name {
+		value += "; filename*=UTF-8''" + encodeExtValue(name)
+	}
+	w.Header().Set("Content-Disposition", value)
+}
+
+// asciiName replaces the characters of a file name outside ASCII with underscores
+func asciiName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c > unicode.MaxASCII {
+			return '_'
+		}
+		return c
+	}, name)
+}
+
+// encodeExtValue percent-encodes the UTF-8 bytes of a value for an RFC 5987 parameter,
+// leaving only the characters it allows unencoded
+func encodeExtValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.IndexByte("!#$&+-.^_`|~", c) >= 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
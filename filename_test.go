@@ -0,0 +1,79 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		taxon, want string
+	}{
+		{"Aus bus", "aus-bus"},
+		{"Aus/bus\\cus", "aus-bus-cus"},
+		{`Aus "bus"`, "aus-bus"},
+		{"Aus bus\r\nContent-Type: text/html", "aus-bus-content-type-text-html"},
+		{"Épacris lanuginosa", "épacris-lanuginosa"},
+		{"Aus &amp; bus", "aus-bus"}, // Escaped by the form
+		{"../../etc/passwd", "etc-passwd"},
+		{"", "map"},
+		{`/"\`, "map"},
+	}
+	for _, tt := range tests {
+		if got := safeFileName(tt.taxon); got != tt.want {
+			t.Errorf("safeFileName(%q) = %q, want %q", tt.taxon, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentHeader(t *testing.T) {
+	for _, tt := range []struct {
+		taxon, ascii, unicode string
+	}{
+		{"Aus bus", "aus-bus.plain.svg", ""},
+		{"Épacris \"lanuginosa\"/x", "_pacris-lanuginosa-x.plain.svg", "épacris-lanuginosa-x.plain.svg"},
+	} {
+		rec := httptest.NewRecorder()
+		setAttachment(rec, mapFileName(tt.taxon, "plain"))
+		cd := rec.Header().Get("Content-Disposition")
+		disposition, params, err := mime.ParseMediaType(cd)
+		if err != nil || disposition != "attachment" {
+			t.Errorf("%s: header %q does not parse (%v)", tt.taxon, cd, err)
+			continue
+		}
+		// mime gives the RFC 5987 name over the plain one where there is one
+		want := tt.ascii
+		if tt.unicode != "" {
+			want = tt.unicode
+			if !strings.Contains(cd, `filename="`+tt.ascii+`"`) {
+				t.Errorf("%s: no ASCII fallback in %q", tt.taxon, cd)
+			}
+		}
+		if params["filename"] != want {
+			t.Errorf("%s: downloaded as %q, want %q", tt.taxon, params["filename"], want)
+		}
+	}
+}
+
+func TestDownloadNameFromForm(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "taxon": {"Aus\"/bus\nX-Injected: 1"}, "coordinates": {"-42.1,147.2"},
+	})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no download link on the results page")
+	}
+	dl := httptest.NewRecorder()
+	ms.mapAsFile(dl, httptest.NewRequest("GET", "/mapfile?id="+m[1], nil))
+	if cd := dl.Header().Get("Content-Disposition"); cd != `attachment; filename="aus-bus-x-injected-1.plain.svg"` {
+		t.Errorf("downloaded with %q", cd)
+	}
+	if dl.Code != http.StatusOK || dl.Header().Get("X-Injected") != "" {
+		t.Errorf("download gave %d with headers %v", dl.Code, dl.Header())
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const fitPadding = 25 // Space in pixels left around the data when no margin is given
+
+// minFitKm is the smallest width or height in km framed when fitting a map to its data, so
+// that a single point or a tight cluster is shown with enough of the land around it to be
+// placed. It is set by -minfitkm.
+var minFitKm = 20.0
+
+// boundingBox returns the smallest and largest latitude and longitude of the records
+func boundingBox(records []record) (minLat, minLon, maxLat, maxLon float64) {
+	minLat, minLon = math.Inf(1), math.Inf(1)
+	maxLat, maxLon = math.Inf(-1), math.Inf(-1)
+	for _, rec := range records {
+		minLat, maxLat = math.Min(minLat, rec.lat), math.Max(maxLat, rec.lat)
+		minLon, maxLon = math.Min(minLon, rec.lon), math.Max(maxLon, rec.lon)
+	}
+	return minLat, minLon, maxLat, maxLon
+}
+
+// fitToData narrows the viewBox of a map to frame its records with margin pixels around
+// them. The frame is worked out from where the records are drawn rather than from their
+// bounding box, because records on King Island are drawn away from their true position.
+// A single point or a tight cluster is framed at no less than minFitKm across.
+func fitToData(reg *baseRegion, doc string, records []record, margin float64) string {
+	if len(records) == 0 {
+		return doc
+	}
+	minLat, minLon, maxLat, maxLon := boundingBox(records)
+	debugf("Fitting map to records from %.4f,%.4f to %.4f,%.4f", minLat, minLon, maxLat, maxLon)
+
+	left, top := math.Inf(1), math.Inf(1)
+	right, bottom := math.Inf(-1), math.Inf(-1)
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		left, right = math.Min(left, float64(x)), math.Max(right, float64(x))
+		top, bottom = math.Min(top, float64(y)), math.Max(bottom, float64(y))
+	}
+	return frameViewBox(doc, left, top, right, bottom, margin)
+}
+
+// frameViewBox sets the viewBox of a map to frame the area from left,top to right,bottom
+// with margin pixels around it, or fitPadding if no margin is given. An area narrower than
+// minFitKm is widened to it, and the area is never wider or taller than the whole state, so
+// the map is neither zoomed in until the coastline means nothing nor zoomed out past the
+// full map.
+func frameViewBox(doc string, left, top, right, bottom, margin float64) string {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return doc
+	}
+	if margin <= 0 {
+		margin = fitPadding
+	}
+	left, right = guardExtent(left, right, canvasWidth)
+	top, bottom = guardExtent(top, bottom, canvasHeight)
+
+	viewBox := fmt.Sprintf(`viewBox="%g %g %g %g"`, left-margin, top-margin, right-left+2*margin, bottom-top+2*margin)
+	return strings.Replace(doc, m[0], viewBox, 1)
+}
+
+// guardExtent widens the span from low to high about its centre to at least minFitKm, and
+// narrows it to the full size of the canvas it is on if it is larger
+func guardExtent(low, high, full float64) (float64, float64) {
+	minSpan := math.Min(minFitKm*1000/pixelSize, full)
+	if span := high - low; span < minSpan {
+		low, high = low-(minSpan-span)/2, high+(minSpan-span)/2
+	}
+	if high-low > full {
+		low, high = 0, full
+	}
+	return low, high
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// fittedViewBox fits a bare map to the records of coords with no margin given, returning
+// its viewBox
+func fittedViewBox(t *testing.T, coords string) (x, y, w, h float64) {
+	t.Helper()
+	doc := fitToData(tasmania, `<svg viewBox="0 0 910 1260">`, parseRecords(coords), 0)
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatalf("no viewBox in %q", doc)
+	}
+	v := make([]float64, 4)
+	for i := range v {
+		v[i], _ = strconv.ParseFloat(m[i+1], 64)
+	}
+	return v[0], v[1], v[2], v[3]
+}
+
+func TestFitSinglePoint(t *testing.T) {
+	minSpan := minFitKm * 1000 / pixelSize
+	x, y, w, h := fittedViewBox(t, "-42.0,146.5\n")
+	if w != minSpan+2*fitPadding || h != minSpan+2*fitPadding {
+		t.Errorf("single point framed %gx%g, want %g km and the padding each way", w, h, minFitKm)
+	}
+	px, py := tasmania.project(-42.0, 146.5)
+	if cx, cy := x+w/2, y+h/2; cx != float64(px) || cy != float64(py) {
+		t.Errorf("frame centred on %g,%g, want the point at %d,%d", cx, cy, px, py)
+	}
+}
+
+func TestFitTwoNearPoints(t *testing.T) {
+	minSpan := minFitKm * 1000 / pixelSize
+	_, _, w, h := fittedViewBox(t, "-42.88000,147.33000\n-42.88001,147.33001\n")
+	if w != minSpan+2*fitPadding || h != minSpan+2*fitPadding {
+		t.Errorf("two near points framed %gx%g, want %g km and the padding each way", w, h, minFitKm)
+	}
+
+	defer func(km float64) { minFitKm = km }(minFitKm)
+	minFitKm = 100
+	if _, _, w, _ := fittedViewBox(t, "-42.88000,147.33000\n-42.88001,147.33001\n"); w != 250+2*fitPadding {
+		t.Errorf("with -minfitkm 100 two near points framed %g wide, want 100 km and the padding", w)
+	}
+}
+
+func TestFitNeverPastWholeState(t *testing.T) {
+	defer func(km float64) { minFitKm = km }(minFitKm)
+	minFitKm = 1000 // Far more than the state
+
+	_, _, w, h := fittedViewBox(t, "-42.0,146.5\n")
+	if w != canvasWidth+2*fitPadding || h != canvasHeight+2*fitPadding {
+		t.Errorf("frame of %gx%g is bigger than the whole state", w, h)
+	}
+}
+
+func TestGuardExtent(t *testing.T) {
+	minSpan := minFitKm * 1000 / pixelSize
+	tests := []struct{ low, high, wantLow, wantHigh float64 }{
+		{100, 100, 100 - minSpan/2, 100 + minSpan/2},
+		{100, 400, 100, 400},
+		{-50, 1000, 0, canvasWidth},
+	}
+	for _, tt := range tests {
+		low, high := guardExtent(tt.low, tt.high, canvasWidth)
+		if math.Abs(low-tt.wantLow) > 1e-9 || math.Abs(high-tt.wantHigh) > 1e-9 {
+			t.Errorf("guardExtent(%g, %g) = %g, %g, want %g, %g", tt.low, tt.high, low, high, tt.wantLow, tt.wantHigh)
+		}
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	minLat, minLon, maxLat, maxLon := boundingBox(parseRecords("-42.1,147.2\n-41.5,146.5\n-43.2,145.9\n"))
+	if minLat != -43.2 || minLon != 145.9 || maxLat != -41.5 || maxLon != 147.2 {
+		t.Errorf("got %g,%g to %g,%g", minLat, minLon, maxLat, maxLon)
+	}
+	minLat, minLon, maxLat, maxLon = boundingBox(parseRecords("-42.1,147.2\n-42.1,147.2\n"))
+	if minLat != maxLat || minLon != maxLon || minLat != -42.1 || minLon != 147.2 {
+		t.Errorf("identical points gave %g,%g to %g,%g", minLat, minLon, maxLat, maxLon)
+	}
+}
+
+func TestFitNarrowsViewBox(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.88,147.33\n-42.80,147.50\n", defaultZone)
+	data.FitToData = true
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	w, _ := strconv.ParseFloat(m[3], 64)
+	h, _ := strconv.ParseFloat(m[4], 64)
+	if w >= canvasWidth/4 || h >= canvasHeight/4 {
+		t.Errorf("map fitted to two records near Hobart shows %gx%g", w, h)
+	}
+}
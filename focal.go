@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// focalPrefix starts the input line of a record to be highlighted on the map, such as the
+// type specimen
+const focalPrefix = "*"
+
+const focalWarning = "Only the first record marked with * is highlighted"
+
+// splitFocal separates the mark of a focal record from the start of a line of input
+func splitFocal(line string) (rest string, focal bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, focalPrefix) {
+		return line, false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(trimmed, focalPrefix)), true
+}
+
+// markFocal puts back the mark of a focal record on a line that has been rewritten
+func markFocal(line string, focal bool) string {
+	if focal {
+		return focalPrefix + line
+	}
+	return line
+}
+
+// singleFocal keeps the first record marked as focal and unmarks the rest, as only one
+// record is highlighted. It returns a warning if there were others.
+func singleFocal(records []record) (warning string) {
+	found := false
+	for i := range records {
+		if !records[i].focal {
+			continue
+		}
+		if found {
+			records[i].focal = false
+			warning = focalWarning
+		}
+		found = true
+	}
+	return warning
+}
+
+// focalMarker draws a star, larger than the markers of m and filled in the focal colour of
+// t, over the focal record of a map so that it stands out from the records around it. Maps
+// without one get nothing.
+func focalMarker(reg *baseRegion, records []record, m markerStyle, t mapTheme) string {
+	for _, rec := range records {
+		if !rec.focal {
+			continue
+		}
+		x, y := reg.project(rec.lat, rec.lon)
+		outer := 2.2 * float64(m.radius)
+		inner := outer * 0.45
+
+		points := make([]string, 10)
+		for i := range points {
+			r := outer
+			if i%2 == 1 {
+				r = inner
+			}
+			a := math.Pi * float64(i) / 5 // Points every 36°, starting at the top
+			points[i] = fmt.Sprintf("%.1f,%.1f", float64(x)+r*math.Sin(a), float64(y)-r*math.Cos(a))
+		}
+
+		buf := new(bytes.Buffer)
+		fmt.Fprintln(buf, `<g id="focal">`)
+		fmt.Fprintf(buf, "<polygon points=\"%s\" style=\"fill:%s;stroke:%s;stroke-width:2\" />\n",
+			strings.Join(points, " "), t.focal, m.colour)
+		fmt.Fprintln(buf, "</g>")
+		return buf.String()
+	}
+	return ""
+}
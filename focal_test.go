@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFocalRecordHighlighted(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "*-42.1,147.2\n-41.5,146.5\n* -41.8,145.9", defaultZone)
+	doc, records, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(doc, `<g id="focal">`); n != 1 || strings.Count(doc, "<polygon") != 1 {
+		t.Fatalf("%d focal groups drawn", n)
+	}
+	if strings.Index(doc, `<g id="focal">`) < strings.Index(doc, `<g id="dots">`) {
+		t.Error("focal record drawn beneath the others")
+	}
+	if !strings.Contains(strings.Join(data.Warnings, "\n"), focalWarning) {
+		t.Errorf("second focal record not reported, got %q", data.Warnings)
+	}
+
+	// The star's top point is above the first record marked
+	var focal []record
+	for _, rec := range records {
+		if rec.focal {
+			focal = append(focal, rec)
+		}
+	}
+	if len(focal) != 1 || focal[0].lat != -42.1 {
+		t.Fatalf("focal records %+v", focal)
+	}
+	x, y := tasmania.project(focal[0].lat, focal[0].lon)
+	top := fmt.Sprintf(`points="%.1f,%.1f `, float64(x), float64(y)-2.2*float64(markerRadius))
+	if !strings.Contains(doc, top) {
+		t.Errorf("star not centred on the focal record at %d,%d", x, y)
+	}
+}
+
+func TestNoFocalRecord(t *testing.T) {
+	doc, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "plain", "-42.1,147.2\n-41.5,146.5", defaultZone))
+	if err != nil || strings.Contains(doc, `id="focal"`) {
+		t.Errorf("map without a focal record got a star (%v)", err)
+	}
+	for _, tt := range []struct {
+		line, rest string
+		focal      bool
+	}{
+		{"*-42.1,147.2", "-42.1,147.2", true},
+		{"  * -42.1,147.2 ", "-42.1,147.2", true},
+		{"-42.1,147.2", "-42.1,147.2", false},
+	} {
+		if rest, focal := splitFocal(tt.line); rest != tt.rest || focal != tt.focal {
+			t.Errorf("splitFocal(%q) = %q, %v", tt.line, rest, focal)
+		}
+	}
+}
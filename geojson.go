@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// geoJSON types for a collection of point records
+type (
+	featureCollection struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}
+	feature struct {
+		Type       string                 `json:"type"`
+		Geometry   point                  `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	point struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"` // Longitude then latitude, as GeoJSON requires
+	}
+)
+
+// recordsGeoJSON converts records to a GeoJSON feature collection with one point each,
+// with the taxon and any voucher status, bearing, source, merged count, category and link
+// as properties
+func recordsGeoJSON(records []record, taxon string) featureCollection {
+	fc := featureCollection{Type: "FeatureCollection", Features: make([]feature, 0, len(records))}
+	for _, rec := range records {
+		props := map[string]interface{}{"taxon": taxon}
+		if rec.taxon != "" { // Data with several taxa names each record's own
+			props["taxon"] = rec.taxon
+		}
+		if rec.hasVoucher {
+			props["vouchered"] = rec.voucher
+		}
+		if rec.hasBearing && !rec.hasVoucher {
+			props["bearing"] = rec.bearing
+		}
+		if rec.count > 1 {
+			props["count"] = rec.count
+		}
+		if rec.source != "" {
+			props["source"] = rec.source
+		}
+		if rec.category != "" {
+			props["category"] = rec.category
+		}
+		if rec.year != 0 {
+			props["year"] = rec.year
+		}
+		if rec.url != "" {
+			props["url"] = rec.url
+		}
+		fc.Features = append(fc.Features, feature{
+			Type:       "Feature",
+			Geometry:   point{Type: "Point", Coordinates: [2]float64{rec.lon, rec.lat}},
+			Properties: props,
+		})
+	}
+	return fc
+}
+
+// apiGeoJSON handles "/api/geojson", which serves the records of a map as GeoJSON for use
+// in GIS tools, given either the id of a map or new records as for the other exports
+func (ms *mapStore) apiGeoJSON(w http.ResponseWriter, r *http.Request) {
+	records, taxon, _, ok := ms.exportRecords(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	setAttachment(w, exportFileName(taxon, "geojson"))
+	if err := json.NewEncoder(w).Encode(recordsGeoJSON(records, taxon)); err != nil {
+		errorLog.Printf("Error writing GeoJSON: %s", err)
+	}
+}
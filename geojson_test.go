@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGeoJSONExport(t *testing.T) {
+	rec := postJSON(newMapStore().apiGeoJSON, "/api/geojson", `{"taxon": "Aus bus", "coordinates": "-42.1,147.2,1\n-41.5,146.5,0"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("got %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="aus-bus.records.geojson"`) {
+		t.Errorf("downloaded as %q", cd)
+	}
+
+	var fc struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("got a %s of %d features", fc.Type, len(fc.Features))
+	}
+	for i, want := range []struct {
+		lon, lat  float64
+		vouchered bool
+	}{{147.2, -42.1, true}, {146.5, -41.5, false}} {
+		f := fc.Features[i]
+		if f.Type != "Feature" || f.Geometry.Type != "Point" || len(f.Geometry.Coordinates) != 2 ||
+			f.Geometry.Coordinates[0] != want.lon || f.Geometry.Coordinates[1] != want.lat {
+			t.Errorf("feature %d is a %s %s at %v", i, f.Type, f.Geometry.Type, f.Geometry.Coordinates)
+		}
+		if f.Properties["taxon"] != "Aus bus" || f.Properties["vouchered"] != want.vouchered {
+			t.Errorf("feature %d has properties %v", i, f.Properties)
+		}
+	}
+}
+
+func TestGeoJSONOfStoredMap(t *testing.T) {
+	ms := newMapStore()
+	page := postForm(ms.mapDisplay, "/map", url.Values{"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2"}})
+	m := mapfileLink.FindStringSubmatch(page.Body.String())
+	if m == nil || !strings.Contains(page.Body.String(), `href="/api/geojson?id=`+m[1]+`"`) {
+		t.Fatal("no GeoJSON link on the results page")
+	}
+	rec := httptest.NewRecorder()
+	ms.apiGeoJSON(rec, httptest.NewRequest("GET", "/api/geojson?id="+m[1], nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"coordinates":[147.2,-42.1]`) {
+		t.Errorf("stored map's records not exported, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ms.apiGeoJSON(rec, httptest.NewRequest("GET", "/api/geojson?id=missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown map gave %d", rec.Code)
+	}
+	if rec := postJSON(ms.apiGeoJSON, "/api/geojson", `{"coordinates": "garbage"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("data that can't be mapped gave %d", rec.Code)
+	}
+}
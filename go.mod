@@ -1,5 +1,9 @@
 module mapserver
 
-go 1.14
+go 1.16
 
-require github.com/kurankat/tasmapper v0.1.1-alpha
+require (
+	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b
+	github.com/kurankat/tasmapper v0.1.1-alpha
+	github.com/kurankat/tasutm v0.0.0-20211023051438-7b8595c4d78b
+)
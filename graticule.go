@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+const (
+	defaultGraticuleStep = 1.0  // Degrees between the lines of a graticule unless another interval is asked for
+	minGraticuleStep     = 0.25 // Smallest interval in degrees, keeping the lines apart at the map's scale
+	maxGraticuleStep     = 5.0  // Largest interval in degrees
+	graticuleSample      = 0.05 // Degrees between the points each line is drawn through, as lines curve slightly
+)
+
+const graticuleStyle = "fill:none;stroke:%s;stroke-width:1;stroke-opacity:0.5"
+
+// graticuleReserved are the areas of the canvas, as left, top, right and bottom, that the
+// legends, scale bar and north arrow are drawn in, which graticule labels are kept out of
+var graticuleReserved = [][4]int{
+	{0, 920, 420, canvasHeight},                                        // Legends and the scale bar
+	{canvasWidth - 110, canvasHeight - 190, canvasWidth, canvasHeight}, // North arrow
+}
+
+// parseGraticuleStep reads the interval in degrees between graticule lines, limited to
+// between minGraticuleStep and maxGraticuleStep. Anything that isn't a number gives 1°.
+func parseGraticuleStep(value string) float64 {
+	step, err := strconv.ParseFloat(value, 64)
+	if err != nil || step <= 0 || math.IsNaN(step) {
+		return defaultGraticuleStep
+	}
+	return math.Max(minGraticuleStep, math.Min(step, maxGraticuleStep))
+}
+
+// graticuleLabel formats a latitude or longitude for labelling a graticule line, such as
+// 42°S or 147.5°E
+func graticuleLabel(value float64, latitude bool) string {
+	hemisphere := "E"
+	switch {
+	case latitude && value < 0:
+		hemisphere = "S"
+	case latitude:
+		hemisphere = "N"
+	case value < 0:
+		hemisphere = "W"
+	}
+	return strconv.FormatFloat(math.Round(math.Abs(value)*100)/100, 'f', -1, 64) + "°" + hemisphere
+}
+
+// graticuleValues returns the multiples of step from low to high
+func graticuleValues(low, high, step float64) []float64 {
+	var values []float64
+	for i := math.Ceil(low / step); i*step <= high; i++ {
+		values = append(values, math.Round(i*step*100)/100)
+	}
+	return values
+}
+
+// graticuleLine projects a line of latitude or longitude through the given points onto the
+// canvas, splitting it wherever it leaves the canvas or crosses an inset, as the positions
+// there are shifted
+func graticuleLine(reg *baseRegion, points [][2]float64) (segments [][]pixel) {
+	var current []pixel
+	for _, pt := range points {
+		x, y, in := reg.projectFrame(pt[0], pt[1])
+		if in != nil || x < 0 || x > canvasWidth || y < 0 || y > canvasHeight {
+			if len(current) > 1 {
+				segments = append(segments, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, pixel{float64(x), float64(y)})
+	}
+	if len(current) > 1 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+// graticuleLines returns the lines of latitude and of longitude step degrees apart across
+// the area covered by the map, each as the segments it is drawn in
+func graticuleLines(reg *baseRegion, step float64) (lats, lons map[float64][][]pixel) {
+	lats, lons = make(map[float64][][]pixel), make(map[float64][][]pixel)
+	for _, lat := range graticuleValues(reg.south, reg.north, step) {
+		var points [][2]float64
+		for lon := reg.west; lon <= reg.east+1e-9; lon += graticuleSample {
+			points = append(points, [2]float64{lat, lon})
+		}
+		if segments := graticuleLine(reg, points); len(segments) > 0 {
+			lats[lat] = segments
+		}
+	}
+	for _, lon := range graticuleValues(reg.west, reg.east, step) {
+		var points [][2]float64
+		for lat := reg.north; lat >= reg.south-1e-9; lat -= graticuleSample {
+			points = append(points, [2]float64{lat, lon})
+		}
+		if segments := graticuleLine(reg, points); len(segments) > 0 {
+			lons[lon] = segments
+		}
+	}
+	return lats, lons
+}
+
+// labelFits reports whether a label of the given size in pixels, with its bottom left corner
+// at x,y, lies on the canvas clear of the legends, scale bar and north arrow
+func labelFits(x, y, width, height int) bool {
+	if x < 0 || y-height < 0 || x+width > canvasWidth || y > canvasHeight {
+		return false
+	}
+	for _, r := range graticuleReserved {
+		if x < r[2] && x+width > r[0] && y-height < r[3] && y > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// graticule draws faint lines of latitude and longitude step degrees apart, beneath the
+// title box and the records. Lines of latitude are labelled by the right edge of the map and
+// lines of longitude by the top edge, leaving out any label that would cover another part
+// of the map's furniture. The lines are drawn in the graticule colour of t.
+func graticule(reg *baseRegion, step float64, t mapTheme) string {
+	const fontSize = 16
+	textStyle := fmt.Sprintf("font-size:%dpx;font-family:Arial;fill:#606060", fontSize)
+	lats, lons := graticuleLines(reg, step)
+
+	buf := new(bytes.Buffer)
+	canvas := svg.New(buf)
+	canvas.Gid("graticule")
+	draw := func(segments [][]pixel) {
+		for _, seg := range segments {
+			xs, ys := make([]int, len(seg)), make([]int, len(seg))
+			for i, p := range seg {
+				xs[i], ys[i] = int(p.x), int(p.y)
+			}
+			canvas.Polyline(xs, ys, fmt.Sprintf(graticuleStyle, t.graticule))
+		}
+	}
+
+	for _, lat := range graticuleValues(reg.south, reg.north, step) {
+		segments, ok := lats[lat]
+		if !ok {
+			continue
+		}
+		draw(segments)
+		last := segments[len(segments)-1]
+		end := last[len(last)-1] // The eastern end of the line
+		label := graticuleLabel(lat, true)
+		width := utf8.RuneCountInString(label) * fontSize * 6 / 10
+		x, y := int(end.x)-width-4, int(end.y)-4
+		if labelFits(x, y, width, fontSize) {
+			canvas.Text(x, y, label, textStyle)
+		}
+	}
+	for _, lon := range graticuleValues(reg.west, reg.east, step) {
+		segments, ok := lons[lon]
+		if !ok {
+			continue
+		}
+		draw(segments)
+		start := segments[0][0] // The northern end of the line
+		label := graticuleLabel(lon, false)
+		width := utf8.RuneCountInString(label) * fontSize * 6 / 10
+		x, y := int(start.x)+4, int(start.y)+fontSize+2
+		if labelFits(x, y, width, fontSize) {
+			canvas.Text(x, y, label, textStyle)
+		}
+	}
+	canvas.Gend()
+	return buf.String()
+}
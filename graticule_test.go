@@ -0,0 +1,86 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var graticuleText = regexp.MustCompile(`<text x="(\d+)" y="(\d+)"[^>]*>([^<]*)</text>`)
+
+// lineValues returns the latitudes or longitudes of the lines drawn, in order
+func lineValues(lines map[float64][][]pixel) []float64 {
+	var values []float64
+	for v := range lines {
+		values = append(values, v)
+	}
+	sort.Float64s(values)
+	return values
+}
+
+// fmtFloats lists values as briefly as they can be written
+func fmtFloats(values []float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func TestGraticuleLines(t *testing.T) {
+	tests := []struct {
+		step       float64
+		lats, lons string
+	}{
+		{1, "[-43 -42 -41 -40]", "[145 146 147 148]"},
+		{0.5, "[-43.5 -43 -42.5 -42 -41.5 -41 -40.5 -40 -39.5]", "[144.5 145 145.5 146 146.5 147 147.5 148 148.5]"},
+	}
+	for _, tt := range tests {
+		lats, lons := graticuleLines(tasmania, tt.step)
+		if got := fmtFloats(lineValues(lats)); got != tt.lats {
+			t.Errorf("step %g: lines of latitude at %s, want %s", tt.step, got, tt.lats)
+		}
+		if got := fmtFloats(lineValues(lons)); got != tt.lons {
+			t.Errorf("step %g: lines of longitude at %s, want %s", tt.step, got, tt.lons)
+		}
+	}
+}
+
+func TestGraticuleLabels(t *testing.T) {
+	doc := graticule(tasmania, 1, mapThemes[defaultTheme])
+	if n := strings.Count(doc, "<polyline"); n < 8 {
+		t.Errorf("%d lines drawn, want at least 8", n)
+	}
+	var labels []string
+	for _, m := range graticuleText.FindAllStringSubmatch(doc, -1) {
+		labels = append(labels, m[3])
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		if !labelFits(x, y, utf8.RuneCountInString(m[3])*16*6/10, 16) {
+			t.Errorf("label %s at %d,%d covers the legend, scale bar or north arrow", m[3], x, y)
+		}
+	}
+	if got, want := strings.Join(labels, " "), "43°S 42°S 41°S 40°S 145°E 146°E 147°E 148°E"; got != want {
+		t.Errorf("labels %s, want %s", got, want)
+	}
+
+	for _, tt := range []struct {
+		value    float64
+		latitude bool
+		want     string
+	}{
+		{-42, true, "42°S"}, {-42.5, true, "42.5°S"}, {10.25, true, "10.25°N"}, {147.5, false, "147.5°E"}, {-70, false, "70°W"},
+	} {
+		if got := graticuleLabel(tt.value, tt.latitude); got != tt.want {
+			t.Errorf("graticuleLabel(%g, %v) = %q, want %q", tt.value, tt.latitude, got, tt.want)
+		}
+	}
+	for value, want := range map[string]float64{"": 1, "0.5": 0.5, "0.1": minGraticuleStep, "20": maxGraticuleStep, "-1": 1} {
+		if got := parseGraticuleStep(value); got != want {
+			t.Errorf("parseGraticuleStep(%q) = %g, want %g", value, got, want)
+		}
+	}
+}
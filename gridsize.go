@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+const (
+	defaultCellKm = 10.0  // Side of the mapper's own grid cells, in km
+	minCellKm     = 2.0   // Smallest cell side that can be asked for, keeping the number of cells sensible
+	maxCellKm     = 100.0 // Largest cell side that can be asked for
+	gridWidth     = 850   // Width in pixels of the area the mapper covers with its grid
+	gridHeight    = 1175  // Height in pixels of the area the mapper covers with its grid
+)
+
+// parseCellSize reads the requested side of grid map cells in km, limited to between
+// minCellKm and maxCellKm. Anything that isn't a number gives the mapper's own 10 km grid.
+func parseCellSize(value string) float64 {
+	km, err := strconv.ParseFloat(value, 64)
+	if err != nil || km <= 0 || math.IsNaN(km) {
+		return defaultCellKm
+	}
+	return math.Max(minCellKm, math.Min(km, maxCellKm))
+}
+
+// cellGridMap draws a grid map with cells of the given side in km instead of the mapper's
+// 10 km cells. Each cell holding a record is marked once, with a filled circle if any of its
+// records is vouchered and an empty one if they are all observations. Data without voucher
+// status marks every occupied cell with a filled circle.
+func cellGridMap(reg *baseRegion, rl *mapper.RecordList, records []record, vouchered bool, km float64, w io.Writer) {
+	side := km * 1000 / pixelSize
+	cols, rows := int(math.Ceil(gridWidth/side)), int(math.Ceil(gridHeight/side))
+
+	// 1 marks a cell with a vouchered record, 2 a cell holding only observations
+	cells := make(map[[2]int]int)
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		cell := [2]int{int(float64(x-leftMargin) / side), int(float64(y-topMargin) / side)}
+		if cell[0] < 0 || cell[0] >= cols || cell[1] < 0 || cell[1] >= rows {
+			continue
+		}
+		if rec.voucher || !vouchered {
+			cells[cell] = 1
+		} else if cells[cell] == 0 {
+			cells[cell] = 2
+		}
+	}
+
+	grid := new(bytes.Buffer)
+	canvas := svg.New(grid)
+
+	canvas.Gid("gridAndNumbers")
+	for c := 0; c <= cols; c++ {
+		x := leftMargin + int(math.Round(math.Min(float64(c)*side, gridWidth)))
+		canvas.Line(x, topMargin, x, topMargin+gridHeight, "stroke:black")
+	}
+	for r := 0; r <= rows; r++ {
+		y := topMargin + int(math.Round(math.Min(float64(r)*side, gridHeight)))
+		canvas.Line(leftMargin, y, leftMargin+gridWidth, y, "stroke:black")
+	}
+	canvas.Gend()
+
+	overlay := new(bytes.Buffer)
+	canvas = svg.New(overlay)
+	radius := int(math.Max(1, math.Round(side*9/25)))
+	canvas.Gid("cells")
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			mark := cells[[2]int{c, r}]
+			if mark == 0 {
+				continue
+			}
+			fill := "black"
+			if mark == 2 {
+				fill = "white"
+			}
+			x := leftMargin + int(math.Round((float64(c)+0.5)*side))
+			y := topMargin + int(math.Round((float64(r)+0.5)*side))
+			canvas.Circle(x, y, radius, fmt.Sprintf("fill:%s;stroke-width:%dpx;stroke:black", fill, int(math.Max(1, float64(radius)/3))))
+		}
+	}
+	canvas.Gend()
+
+	// The grid goes under the title box, as on the mapper's own grid maps
+	doc := insertBeforeGroup(baseMap(rl), "infoBox", grid.String())
+	fmt.Fprint(w, appendToSVG(doc, overlay.String()))
+}
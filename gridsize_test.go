@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var cellsGroup = regexp.MustCompile(`(?s)<g id="cells">.*?</g>`)
+
+// shadedCells maps coords on a grid map with cells of the given side, returning the
+// circles marking occupied cells
+func shadedCells(t *testing.T, coords string, km float64) []string {
+	t.Helper()
+	data := baseMapData("Aus bus", "grid", coords, defaultZone)
+	data.CellKm = km
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return regexp.MustCompile(`<circle [^>]*>`).FindAllString(cellsGroup.FindString(doc), -1)
+}
+
+func TestCellSizeChangesShadedCells(t *testing.T) {
+	coords := spreadCoords(100) // A line of records 100 km long or so
+	fine, medium, coarse := len(shadedCells(t, coords, 5)), len(shadedCells(t, coords, 20)), len(shadedCells(t, coords, 50))
+	if !(fine > medium && medium > coarse && coarse > 0) {
+		t.Errorf("5, 20 and 50 km cells shade %d, %d and %d cells", fine, medium, coarse)
+	}
+
+	// Many records in one cell mark it once, and a vouchered record fills it
+	cells := shadedCells(t, strings.Repeat("-42.0,146.5,0\n", 10)+"-42.01,146.51,1\n-41.2,146.0,0\n", 20)
+	if len(cells) != 2 {
+		t.Fatalf("records in two cells shade %d", len(cells))
+	}
+	if !strings.Contains(cells[0]+cells[1], "fill:black") || !strings.Contains(cells[0]+cells[1], "fill:white") {
+		t.Errorf("cells with and without a vouchered record drawn as %q", cells)
+	}
+}
+
+func TestParseCellSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", defaultCellKm},
+		{"25", 25},
+		{"0.1", minCellKm},
+		{"5000", maxCellKm},
+		{"-5", defaultCellKm},
+		{"NaN", defaultCellKm},
+		{"coarse", defaultCellKm},
+	}
+	for _, tt := range tests {
+		if got := parseCellSize(tt.value); got != tt.want {
+			t.Errorf("parseCellSize(%q) = %g, want %g", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// compressibleTypes are the content types worth compressing. Images other than SVG and zip
+// files are compressed already.
+var compressibleTypes = []string{"text/", "image/svg+xml", "application/json", "application/geo+json",
+	"application/vnd.google-earth.kml+xml"}
+
+// gzipWriter compresses a response once it knows the response is of a type worth
+// compressing, which it decides on the first write
+type gzipWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	status  int  // Status held back until the first write, 0 if none was set
+	decided bool // Whether the headers have been sent
+}
+
+// WriteHeader holds the status back until the first write has decided on compression
+func (gw *gzipWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.status = status
+	}
+}
+
+// Write compresses b if the response is being compressed, deciding whether to the first
+// time it is called. Responses without a content type are given the one sniffed from the
+// uncompressed data, as net/http would otherwise sniff the compressed data.
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.decided {
+		h := gw.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(b))
+		}
+		if compressible(h.Get("Content-Type")) && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) { // The compressed bytes differ, so the tag is only weak
+				h.Set("ETag", "W/"+etag)
+			}
+			gw.gz = gzip.NewWriter(gw.ResponseWriter)
+		}
+		gw.sendHeader()
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// sendHeader sends the status held back, if any
+func (gw *gzipWriter) sendHeader() {
+	gw.decided = true
+	if gw.status != 0 {
+		gw.ResponseWriter.WriteHeader(gw.status)
+	}
+}
+
+// close finishes the compressed stream, or sends the status of a response without a body
+func (gw *gzipWriter) close() {
+	if !gw.decided {
+		gw.sendHeader()
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+// compressible reports whether responses of a content type are worth compressing
+func compressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipHandler compresses the responses of a handler for clients that accept gzip, leaving
+// them as they are for everyone else
+func gzipHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			h(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		h(gw, r)
+	}
+}
+
+// acceptsGzip reports whether the client has said it accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if name := strings.TrimSpace(strings.Split(enc, ";")[0]); name == "gzip" || name == "*" {
+			return !strings.HasSuffix(strings.ReplaceAll(enc, " ", ""), ";q=0")
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// readBody returns the body of a response, decompressed if it was gzipped
+func readBody(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		return rec.Body.String()
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response isn't gzipped: %v", err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("response can't be decompressed: %v", err)
+	}
+	return string(b)
+}
+
+func TestGzipResponses(t *testing.T) {
+	ms := newMapStore()
+	form := url.Values{"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2"}}
+	page := postForm(ms.mapDisplay, "/map", form).Body.String()
+	id := mapfileLink.FindStringSubmatch(page)[1]
+
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		req    func() *http.Request
+		status int
+		want   string
+	}{
+		{"results page", ms.mapDisplay, func() *http.Request {
+			req := httptest.NewRequest("POST", "/map", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return req
+		}, http.StatusOK, "<svg"},
+		{"download", ms.mapAsFile, func() *http.Request { return httptest.NewRequest("GET", "/mapfile?id="+id, nil) },
+			http.StatusOK, "<svg"},
+		{"API", apiMap, func() *http.Request {
+			return httptest.NewRequest("POST", "/api/map", strings.NewReader(`{"coordinates":"-42.1,147.2"}`))
+		}, http.StatusOK, `"svg":"`},
+		{"API error", apiMap, func() *http.Request { return httptest.NewRequest("GET", "/api/map", nil) },
+			http.StatusMethodNotAllowed, `"error":`},
+	}
+	for _, tt := range tests {
+		for _, enc := range []string{"", "gzip, deflate"} {
+			req := tt.req()
+			req.Header.Set("Accept-Encoding", enc)
+			rec := httptest.NewRecorder()
+			gzipHandler(tt.h)(rec, req)
+
+			if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != (enc != "") {
+				t.Errorf("%s with Accept-Encoding %q gzipped %v", tt.name, enc, gzipped)
+			}
+			if body := readBody(t, rec); rec.Code != tt.status || !strings.Contains(body, tt.want) {
+				t.Errorf("%s with Accept-Encoding %q gave %d without %q", tt.name, enc, rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("%s doesn't vary by Accept-Encoding", tt.name)
+			}
+		}
+	}
+}
+
+func TestGzipSkipsCompressedTypes(t *testing.T) {
+	png := gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	req := httptest.NewRequest("GET", "/mapfile", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	png(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "\x89PNG\r\n\x1a\n" {
+		t.Error("PNG image compressed again")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0", false},
+		{"br, deflate", false},
+		{"gzipped", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(req); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
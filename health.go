@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// healthz handles "/healthz", the liveness probe, which reports that the server is up
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, "ok")
+}
+
+// readyz handles "/readyz", the readiness probe, which reports whether the page templates
+// can be used to serve pages
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if _, err := loadTemplates(); err != nil {
+		writeHealth(w, http.StatusServiceUnavailable, "templates unavailable: "+err.Error())
+		return
+	}
+	writeHealth(w, http.StatusOK, "ready")
+}
+
+// writeHealth writes the short JSON body of a health check response
+func writeHealth(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"status": message})
+}
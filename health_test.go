@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// probe calls a health check handler, returning its status and the status in its body
+func probe(t *testing.T, h http.HandlerFunc) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/", nil))
+	var body struct{ Status string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("response is not JSON: %q", rec.Body.String())
+	}
+	return rec.Code, body.Status
+}
+
+func TestHealthz(t *testing.T) {
+	if code, status := probe(t, healthz); code != http.StatusOK || status != "ok" {
+		t.Errorf("got %d %q", code, status)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	assetsDir = t.TempDir() // No templates to parse
+	code, _ := probe(t, readyz)
+	assetsDir = ""
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("ready without templates, got %d", code)
+	}
+	if code, status := probe(t, readyz); code != http.StatusOK || status != "ready" {
+		t.Errorf("embedded templates gave %d %q", code, status)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+const (
+	heatCell   = 20   // Pixel size of each side of a heat map cell, 8 km at the map's scale
+	heatSigma  = 1.0  // Spread of each record's kernel, in cells
+	heatRadius = 3    // Cells either side of a record that its kernel reaches
+	heatFloor  = 0.02 // Fraction of the highest density below which cells are left clear
+)
+
+// heatDensity spreads each record over the cells around it with a Gaussian kernel and
+// returns the density of every cell, indexed by row and column. Each record adds up to one
+// across the cells it reaches, so densities read as records per cell.
+func heatDensity(reg *baseRegion, records []record) (density [][]float64, max float64) {
+	cols, rows := (canvasWidth+heatCell-1)/heatCell, (canvasHeight+heatCell-1)/heatCell
+	density = make([][]float64, rows)
+	for r := range density {
+		density[r] = make([]float64, cols)
+	}
+
+	var kernel [2*heatRadius + 1][2*heatRadius + 1]float64
+	total := 0.0
+	for dr := -heatRadius; dr <= heatRadius; dr++ {
+		for dc := -heatRadius; dc <= heatRadius; dc++ {
+			k := math.Exp(-float64(dr*dr+dc*dc) / (2 * heatSigma * heatSigma))
+			kernel[dr+heatRadius][dc+heatRadius] = k
+			total += k
+		}
+	}
+
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		col, row := x/heatCell, y/heatCell
+		for dr := -heatRadius; dr <= heatRadius; dr++ {
+			for dc := -heatRadius; dc <= heatRadius; dc++ {
+				r, c := row+dr, col+dc
+				if r < 0 || r >= rows || c < 0 || c >= cols {
+					continue
+				}
+				density[r][c] += kernel[dr+heatRadius][dc+heatRadius] / total * float64(rec.weight())
+				max = math.Max(max, density[r][c])
+			}
+		}
+	}
+	return density, max
+}
+
+// heatMap draws the Tasmania outline under a smoothed surface showing how densely the
+// records are packed, for showing sampling intensity rather than individual records, and
+// a legend of the density bands
+func heatMap(reg *baseRegion, rl *mapper.RecordList, records []record, w io.Writer) {
+	density, max := heatDensity(reg, records)
+	band := max / float64(len(choroplethRamp))
+
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid("heat")
+	for r, row := range density {
+		for c, d := range row {
+			if d <= 0 || d < max*heatFloor {
+				continue
+			}
+			idx := int(math.Min(d/band, float64(len(choroplethRamp)-1)))
+			canvas.Rect(c*heatCell, r*heatCell, heatCell, heatCell,
+				"fill:"+choroplethRamp[idx]+";fill-opacity:0.7;stroke:none", fmt.Sprintf(`data-density="%.2f"`, d))
+		}
+	}
+	canvas.Gend()
+
+	count := 0
+	for _, rec := range records {
+		count += rec.weight()
+	}
+	labels := make([]string, len(choroplethRamp))
+	for i := range choroplethRamp {
+		labels[i] = fmt.Sprintf("%.1f-%.1f", float64(i)*band, float64(i+1)*band)
+	}
+	rampLegend(canvas, "Records per 8 km cell", choroplethRamp, labels, 0.7,
+		fmt.Sprintf("Records: %d", count))
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var heatCellRect = regexp.MustCompile(`<rect x="(\d+)" y="(\d+)" [^>]*fill:(#[0-9a-fA-F]+);[^>]*data-density="([0-9.]+)"`)
+
+func TestHeatMapDensity(t *testing.T) {
+	coords := strings.Repeat("-42.88,147.32\n", 30) + "-40.9,145.0\n" // Hobart and a lone record in the north-west
+	data := baseMapData("Aus bus", "heat", coords, defaultZone)
+	doc, records, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc, `id="heat"`) || !strings.Contains(doc, "Records per 8 km cell") || !strings.Contains(doc, "Records: 31") {
+		t.Error("heat map has no density layer or legend")
+	}
+
+	hx, hy := tasmania.project(-42.88, 147.32)
+	lx, ly := tasmania.project(-40.9, 145.0)
+	fills := map[string]string{}
+	max := 0.0
+	for _, m := range heatCellRect.FindAllStringSubmatch(doc, -1) {
+		d, _ := strconv.ParseFloat(m[4], 64)
+		max = math.Max(max, d)
+		fills[m[1]+","+m[2]] = m[3]
+	}
+	cell := func(x, y int) string {
+		return strconv.Itoa(x/heatCell*heatCell) + "," + strconv.Itoa(y/heatCell*heatCell)
+	}
+	if got := fills[cell(hx, hy)]; got != choroplethRamp[len(choroplethRamp)-1] {
+		t.Errorf("densest cell filled %q, want the hot end of the ramp %q", got, choroplethRamp[len(choroplethRamp)-1])
+	}
+	if got := fills[cell(lx, ly)]; got != choroplethRamp[0] {
+		t.Errorf("lone record's cell filled %q, want the cool end of the ramp %q", got, choroplethRamp[0])
+	}
+
+	density, densest := heatDensity(tasmania, records)
+	if math.Abs(densest-max) > 0.005 || density[hy/heatCell][hx/heatCell] != densest {
+		t.Errorf("highest density %g, drawn %g, or not in the cluster's cell", densest, max)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	maxBatchJobs      = 100 // Largest number of batches kept for retried submissions
+	maxIdempotencyKey = 255 // Longest Idempotency-Key accepted, in bytes
+)
+
+// batchJob is a batch submitted with an Idempotency-Key, kept so that a client retrying the
+// submission is sent the same maps rather than having them drawn again
+type batchJob struct {
+	created time.Time
+	body    [sha256.Size]byte // Hash of the request the key was first sent with
+	done    chan struct{}     // Closed once the batch has been drawn, or given up on
+	zip     []byte            // The archive sent for the batch, nil if it couldn't be drawn
+}
+
+// batchStore keeps the batches submitted with an Idempotency-Key for as long as maps are
+// kept for download, after which the key can be used for a new batch
+type batchStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*batchJob
+	order []string // Keys in the order their batches were submitted, oldest first
+}
+
+// newBatchStore creates an empty batchStore
+func newBatchStore() *batchStore {
+	return &batchStore{jobs: make(map[string]*batchJob)}
+}
+
+// job returns the batch submitted with key, creating it if there is none, and reports
+// whether it was created, in which case the caller draws it and then calls finish. It gives
+// nil if key was used for a different request.
+func (bs *batchStore) job(key string, body []byte) (job *batchJob, created bool) {
+	sum := sha256.Sum256(body)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.expire()
+	if job, ok := bs.jobs[key]; ok {
+		if job.body != sum {
+			return nil, false
+		}
+		return job, false
+	}
+	for len(bs.order) >= maxBatchJobs {
+		delete(bs.jobs, bs.order[0])
+		bs.order = bs.order[1:]
+	}
+	job = &batchJob{created: time.Now(), body: sum, done: make(chan struct{})}
+	bs.jobs[key] = job
+	bs.order = append(bs.order, key)
+	return job, true
+}
+
+// finish records the archive drawn for the batch submitted with key and wakes any
+// submissions waiting for it. A batch that couldn't be drawn is forgotten, so that
+// submitting it again draws it afresh.
+func (bs *batchStore) finish(key string, job *batchJob, zip []byte) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	job.zip = zip
+	if zip == nil && bs.jobs[key] == job {
+		delete(bs.jobs, key)
+		for i, k := range bs.order {
+			if k == key {
+				bs.order = append(bs.order[:i], bs.order[i+1:]...)
+				break
+			}
+		}
+	}
+	close(job.done)
+}
+
+// expire discards batches submitted longer ago than mapExpiry. Batches are stored in order,
+// so it stops at the first one that is still current. The caller must hold bs.mu.
+func (bs *batchStore) expire() {
+	for len(bs.order) > 0 {
+		key := bs.order[0]
+		if job := bs.jobs[key]; job != nil && time.Since(job.created) < mapExpiry {
+			return
+		}
+		delete(bs.jobs, key)
+		bs.order = bs.order[1:]
+	}
+}
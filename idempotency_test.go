@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postBatch sends body to bs's "/api/batch" with the given Idempotency-Key
+func postBatch(bs *batchStore, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	bs.apiBatch(rec, req)
+	return rec
+}
+
+func TestBatchIdempotencyKey(t *testing.T) {
+	bs := newBatchStore()
+	body := `[{"taxon": "Aus bus", "maptype": "grid", "coordinates": "-42.1,147.2"}]`
+
+	first := postBatch(bs, "batch-1", body)
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first submission gave %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+	}
+	job := bs.jobs["batch-1"]
+	if job == nil {
+		t.Fatal("the batch was not kept under its key")
+	}
+
+	again := postBatch(bs, "batch-1", body)
+	if again.Code != http.StatusOK || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("resubmission gave %d, replayed %q", again.Code, again.Header().Get("Idempotent-Replayed"))
+	}
+	if !bytes.Equal(again.Body.Bytes(), first.Body.Bytes()) {
+		t.Error("resubmission was sent a different archive")
+	}
+	if len(bs.jobs) != 1 || bs.jobs["batch-1"] != job {
+		t.Errorf("resubmission made a new job: %d kept", len(bs.jobs))
+	}
+
+	other := postBatch(bs, "batch-2", body)
+	if other.Code != http.StatusOK || other.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("another key gave %d, replayed %q", other.Code, other.Header().Get("Idempotent-Replayed"))
+	}
+	if len(bs.jobs) != 2 || bs.jobs["batch-2"] == job {
+		t.Errorf("another key shared the first job: %d kept", len(bs.jobs))
+	}
+
+	if rec := postBatch(bs, "batch-1", `[{"taxon": "Cus dus", "coordinates": "-42.1,147.2"}]`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reusing a key for another batch gave %d, want 422", rec.Code)
+	}
+	if rec := postBatch(bs, strings.Repeat("k", maxIdempotencyKey+1), body); rec.Code != http.StatusBadRequest {
+		t.Errorf("an overlong key gave %d, want 400", rec.Code)
+	}
+
+	job.created = time.Now().Add(-mapExpiry)
+	expired := postBatch(bs, "batch-1", `[{"taxon": "Cus dus", "coordinates": "-42.1,147.2"}]`)
+	if expired.Code != http.StatusOK || expired.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("an expired key gave %d, replayed %q", expired.Code, expired.Header().Get("Idempotent-Replayed"))
+	}
+	if bs.jobs["batch-1"] == job {
+		t.Error("an expired key kept its old job")
+	}
+}
+
+func TestBatchIdempotencyUnfinished(t *testing.T) {
+	defer func(d time.Duration) { renderTimeout = d }(renderTimeout)
+	renderTimeout = 50 * time.Millisecond
+	bs := newBatchStore()
+	body := `[{"taxon": "Aus bus", "coordinates": "-42.1,147.2"}]`
+	job, created := bs.job("batch-1", []byte(body))
+	if !created {
+		t.Fatal("a new key did not create a job")
+	}
+
+	// The first submission is still being drawn when the retry runs out of time
+	if rec := postBatch(bs, "batch-1", body); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("waiting on an unfinished batch gave %d, want 503", rec.Code)
+	}
+	bs.finish("batch-1", job, nil) // The first submission gave up
+	if _, ok := bs.jobs["batch-1"]; ok {
+		t.Error("an unfinished batch was kept")
+	}
+	if rec := postBatch(bs, "batch-1", body); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retrying an unfinished batch gave %d", rec.Code)
+	}
+}
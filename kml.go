@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// KML types for a document of point placemarks
+type (
+	kmlRoot struct {
+		XMLName  xml.Name    `xml:"kml"`
+		Xmlns    string      `xml:"xmlns,attr"`
+		Document kmlDocument `xml:"Document"`
+	}
+	kmlDocument struct {
+		Name       string         `xml:"name"`
+		Styles     []kmlStyle     `xml:"Style"`
+		Placemarks []kmlPlacemark `xml:"Placemark"`
+	}
+	kmlStyle struct {
+		ID   string `xml:"id,attr"`
+		Icon struct {
+			Color string `xml:"color"` // Alpha, blue, green, red, as KML has it
+			Scale string `xml:"scale"`
+		} `xml:"IconStyle"`
+	}
+	kmlPlacemark struct {
+		Name        string `xml:"name"`
+		Description string `xml:"description,omitempty"`
+		StyleURL    string `xml:"styleUrl"`
+		Coordinates string `xml:"Point>coordinates"` // Longitude, latitude and altitude, as KML requires
+	}
+)
+
+// kmlStyles tell vouchered records from anecdotal ones and those without a voucher status,
+// coloured as on voucher maps where they can be
+var kmlStyles = []struct{ id, color string }{
+	{"vouchered", "ff000000"},
+	{"anecdotal", "ffffffff"},
+	{"record", "ff0000ff"},
+}
+
+// recordsKML converts records to a KML document named after the taxon, with a placemark
+// for each record styled by its voucher status
+func recordsKML(records []record, taxon string) kmlRoot {
+	doc := kmlDocument{Name: taxon, Placemarks: make([]kmlPlacemark, 0, len(records))}
+	for _, s := range kmlStyles {
+		style := kmlStyle{ID: s.id}
+		style.Icon.Color, style.Icon.Scale = s.color, "1"
+		doc.Styles = append(doc.Styles, style)
+	}
+
+	for _, rec := range records {
+		pm := kmlPlacemark{Name: taxon, StyleURL: "#record", Description: pointLabel(rec)}
+		if rec.taxon != "" { // Data with several taxa names each record's own
+			pm.Name = rec.taxon
+		}
+		if rec.hasVoucher && rec.voucher {
+			pm.StyleURL = "#vouchered"
+		} else if rec.hasVoucher {
+			pm.StyleURL = "#anecdotal"
+		}
+		pm.Coordinates = fmt.Sprintf("%s,%s,0", strconv.FormatFloat(rec.lon, 'f', -1, 64), strconv.FormatFloat(rec.lat, 'f', -1, 64))
+		doc.Placemarks = append(doc.Placemarks, pm)
+	}
+	return kmlRoot{Xmlns: "http://www.opengis.net/kml/2.2", Document: doc}
+}
+
+// apiKML handles "/api/kml", which serves the records of a map as KML for viewing in
+// Google Earth, given either the id of a map or new records as for the other exports
+func (ms *mapStore) apiKML(w http.ResponseWriter, r *http.Request) {
+	records, taxon, _, ok := ms.exportRecords(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+	setAttachment(w, exportFileName(taxon, "kml"))
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(recordsKML(records, taxon)); err != nil {
+		errorLog.Printf("Error writing KML: %s", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestKMLExport(t *testing.T) {
+	rec := postJSON(newMapStore().apiKML, "/api/kml",
+		`{"taxon":"Aus bus & <co>","coordinates":"-42.1,147.2,1\n-41.5,146.5,0\n-41.2,146.1,1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("KML export gave %d: %s", rec.Code, rec.Body)
+	}
+	if ct, cd := rec.Header().Get("Content-Type"), rec.Header().Get("Content-Disposition"); ct != "application/vnd.google-earth.kml+xml" ||
+		!strings.Contains(cd, ".kml") {
+		t.Errorf("KML sent as %q named %q", ct, cd)
+	}
+	body := rec.Body.String()
+	if err := wellFormed(body); err != nil || !strings.HasPrefix(body, xml.Header) {
+		t.Fatalf("KML isn't well-formed XML: %v", err)
+	}
+
+	var doc kmlRoot
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Xmlns != "http://www.opengis.net/kml/2.2" || doc.Document.Name != "Aus bus & <co>" {
+		t.Errorf("document %q in namespace %q", doc.Document.Name, doc.Xmlns)
+	}
+	want := []struct{ coords, style string }{
+		{"147.2,-42.1,0", "#vouchered"}, // Longitude first, as KML has it
+		{"146.5,-41.5,0", "#anecdotal"},
+		{"146.1,-41.2,0", "#vouchered"},
+	}
+	if len(doc.Document.Placemarks) != len(want) {
+		t.Fatalf("%d placemarks for %d records", len(doc.Document.Placemarks), len(want))
+	}
+	for i, pm := range doc.Document.Placemarks {
+		if pm.Coordinates != want[i].coords || pm.StyleURL != want[i].style {
+			t.Errorf("placemark %d at %q styled %q, want %q and %q", i, pm.Coordinates, pm.StyleURL, want[i].coords, want[i].style)
+		}
+	}
+	styles := map[string]bool{}
+	for _, s := range doc.Document.Styles {
+		styles["#"+s.ID] = true
+	}
+	if !styles["#vouchered"] || !styles["#anecdotal"] || !styles["#record"] {
+		t.Errorf("styles %v don't cover each voucher status", styles)
+	}
+}
+
+func TestKMLRecordsWithoutVouchers(t *testing.T) {
+	doc := recordsKML(parseRecords("## Bus cus\n-42.1,147.2"), "Aus bus")
+	if pm := doc.Document.Placemarks; len(pm) != 1 || pm[0].StyleURL != "#record" || pm[0].Name != "Bus cus" {
+		t.Errorf("got placemarks %+v", pm)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const inkscapeNS = `xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"`
+
+// layerNames maps the ids of the groups drawn by the mapper and the server to the names
+// of the layers they are shown as in an editor
+var layerNames = map[string]string{
+	"gridAndNumbers": "Gridlines",
+	"graticule":      "Gridlines",
+	"locator":        "Locator",
+	"infoBox":        "Labels",
+	"dots":           "Points",
+	"arrows":         "Points",
+	"distances":      "Points",
+	"sources":        "Points",
+	"taxa":           "Points",
+	"categories":     "Points",
+	"symbols":        "Points",
+	"points":         "Points",
+	"counts":         "Points",
+	"focal":          "Points",
+	"cells":          "Points",
+	"regions":        "Regions",
+	"heat":           "Density",
+	"legend":         "Legend",
+	"reference":      "Reference",
+	"scaleBar":       "Scale",
+	"northArrow":     "Scale",
+	"title":          "Labels",
+	"attribution":    "Labels",
+}
+
+var groupID = regexp.MustCompile(`^<g id="([^"]+)"`)
+
+// layeredSVG turns each logical part of a map into a named Inkscape layer, so the file
+// opens in an editor as organised layers rather than a flat drawing. The mapper's
+// wrapping group is removed so that the layers sit at the top level, the coastline is
+// wrapped in a layer of its own and ungrouped labels are gathered into a labels layer.
+func layeredSVG(doc string) string {
+	lines := strings.Split(addRootAttr(doc, inkscapeNS), "\n")
+	out := make([]string, 0, len(lines)+2)
+
+	depth := 0
+	skipDepth := -1 // Depth of the wrapping group whose closing tag is to be dropped
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "<g") && !strings.HasSuffix(line, "</g>"): // Not a whole group on one line, like a web map point
+			if depth == 0 {
+				if m := groupID.FindStringSubmatch(line); m != nil && m[1] == "theLot" {
+					skipDepth = depth
+					depth++
+					continue
+				}
+				line = layerGroup(line)
+			} else if skipDepth == 0 && depth == 1 {
+				line = layerGroup(line)
+			}
+			depth++
+		case line == "</g>":
+			depth--
+			if depth == skipDepth {
+				skipDepth = -1
+				continue
+			}
+		case strings.HasPrefix(line, "<path") && depth == 1 && skipDepth == 0:
+			line = fmt.Sprintf(`<g id="coastline" %s>`, layerAttrs("Coastline")) + "\n" + line + "\n</g>"
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// layerGroup adds the layer attributes to the opening tag of a top level group. Groups
+// without a known id hold the text of the web map and become its labels layer.
+func layerGroup(line string) string {
+	name := "Labels"
+	if m := groupID.FindStringSubmatch(line); m != nil {
+		if n, ok := layerNames[m[1]]; ok {
+			name = n
+		}
+	}
+	return strings.Replace(line, "<g", "<g "+layerAttrs(name), 1)
+}
+
+// layerAttrs returns the attributes that make a group an Inkscape layer with the given name
+func layerAttrs(name string) string {
+	return fmt.Sprintf(`inkscape:groupmode="layer" inkscape:label="%s"`, name)
+}
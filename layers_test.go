@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var layerLabel = regexp.MustCompile(`<g (?:id="([^"]*)" )?inkscape:groupmode="layer" inkscape:label="([^"]*)"(?: id="([^"]*)")?`)
+
+// drawLayered draws a map of the given type split into layers, with the legend, the
+// gridlines, the scale bar and north arrow and a title
+func drawLayered(t *testing.T, mapType string) string {
+	t.Helper()
+	data := baseMapData("Aus bus", mapType, "-42.0,146.5\n-41.5,147.0\n", defaultZone)
+	data.Layers, data.Legend, data.ScaleBar, data.NorthArrow, data.Title = true, true, true, true, true
+	data.Graticule, data.GraticuleStep = true, 1
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestLayersInOrder(t *testing.T) {
+	tests := []struct {
+		mapType string
+		want    []string
+	}{
+		{"plain", []string{"coastline:Coastline", "graticule:Gridlines", "infoBox:Labels", "dots:Points",
+			"legend:Legend", "scaleBar:Scale", "northArrow:Scale", "title:Labels"}},
+		{"web", []string{"coastline:Coastline", ":Labels", "dots:Points", "points:Points", "graticule:Gridlines",
+			"legend:Legend", "scaleBar:Scale", "northArrow:Scale", "title:Labels"}},
+	}
+	for _, tt := range tests {
+		doc := drawLayered(t, tt.mapType)
+		var got []string
+		for _, m := range layerLabel.FindAllStringSubmatch(doc, -1) {
+			got = append(got, m[1]+m[3]+":"+m[2])
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s map layers are\n%v\nwant\n%v", tt.mapType, got, tt.want)
+		}
+		if !strings.Contains(doc, inkscapeNS) || strings.Contains(doc, `id="theLot"`) {
+			t.Errorf("%s map isn't laid out as top level Inkscape layers", tt.mapType)
+		}
+		if strings.Count(doc, "<g") != strings.Count(doc, "</g>") {
+			t.Errorf("%s map groups don't balance", tt.mapType)
+		}
+	}
+}
+
+func TestNoLayersUnlessAsked(t *testing.T) {
+	doc, err := renderMap("Aus bus", "plain", "-42.0,146.5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(doc, "inkscape:groupmode") {
+		t.Error("map split into layers without being asked")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// symbolLegendTypes are the map types drawn without a legend of their own, which can be
+// given a legend of their symbols
+var symbolLegendTypes = map[string]bool{"grid": true, "plain": true, "web": true, "arrow": true}
+
+// symbolLegend adds a legend of the point symbols on the map with a count of each, in the
+// same corner as the other legends. Vouchered grid maps show vouchered specimens and
+// observations apart, matching the solid and empty circles the mapper draws; any other map
+// just shows the number of records. The symbols are drawn in the colours of m. Like the scale
+// bar, the legend is placed and sized from the area the map shows.
+func symbolLegend(doc string, records []record, vouchered bool, m markerStyle) string {
+	x0, y0, _, height, s, ok := viewFrame(doc)
+	if !ok {
+		return doc
+	}
+	x, y, rowHeight := x0+40*s, y0+height-310*s, 30*s
+	textStyle := fmt.Sprintf("font-size:%.2fpx;font-family:Arial;fill:#000000", 20*s)
+
+	buf := new(bytes.Buffer)
+	symbol := func(row int, style, label string) {
+		fmt.Fprintf(buf, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\" style=\"%s\" />\n", x+15*s, y+float64(row)*rowHeight-7*s, 9*s, style)
+		fmt.Fprintf(buf, "<text x=\"%.2f\" y=\"%.2f\" style=\"%s\">%s</text>\n", x+40*s, y+float64(row)*rowHeight, textStyle, label)
+	}
+	fmt.Fprintln(buf, `<g id="legend">`)
+	fmt.Fprintf(buf, "<text x=\"%.2f\" y=\"%.2f\" style=\"%s;font-weight:bold\">Records</text>\n", x, y, textStyle)
+
+	if vouchered {
+		var specimens, observations int
+		for _, rec := range records { // Points that merged records count each of them
+			if rec.voucher {
+				specimens += rec.weight()
+			} else {
+				observations += rec.weight()
+			}
+		}
+		ring := fmt.Sprintf(";stroke-width:%.2fpx;stroke:", 3*s)
+		symbol(1, "fill:"+m.colour+ring+m.colour, fmt.Sprintf("Vouchered specimen (%d)", specimens))
+		symbol(2, "fill:white"+ring+m.anecdotal, fmt.Sprintf("Observation (%d)", observations))
+	} else {
+		total := 0
+		for _, rec := range records {
+			total += rec.weight()
+		}
+		label := fmt.Sprintf("%d records", total)
+		if total == 1 {
+			label = "1 record"
+		}
+		symbol(1, "fill:"+m.colour, label)
+	}
+	fmt.Fprintln(buf, "</g>")
+	return appendToSVG(doc, buf.String())
+}
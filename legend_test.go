@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// legendMap draws a map with a symbol legend, returning its SVG
+func legendMap(t *testing.T, mapType, coords string) string {
+	t.Helper()
+	data := baseMapData("Aus bus", mapType, coords, defaultZone)
+	data.Legend = true
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestSymbolLegendCounts(t *testing.T) {
+	tests := []struct {
+		mapType, coords string
+		want            []string
+	}{
+		{"grid", "-42.1,147.2,1\n-41.5,146.5,1\n-41.2,146.0,0", []string{">Vouchered specimen (2)<", ">Observation (1)<"}},
+		{"grid", "-42.1,147.2\n-41.5,146.5", []string{">2 records<"}},
+		{"plain", "-42.1,147.2", []string{">1 record<"}},
+		{"web", "-42.1,147.2\n-41.5,146.5\n-41.2,146.0", []string{">3 records<"}},
+	}
+	for _, tt := range tests {
+		doc := legendMap(t, tt.mapType, tt.coords)
+		if !strings.Contains(doc, `<g id="legend"`) {
+			t.Errorf("%s map of %q has no legend", tt.mapType, tt.coords)
+		}
+		for _, label := range tt.want {
+			if !strings.Contains(doc, label) {
+				t.Errorf("%s map of %q has no %s in its legend", tt.mapType, tt.coords, label)
+			}
+		}
+	}
+}
+
+func TestNoSymbolLegendUnlessAsked(t *testing.T) {
+	doc, err := renderMap("Aus bus", "grid", "-42.1,147.2,1\n-41.5,146.5,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(doc, `<g id="legend"`) {
+		t.Error("legend drawn without being asked")
+	}
+}
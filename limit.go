@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// maxRecords is the largest number of records drawn on one map, set by -maxrecords, as
+// tens of thousands of points make enormous maps and tie up the server drawing them
+var maxRecords = 5000
+
+// limitRecords keeps the number of records within maxRecords. Data with too many records
+// has its duplicates merged, since large exports often hold many records of one locality,
+// and is only refused if that still leaves too many.
+func (data *mapData) limitRecords(records []record) ([]record, error) {
+	if maxRecords <= 0 || len(records) <= maxRecords {
+		return records, nil
+	}
+
+	total := len(records)
+	if !data.Dedupe {
+		merged, removed := dedupeRecords(records, defaultDedupePlaces)
+		if len(merged) <= maxRecords {
+			data.RawCoords = recordsText(merged)
+			data.Warnings = append(data.Warnings, fmt.Sprintf(
+				"%d records are more than the %d that can be mapped at once, so %d duplicate record(s) were merged",
+				total, maxRecords, removed))
+			return merged, nil
+		}
+	}
+	return nil, fmt.Errorf("There are %d records, more than the %d that can be mapped at once, "+
+		"even with duplicate records merged", total, maxRecords)
+}
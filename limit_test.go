@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// spreadCoords returns n distinct coordinates within Tasmania, one per line
+func spreadCoords(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "-%.4f,%.4f\n", 41.5+float64(i%100)*0.01, 146.0+float64(i/100)*0.01)
+	}
+	return b.String()
+}
+
+func TestRecordLimit(t *testing.T) {
+	defer func(n int) { maxRecords = n }(maxRecords)
+	maxRecords = 200
+
+	tests := []struct {
+		name    string
+		coords  string
+		records int
+		err     string
+		warning bool
+	}{
+		{"at the limit", spreadCoords(200), 200, "", false},
+		{"just over", spreadCoords(201), 0, "There are 201 records, more than the 200 that can be mapped at once", false},
+		{"over with duplicates", spreadCoords(150) + spreadCoords(150), 150, "", true},
+	}
+	for _, tt := range tests {
+		data := baseMapData("Aus bus", "plain", tt.coords, defaultZone)
+		_, records, err := mapSVG(context.Background(), data)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || len(records) != tt.records {
+			t.Errorf("%s: %d records drawn (%v), want %d", tt.name, len(records), err, tt.records)
+		}
+		if warned := strings.Contains(strings.Join(data.Warnings, "\n"), "300 records are more than the 200"); warned != tt.warning {
+			t.Errorf("%s: warnings %q", tt.name, data.Warnings)
+		}
+	}
+
+	maxRecords = 0
+	if _, records, err := mapSVG(context.Background(), baseMapData("", "plain", spreadCoords(300), defaultZone)); err != nil || len(records) != 300 {
+		t.Errorf("no limit: %d records drawn (%v)", len(records), err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// lineScanner returns a scanner over the lines of r that accepts lines as long as the
+// largest upload, so that a single long line can't cut the input short
+func lineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxUploadSize)
+	return scanner
+}
+
+// textLines steps through the lines of text held in a string in the way a bufio.Scanner
+// steps through a reader, but gives each line as a slice of the string rather than a
+// copy, so going through input already in memory allocates nothing per line. As with
+// bufio.ScanLines, a trailing carriage return is dropped from each line and a final
+// newline doesn't start another line.
+type textLines struct {
+	rest, line string
+}
+
+// newTextLines returns a textLines over the lines of text
+func newTextLines(text string) *textLines {
+	return &textLines{rest: text}
+}
+
+// Scan moves on to the next line, reporting false once there are none left
+func (tl *textLines) Scan() bool {
+	if tl.rest == "" {
+		return false
+	}
+	if i := strings.IndexByte(tl.rest, '\n'); i >= 0 {
+		tl.line, tl.rest = tl.rest[:i], tl.rest[i+1:]
+	} else {
+		tl.line, tl.rest = tl.rest, ""
+	}
+	tl.line = strings.TrimSuffix(tl.line, "\r")
+	return true
+}
+
+// Text returns the line Scan moved on to
+func (tl *textLines) Text() string {
+	return tl.line
+}
+
+// mapLines rewrites coords a line at a time into a single new string, without first
+// splitting the input into a slice of lines or copying each one. fn returns the new line
+// and whether it is kept. Both the input and the result are held in memory whole, as the
+// mapper takes its input as a single string.
+func mapLines(coords string, fn func(line string) (string, bool)) string {
+	var sb strings.Builder
+	sb.Grow(len(coords))
+	lines := newTextLines(coords)
+	first := true
+	for lines.Scan() {
+		line, keep := fn(lines.Text())
+		if !keep {
+			continue
+		}
+		if !first {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(line)
+		first = false
+	}
+	return sb.String()
+}
+
+// recordSeparators split a line that holds several records, as pasted by users who put all
+// their points on one line
+var recordSeparators = func(r rune) bool { return r == ';' || unicode.IsSpace(r) }
+
+// splitRecordLines puts each record on a line of its own where several were given on one
+// line separated by semicolons or spaces. A line is only split when every part of it is a
+// whole record by itself, so single records with semicolons or spaces between their fields,
+// such as 42°07'24"S 147°25'59"E or eastings and northings, are left alone. It returns the
+// number of lines split.
+func splitRecordLines(raw string) (string, int) {
+	if !strings.ContainsAny(raw, "; \t") {
+		return raw, 0
+	}
+	split := 0
+	raw = mapLines(raw, func(line string) (string, bool) {
+		if isComment(line) {
+			return line, true
+		}
+		if _, ok := taxonHeading(line); ok {
+			return line, true
+		}
+		parts := strings.FieldsFunc(line, recordSeparators)
+		if len(parts) < 2 {
+			return line, true
+		}
+		for _, part := range parts {
+			if _, ok := parseLine(part); !ok {
+				return line, true
+			}
+		}
+		split++
+		return strings.Join(parts, "\n"), true
+	})
+	return raw, split
+}
+
+// firstLine returns the first line of coords that isn't blank or a comment, reading no
+// further than it
+func firstLine(coords string) string {
+	lines := newTextLines(coords)
+	for lines.Scan() {
+		if line := lines.Text(); !isComment(line) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lineInputs are awkward inputs for going through text a line at a time
+var lineInputs = []string{
+	"", "\n", "\n\n", "-42.1,147.2", "-42.1,147.2\n", "-42.1,147.2\r\n-41.5,146.5\r\n", "a\rb\n",
+	"# comment\n\n-42.1,147.2\n  \n-41.5,146.5,1\n\n", "\n\n-42.1,147.2", strings.Repeat("x", 70000) + "\ny",
+}
+
+func TestTextLinesMatchScanner(t *testing.T) {
+	for _, in := range lineInputs {
+		var want, got []string
+		scanner := bufio.NewScanner(strings.NewReader(in))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			want = append(want, scanner.Text())
+		}
+		lines := newTextLines(in)
+		for lines.Scan() {
+			got = append(got, lines.Text())
+		}
+		if !equalStrings(got, want) {
+			t.Errorf("lines of %.20q are %q, want %q", in, got, want)
+		}
+	}
+}
+
+// splitStripComments is stripComments as it was written before mapLines, splitting the
+// input into a slice of lines
+func splitStripComments(coords string) string {
+	lines := strings.Split(coords, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !isComment(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func TestMapLinesMatchesSplit(t *testing.T) {
+	for _, in := range append(lineInputs[:5:5], lineInputs[6:]...) { // The split path kept carriage returns
+		if got, want := stripComments(in), splitStripComments(in); got != want {
+			t.Errorf("stripComments(%.20q) = %.20q, want %.20q", in, got, want)
+		}
+	}
+}
+
+// largeInput returns n lines of vouchered records
+func largeInput(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "-42.%04d,147.%04d,1\n# note %d\n", i%10000, i%9999, i)
+	}
+	return b.String()
+}
+
+func BenchmarkStripComments(b *testing.B) {
+	in := largeInput(50000)
+	b.Run("lines", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			stripComments(in)
+		}
+	})
+	b.Run("split", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			splitStripComments(in)
+		}
+	})
+}
+
+func TestSplitRecordLines(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+		split           int
+	}{
+		{"semicolons", "-42.1,147.2;-41.5,146.5;-41.2,146.9", "-42.1,147.2\n-41.5,146.5\n-41.2,146.9", 1},
+		{"spaces and vouchers", "-42.1,147.2,1 -41.5,146.5,0\n-41.2,146.9", "-42.1,147.2,1\n-41.5,146.5,0\n-41.2,146.9", 1},
+		{"separators together", "-42.1,147.2; -41.5,146.5;", "-42.1,147.2\n-41.5,146.5", 1},
+		{"one record", "-42.1,147.2", "-42.1,147.2", 0},
+		{"one record with a space", "-42.1, 147.2", "-42.1, 147.2", 0},
+		{"degrees, minutes and seconds", `42°07'24"S 147°25'59"E`, `42°07'24"S 147°25'59"E`, 0},
+		{"eastings and northings", "525000 5250000", "525000 5250000", 0},
+		{"comment", "# -42.1,147.2; -41.5,146.5", "# -42.1,147.2; -41.5,146.5", 0},
+		{"part not a record", "-42.1,147.2; near Hobart", "-42.1,147.2; near Hobart", 0},
+	}
+	for _, tt := range tests {
+		if got, split := splitRecordLines(tt.raw); got != tt.want || split != tt.split {
+			t.Errorf("%s: got %q with %d split, want %q with %d", tt.name, got, split, tt.want, tt.split)
+		}
+	}
+}
+
+func TestOneLineRecordsMatchLines(t *testing.T) {
+	lines := baseMapData("Aus bus", "plain", "-42.1,147.2,1\n-41.5,146.5,0\n-41.2,146.9,1", defaultZone)
+	oneLine := baseMapData("Aus bus", "plain", "-42.1,147.2,1; -41.5,146.5,0; -41.2,146.9,1", defaultZone)
+	if oneLine.RawCoords != lines.RawCoords || len(oneLine.Warnings) != 1 {
+		t.Errorf("one line read as %q with warnings %q, want %q", oneLine.RawCoords, oneLine.Warnings, lines.RawCoords)
+	}
+	_, want, err := mapSVG(context.Background(), lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := mapSVG(context.Background(), oneLine)
+	if err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("one line drew records %v (%v), want %v", got, err, want)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLocatorSize = 25 // Width of the locator map as a percentage of the map's width
+	minLocatorSize     = 10
+	maxLocatorSize     = 50
+	locatorMinExtent   = 30 // Smallest side in canvas pixels of the rectangle marking the area shown
+	locatorDetail      = 4  // Distance in canvas pixels the locator's outline may stray from the coastline
+)
+
+// locatorCorners are the corners of the map a locator map can be drawn in
+var locatorCorners = map[string]bool{"topleft": true, "topright": true, "bottomleft": true, "bottomright": true}
+
+// parseLocatorSize reads the width of a locator map as a percentage of the map's width,
+// limited to between minLocatorSize and maxLocatorSize, or defaultLocatorSize if it isn't a
+// number
+func parseLocatorSize(value string) int {
+	size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if err != nil || size <= 0 {
+		return defaultLocatorSize
+	}
+	if size < minLocatorSize {
+		return minLocatorSize
+	}
+	if size > maxLocatorSize {
+		return maxLocatorSize
+	}
+	return size
+}
+
+// parseLocatorCorner reads the corner a locator map is drawn in, the top right unless
+// another is named
+func parseLocatorCorner(value string) string {
+	corner := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(value))
+	if locatorCorners[corner] {
+		return corner
+	}
+	return "topright"
+}
+
+// locatorMap adds a small map of the whole region in a corner of a map that has been zoomed
+// in, with a rectangle marking the area the map shows, so that readers can see where it is.
+// The locator takes up size percent of the map's width. Maps that already show the whole
+// region are left as they are. The outline is drawn from the region's coastline in absolute
+// coordinates rather than as a scaled copy, so that it is also drawn on PNG maps.
+func locatorMap(reg *baseRegion, doc string, size int, corner string) string {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return doc
+	}
+	x0, _ := strconv.ParseFloat(m[1], 64)
+	y0, _ := strconv.ParseFloat(m[2], 64)
+	width, _ := strconv.ParseFloat(m[3], 64)
+	height, _ := strconv.ParseFloat(m[4], 64)
+	if x0 <= 0 && y0 <= 0 && x0+width >= canvasWidth && y0+height >= canvasHeight {
+		return doc
+	}
+
+	// The locator keeps the proportions of the canvas, and no more than half the map's height
+	w := width * float64(size) / 100
+	h := w * canvasHeight / canvasWidth
+	if h > height/2 {
+		h = height / 2
+		w = h * canvasWidth / canvasHeight
+	}
+	scale := w / canvasWidth
+	pad := width / 50
+	left, top := x0+width-w-pad, y0+pad
+	if strings.HasSuffix(corner, "left") {
+		left = x0 + pad
+	}
+	if strings.HasPrefix(corner, "bottom") {
+		top = y0 + height - h - pad
+	}
+	at := func(p pixel) (float64, float64) { return left + p.x*scale, top + p.y*scale }
+	stroke := width / 600
+
+	// The outline is simplified to a few canvas pixels, as that much of the coastline's
+	// detail is lost at the locator's scale
+	var path strings.Builder
+	for _, ring := range reg.outline() {
+		ring = simplifyRing(ring, locatorDetail)
+		for i, p := range ring {
+			x, y := at(p)
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f", cmd, x, y)
+		}
+		if ring != nil {
+			path.WriteString("Z")
+		}
+	}
+
+	// The area shown, kept to the canvas and large enough to be seen at the locator's scale
+	right, bottom := math.Min(x0+width, canvasWidth), math.Min(y0+height, canvasHeight)
+	fromX, fromY := math.Max(x0, 0), math.Max(y0, 0)
+	if grow := locatorMinExtent - (right - fromX); grow > 0 {
+		fromX, right = fromX-grow/2, right+grow/2
+	}
+	if grow := locatorMinExtent - (bottom - fromY); grow > 0 {
+		fromY, bottom = fromY-grow/2, bottom+grow/2
+	}
+	hx, hy := at(pixel{fromX, fromY})
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, `<g id="locator">`)
+	fmt.Fprintf(buf, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" "+
+		"style=\"fill:#ffffff;stroke:#808080;stroke-width:%.2f\" />\n", left, top, w, h, stroke)
+	fmt.Fprintf(buf, "<path d=\"%s\" style=\"fill:#e8e8e8;stroke:#000000;stroke-width:%.2f\" />\n", path.String(), stroke/2)
+	fmt.Fprintf(buf, "<rect id=\"locatorExtent\" x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" "+
+		"style=\"fill:none;stroke:#e31a1c;stroke-width:%.2f\" />\n", hx, hy, (right-fromX)*scale, (bottom-fromY)*scale, 2*stroke)
+	fmt.Fprintln(buf, "</g>")
+	return appendToSVG(doc, buf.String())
+}
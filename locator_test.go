@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var locatorRect = regexp.MustCompile(`<rect (?:id="(\w+)" )?x="([\d.-]+)" y="([\d.-]+)" width="([\d.]+)" height="([\d.]+)"`)
+
+// locatorMapDoc draws a map of a small cluster of records with a locator in the given
+// corner, zoomed to the records unless whole is set
+func locatorMapDoc(t *testing.T, corner string, whole bool) string {
+	t.Helper()
+	data := baseMapData("Aus bus", "plain", "-42.88,147.32\n-42.90,147.35\n-42.86,147.30", defaultZone)
+	data.Locator, data.LocatorSize, data.LocatorCorner, data.FitToData = true, defaultLocatorSize, corner, !whole
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// locatorRects returns the frame of the locator and the rectangle marking the area shown
+func locatorRects(doc string) [][]string {
+	start := strings.Index(doc, `<g id="locator">`)
+	if start < 0 {
+		return nil
+	}
+	return locatorRect.FindAllStringSubmatch(doc[start:], 2)
+}
+
+func TestLocatorOnZoomedMap(t *testing.T) {
+	doc := locatorMapDoc(t, "topright", false)
+	rects := locatorRects(doc)
+	if len(rects) != 2 || rects[1][1] != "locatorExtent" {
+		t.Fatalf("locator has rectangles %v", rects)
+	}
+	frame, extent := rects[0][2:], rects[1][2:]
+	if parseFloat(extent[0]) < parseFloat(frame[0]) || parseFloat(extent[1]) < parseFloat(frame[1]) ||
+		parseFloat(extent[0])+parseFloat(extent[2]) > parseFloat(frame[0])+parseFloat(frame[2]) ||
+		parseFloat(extent[1])+parseFloat(extent[3]) > parseFloat(frame[1])+parseFloat(frame[3]) {
+		t.Errorf("highlight %v lies outside the locator %v", extent, frame)
+	}
+
+	// On the right, unless the left is asked for
+	vb := viewBoxAttr.FindStringSubmatch(doc)
+	middle := parseFloat(vb[1]) + parseFloat(vb[3])/2
+	if parseFloat(frame[0]) < middle {
+		t.Errorf("top right locator drawn at x %s, left of the middle at %g", frame[0], middle)
+	}
+	if left := locatorRects(locatorMapDoc(t, "bottomleft", false)); left == nil || parseFloat(left[0][2]) > middle {
+		t.Errorf("bottom left locator drawn at %v", left)
+	}
+}
+
+func TestLocatorLeftOffWholeMap(t *testing.T) {
+	if doc := locatorMapDoc(t, "topright", true); strings.Contains(doc, `id="locator"`) {
+		t.Error("map of the whole region has a locator")
+	}
+	for value, want := range map[string]int{"": defaultLocatorSize, "30%": 30, "5": minLocatorSize, "90": maxLocatorSize} {
+		if got := parseLocatorSize(value); got != want {
+			t.Errorf("parseLocatorSize(%q) = %d, want %d", value, got, want)
+		}
+	}
+	for value, want := range map[string]string{"": "topright", "Bottom Left": "bottomleft", "top-left": "topleft", "middle": "topright"} {
+		if got := parseLocatorCorner(value); got != want {
+			t.Errorf("parseLocatorCorner(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
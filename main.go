@@ -2,15 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"html"
-	htmt "html/template"
+	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
-	text "text/template"
+	"time"
 
 	mapper "github.com/kurankat/tasmapper"
 )
@@ -18,12 +23,82 @@ import (
 var accessLog log.Logger
 var errorLog log.Logger
 
+// assetsDir is a directory to read the page templates and stylesheet from instead of the
+// ones built in, set by -assets
+var assetsDir string
+
+// envOr returns the value of the environment variable key, or def if it isn't set
+func envOr(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+// checkAssetsDir reports an assets directory given with -assets that doesn't exist, so the
+// server stops at startup rather than on its first page
+func checkAssetsDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("assets directory %q not found", dir)
+	}
+	return nil
+}
+
 // The main structure to hold map-related data.
 type mapData struct {
-	TaxonName string
-	MapType   string
-	RawCoords string
-	SVGmap    string
+	TaxonName     string
+	MapType       string
+	RawCoords     string
+	SVGmap        string
+	Thumbnail     string   // Small copy of the map for the results page
+	Reference     string   // Coordinate that distances are measured from on distance maps
+	ShowReference bool     // Whether the reference coordinate is drawn on distance maps
+	Layers        bool     // Whether the map is split into named layers for editing
+	SnapToLand    bool     // Whether points just offshore are moved onto land
+	SnapTolerance float64  // Distance in km from the coast within which points are snapped
+	Warnings      []string // Notes for the user about changes made to their data
+	Sources       []dataSource
+	Margin        float64       // Empty border in pixels added around the map
+	MapID         string        // Id the generated map can be downloaded with from "/mapfile"
+	ScaleBar      bool          // Whether a scale bar is drawn on the map
+	NorthArrow    bool          // Whether a north arrow is drawn on the map
+	Legend        bool          // Whether maps without a legend of their own get a legend of their symbols
+	FitToData     bool          // Whether the map is zoomed in to frame the records
+	PlotOutside   bool          // Whether records outside the area covered by the map are plotted anyway
+	PlotSea       bool          // Whether records that fall in the sea are plotted anyway
+	Width, Height int           // Size in pixels the map is shown at, 0 to fit what it is placed in
+	FullDetail    bool          // Whether the coastline is kept in full rather than simplified to what the map can show
+	Dedupe        bool          // Whether records at the same locality are merged
+	DedupePlaces  int           // Decimal places coordinates are rounded to when merging duplicates
+	ClusterKm     float64       // Distance in km within which records are merged into one point, 0 for none
+	ScaleByCount  bool          // Whether points are sized by the number of records merged into them
+	KeepOrder     bool          // Whether coordinates that look reversed are left in the order given
+	CellKm        float64       // Side of the cells of grid maps in km
+	Precision     int           // Decimal places coordinates are rounded to
+	Zone          int           // UTM zone that eastings and northings are given in
+	YearFrom      int           // First year of the records mapped, 0 for no limit
+	YearTo        int           // Last year of the records mapped, 0 for no limit
+	Undated       bool          // Whether records without a date are mapped when limiting the years
+	Bounds        bounds        // Box of latitudes and longitudes the records mapped are limited to
+	ClipToBounds  bool          // Whether the map is cropped to Bounds
+	MarkerColour  string        // Hex colour of the markers, black if empty
+	ObsColour     string        // Hex colour of observations on voucher maps, the marker colour if empty
+	MarkerRadius  int           // Radius in pixels of the markers, the mapper's own if 0
+	Title         bool          // Whether the taxon name is written above the map
+	Thin          bool          // Whether the points of plain maps of many records are thinned
+	Graticule     bool          // Whether lines of latitude and longitude are drawn
+	GraticuleStep float64       // Degrees between the lines of latitude and longitude
+	Locator       bool          // Whether zoomed-in maps show where they are on a small map of the region
+	LocatorSize   int           // Width of the locator map as a percentage of the map's width
+	LocatorCorner string        // Corner the locator map is drawn in
+	Theme         string        // Name of the colour theme the map is drawn in
+	Region        string        // Name of the base region records are placed in, Tasmania unless set
+	Attribution   string        // Data source credited below the map, if any
+	CategoryKey   string        // Legend definition fixing the order and colours of categories
+	Summary       recordSummary // Figures about the records drawn, shown beside the map
 }
 
 // svgMap contains data specific to the generated SVG map to be served.
@@ -31,174 +106,753 @@ type svgMap struct {
 	mapName string
 	mapType string
 	svgMap  string
+	created time.Time
+	taxon   string   // Taxon the map was drawn for, as escaped for display
+	records []record // Records drawn on the map, for exporting
+	input   pageText // Form values the map was drawn from, for editing them
+	places  int      // Decimal places localities are told apart to, for exporting
 }
 
 // newMapData creates and initialises a mapData structure to hold data pertaining to the map
 // being drawn, after cleaning up the user input
 func newMapData(r *http.Request) (data *mapData) {
-	data = new(mapData)
+	data = baseMapData(r.FormValue("taxon"), r.FormValue("maptype"), r.FormValue("coordinates"),
+		parseZone(r.FormValue("zone")))
+	if data.RawCoords != "" {
+		data.Sources = []dataSource{{"typed", data.RawCoords}}
+	}
+	data.Reference = cleanCoords(r.FormValue("reference"))
+	data.ShowReference = r.FormValue("showref") != ""
+	data.Layers = r.FormValue("layers") != ""
+	data.SnapToLand = r.FormValue("snap") != ""
+	data.Margin = parseMargin(r.FormValue("margin"))
+	data.ScaleBar = r.FormValue("scalebar") != ""
+	data.NorthArrow = r.FormValue("northarrow") != ""
+	data.Legend = r.FormValue("legend") != ""
+	data.FitToData = r.FormValue("fit") != ""
+	data.PlotOutside = r.FormValue("plotoutside") != ""
+	data.PlotSea = r.FormValue("plotsea") != ""
+	data.Width = parseSize(r.FormValue("width"))
+	data.Height = parseSize(r.FormValue("height"))
+	data.FullDetail = r.FormValue("fulldetail") != ""
+	data.Dedupe = r.FormValue("dedupe") != ""
+	data.ClusterKm = parseClusterKm(r.FormValue("clusterkm"))
+	data.ScaleByCount = r.FormValue("scalecount") != ""
+	data.KeepOrder = r.FormValue("keeporder") != ""
+	data.CellKm = parseCellSize(r.FormValue("cellsize"))
+	data.Precision = parsePrecision(r.FormValue("precision"))
+	data.YearFrom, data.YearTo = parseYear(r.FormValue("from")), parseYear(r.FormValue("to"))
+	data.Undated = r.FormValue("undated") != ""
+	data.Bounds = parseBounds(r.FormValue("minlat"), r.FormValue("minlon"), r.FormValue("maxlat"), r.FormValue("maxlon"))
+	data.ClipToBounds = r.FormValue("clip") != ""
+	data.MarkerColour, data.ObsColour = r.FormValue("markercolour"), r.FormValue("obscolour")
+	data.MarkerRadius = parseRadius(r.FormValue("markerradius"))
+	data.Title = r.FormValue("caption") != ""
+	data.Thin = r.FormValue("thin") != ""
+	data.Graticule = r.FormValue("graticule") != ""
+	data.GraticuleStep = parseGraticuleStep(r.FormValue("graticulestep"))
+	data.Locator = r.FormValue("locator") != ""
+	data.LocatorSize = parseLocatorSize(r.FormValue("locatorsize"))
+	data.LocatorCorner = parseLocatorCorner(r.FormValue("corner"))
+	data.Theme = parseTheme(r.FormValue("theme"))
+	data.Attribution = r.FormValue("attribution")
+	data.CategoryKey = r.FormValue("categorylegend")
+
+	if places, err := strconv.Atoi(r.FormValue("dedupeplaces")); err == nil && places >= 0 {
+		data.DedupePlaces = int(math.Min(float64(places), maxDedupePlaces))
+	}
 
-	data.TaxonName = html.EscapeString(r.FormValue("taxon"))
-	data.MapType = r.FormValue("maptype")
-	data.RawCoords = html.EscapeString(strings.TrimSpace(strings.ReplaceAll(r.FormValue("coordinates"), " ", "")))
+	if tol, err := strconv.ParseFloat(r.FormValue("snaptolerance"), 64); err == nil && tol >= 0 {
+		data.SnapTolerance = math.Min(tol, maxSnapTolerance)
+	}
 
 	return data
 }
 
-// mapSVG creates an SVG map with the data provided
-func mapSVG(data *mapData) string {
-	firstRecord := strings.TrimSpace(strings.Split(data.RawCoords, "\n")[0]) // Split first line to identify type of coords given
-	mapBuffer := new(bytes.Buffer)                                           // Create a new buffer to hold the map
+// lineEndings converts Windows and old Mac line endings to newlines
+var lineEndings = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// cleanCoords converts any degrees, minutes and seconds with hemisphere letters to decimal,
+// converts semicolon and tab separated lines to commas, removes spaces and surrounding
+// whitespace from raw coordinate input and escapes it so it is safe to echo back to the
+// user. Line endings are normalised and any byte order mark left by a spreadsheet is
+// dropped first. Taxon header lines keep their spaces.
+func cleanCoords(raw string) string {
+	raw = lineEndings.Replace(strings.TrimPrefix(raw, "\uFEFF"))
+	raw = mapLines(normaliseDelimiters(convertDMS(raw)), func(line string) (string, bool) {
+		if name, ok := taxonHeading(line); ok { // Taxon names keep the spaces between their words
+			return "## " + name, true
+		}
+		return strings.ReplaceAll(line, " ", ""), true
+	})
+	return html.EscapeString(strings.TrimSpace(raw))
+}
+
+// errNoCoordinates is given for a request without a single coordinate in it, not even a
+// comment
+var errNoCoordinates = errors.New("Please enter at least one coordinate")
+
+// knownMapTypes are the values of maptype that can be drawn
+var knownMapTypes = map[string]bool{
+	"grid": true, "plain": true, "web": true, "region": true, "arrow": true, "distance": true, "source": true,
+	"heat": true, "category": true, "proportional": true,
+}
+
+// errNoMapType is given for a request that doesn't say which type of map to draw
+var errNoMapType = errors.New("Please select a map type")
+
+// checkMapType reports whether a map of the given type can be drawn, before any time is
+// spent reading the data for it
+func checkMapType(mapType string) error {
+	if mapType == "" {
+		return errNoMapType
+	}
+	if !knownMapTypes[mapType] {
+		return fmt.Errorf("Unknown map type %q", mapType)
+	}
+	return nil
+}
+
+// usesVouchers reports whether maps of a type tell vouchered specimens from observations.
+// Every other type maps records the same whatever their voucher status.
+func usesVouchers(mapType string) bool {
+	return mapType == "grid"
+}
+
+// parsedMap holds the user's data parsed once, ready to draw any type of map from
+type parsedMap struct {
+	rl        *mapper.RecordList // Records as read by the mapper, nil if it can't read them
+	positions *mapper.RecordList // Record positions only, for maps that ignore the last field
+	records   []record           // Records as read by the server, for the maps it draws itself
+	vouchered bool               // Whether the data includes voucher status
+	empty     bool               // Whether the data holds nothing but blank lines and comments
+	markers   markerStyle        // Colour and size the records are drawn in
+	legend    []legendEntry      // Categories listed first in the legend of category maps
+	err       error              // Why the data can't be mapped at all, such as having too many records
+}
+
+// parseMapData prepares the user's coordinates for drawing maps from. Reading them gives
+// up with errTooComplex, left in the err of the result, once ctx is done.
+func parseMapData(ctx context.Context, data *mapData) *parsedMap {
+	reg := data.region()
+	if !data.KeepOrder { // Put longitude first coordinates the right way round before anything reads them
+		data.fixSourceOrder()
+	}
+	firstRecord, _ := splitFocal(firstLine(data.RawCoords))
+	firstRecord, _, _, _ = splitExtras(firstRecord) // The first line identifies the type of coords given
 
 	// Regular expressions allow 0 to 10 decimal figures in the lat and
 	// Match pattern for records that contain voucher information: lat(decimal),long(decimal),voucherinfo(integer)
 	voucherPattern, _ := regexp.MatchString(`^(-?[34][90123](\.\d{0,10})?,14[45678](\.\d{0,10})?,[av01]|\-?[34][90123],([0123456])?\d,(([0123456])?\d(\.\d{1,2})?)?,14[5678],([0123456])?\d,(([0123456])?\d(\.\d{1,2})?)?,[av01])$`, firstRecord)
 
-	rl := mapper.NewRecordList(data.RawCoords, data.TaxonName)
+	// Check every line before snapping rewrites them
+	problems, err := validateLines(ctx, reg, data.RawCoords, voucherPattern, usesVouchers(data.MapType), data.PlotOutside)
+	if err != nil {
+		return &parsedMap{err: err}
+	}
+	data.RawCoords = dropImpossible(data.RawCoords)
+	records := data.sourceRecords()
+	if err := checkDeadline(ctx); err != nil {
+		return &parsedMap{err: err}
+	}
+	if warning := singleFocal(records); warning != "" {
+		data.Warnings = append(data.Warnings, warning)
+	}
+	if data.Precision > 0 {
+		roundRecords(records, data.Precision)
+	}
+	if data.YearFrom != 0 || data.YearTo != 0 { // Only map the records from the years asked for
+		var warning string
+		records, warning = filterByYear(records, data.YearFrom, data.YearTo, data.Undated)
+		if warning != "" {
+			data.RawCoords = recordsText(records)
+			data.Warnings = append(data.Warnings, warning)
+		}
+	}
+	var boundsErr error
+	if data.Bounds.set { // Only map the records inside the box asked for
+		var warning string
+		before := len(records)
+		records, warning = filterByBounds(records, data.Bounds)
+		if warning != "" {
+			data.RawCoords = recordsText(records)
+			data.Warnings = append(data.Warnings, warning)
+		}
+		if len(records) == 0 && before > 0 {
+			boundsErr = fmt.Errorf("No records are in range of %s", data.Bounds)
+		}
+	}
+	if voucherPattern {
+		records = fillVouchers(records)
+		data.RawCoords = recordsText(records)
+	}
+	if !data.PlotOutside { // Leave out records that would be drawn off the map or somewhere misleading
+		var inside []record
+		for _, rec := range records {
+			if insideMap(reg, rec) {
+				inside = append(inside, rec)
+			}
+		}
+		if len(inside) < len(records) {
+			records = inside
+			data.RawCoords = recordsText(records)
+		}
+	}
+	if !data.SnapToLand { // Snapping deals with records at sea itself
+		kept, offshore, err := seaRecords(ctx, reg, records, data.PlotSea)
+		if err != nil {
+			return &parsedMap{err: err}
+		}
+		if len(kept) < len(records) {
+			records = kept
+			data.RawCoords = recordsText(records)
+		}
+		data.Warnings = append(data.Warnings, offshore...)
+	}
+	if data.SnapToLand { // Move near-shore points onto land before anything else looks at them
+		var res snapResult
+		if records, res, err = snapToLand(ctx, reg, records, data.SnapTolerance); err != nil {
+			return &parsedMap{err: err}
+		}
+		data.RawCoords = recordsText(records)
+		data.Warnings = append(data.Warnings, res.warnings()...)
+	}
+
+	if data.Dedupe {
+		var removed int
+		records, removed = dedupeRecords(records, data.DedupePlaces)
+		if removed > 0 {
+			data.RawCoords = recordsText(records)
+			data.Warnings = append(data.Warnings, fmt.Sprintf("%d duplicate record(s) were merged", removed))
+		}
+	}
+	if data.ClusterKm > 0 { // Nearby records that dedupe would keep apart are merged too
+		var merged int
+		if records, merged = clusterRecords(records, data.ClusterKm); merged > 0 {
+			data.RawCoords = recordsText(records)
+			data.Warnings = append(data.Warnings,
+				fmt.Sprintf("%d record(s) within %g km of another were merged into nearby points", merged, data.ClusterKm))
+		}
+	}
+	if data.Thin && data.MapType == "plain" { // Dense data is thinned rather than refused or drawn as a blot
+		var warning string
+		if records, warning = thinPoints(reg, records); warning != "" {
+			data.RawCoords = recordsText(records)
+			data.Warnings = append(data.Warnings, warning)
+		}
+	}
 
+	if err := checkDeadline(ctx); err != nil { // Merging and thinning may have used up the time
+		return &parsedMap{err: err}
+	}
+	p := &parsedMap{vouchered: voucherPattern, empty: firstRecord == ""}
+	data.Warnings = append(data.Warnings, problems...)
+	if p.err = boundsErr; p.err != nil {
+		return p
+	}
+	if p.markers, p.err = data.markers(); p.err != nil {
+		return p
+	}
+	if p.legend, p.err = parseCategoryLegend(data.CategoryKey); p.err != nil {
+		return p
+	}
+	if records, p.err = data.limitRecords(records); p.err != nil {
+		return p // Nothing is drawn, so there is no need to read the records any further
+	}
+	// The mapper escapes the taxon name itself when it writes it on the map, so it is given
+	// the name as entered rather than escaped a second time
+	taxon := html.UnescapeString(data.TaxonName)
+	p.rl = mapper.NewRecordList(stripComments(stripExtras(data.RawCoords)), taxon)
+	p.records = records
+	if len(p.records) > 0 {
+		p.positions = mapper.NewRecordList(recordsText(positionsOnly(p.records)), taxon)
+	}
+	return p
+}
+
+// mapSVG creates an SVG map with the data provided, returning it with the records drawn on
+// it. A map drawn for an identical earlier request is reused along with the warnings it
+// gave. Reading the data and drawing stop with errTooComplex once ctx is done.
+func mapSVG(ctx context.Context, data *mapData) (string, []record, error) {
+	if strings.TrimSpace(data.RawCoords) == "" {
+		return "", nil, errNoCoordinates
+	}
+	if err := checkMapType(data.MapType); err != nil {
+		return "", nil, err
+	}
+	key := cacheKey(data)
+	if m, ok := renderCache.get(key); ok {
+		data.Warnings = append(data.Warnings, m.warnings...)
+		return m.svg, m.records, nil
+	}
+
+	before := len(data.Warnings) // Only warnings about drawing the map are kept with it
+	p := parseMapData(ctx, data)
+	svgMap, err := drawMap(ctx, data, p, data.MapType)
+	if err != nil {
+		return "", nil, err
+	}
+	renderCache.add(&cachedMap{key: key, svg: svgMap, records: p.records, warnings: data.Warnings[before:]})
+	return svgMap, p.records, nil
+}
+
+// drawMap draws a map of the given type from data that has already been parsed. It checks
+// between each stage of drawing whether ctx is done, giving up with errTooComplex if so.
+// Every map drawn or given up on is counted in metrics.
+func drawMap(ctx context.Context, data *mapData, p *parsedMap, mapType string) (svgMap string, err error) {
+	start := time.Now()
+	defer func() { metrics.record(mapType, time.Since(start), err) }()
+	reg := data.region()
+	if p.err != nil {
+		return "", p.err
+	}
+	if err := checkDeadline(ctx); err != nil { // Parsing may have used up the time already
+		return "", err
+	}
+	mapBuffer := new(bytes.Buffer) // Create a new buffer to hold the map
+
+	rl := p.rl
+	if mapType == "arrow" { // The mapper can't read bearings, so only give it the positions
+		rl = p.positions
+	} else if !usesVouchers(mapType) && p.positions != nil { // Nor leave out records for their voucher status
+		rl = p.positions
+	}
+
+	if p.empty {
+		return "", errors.New("No coordinates were found, only blank lines and comments")
+	}
 	if rl == nil {
-		return "None of the data can be mapped"
+		debugParseFailure(data, "svg")
+		return "", errors.New("None of the data can be mapped")
+	}
+
+	if err := mapperDraw(ctx, reg, data, p, rl, mapType, mapBuffer); err != nil {
+		return "", err
 	}
 
-	switch data.MapType { // Select map type to draw depending on user input on page
+	if err := checkDeadline(ctx); err != nil {
+		return "", err
+	}
+	theme := data.theme()
+	doc := themeOutline(restyleDots(mapBuffer.String(), p.markers), theme)
+	pointMap := mapType == "plain" || mapType == "web"
+	byTaxon := pointMap && multiTaxon(p.records) // Taxa maps draw their own markers and legend
+	// Web maps are viewed on screen, so their points show tooltips
+	if mapType == "web" && !byTaxon {
+		doc = webPoints(reg, doc, p.records, data.ScaleByCount, p.markers)
+	} else if data.ScaleByCount && pointMap && !byTaxon {
+		doc = countMarkers(reg, doc, p.records, p.markers)
+	}
+	if focal := focalMarker(reg, p.records, p.markers, theme); focal != "" { // Drawn over every other record
+		doc = appendToSVG(doc, focal)
+	}
+	if err := checkDeadline(ctx); err != nil {
+		return "", err
+	}
+	if data.Graticule { // Beneath the title box, like the gridlines of grid maps
+		doc = insertBeforeGroup(doc, "infoBox", graticule(reg, data.GraticuleStep, theme))
+	}
+	if data.ClipToBounds && data.Bounds.set { // Show only the box the records were limited to
+		doc = clipToBounds(reg, doc, data.Bounds, data.Margin)
+	} else if data.FitToData { // The margin is then kept around the records rather than the whole map
+		doc = fitToData(reg, doc, p.records, data.Margin)
+	} else {
+		doc = addMargin(doc, data.Margin)
+	}
+	if data.Legend && symbolLegendTypes[mapType] && !byTaxon { // Placed from the area the map now shows
+		doc = symbolLegend(doc, p.records, mapType == "grid" && p.vouchered, p.markers)
+	}
+	if data.ScaleBar || data.NorthArrow {
+		doc = mapDecorations(doc, data.ScaleBar, data.NorthArrow)
+	}
+	if data.Locator { // Drawn inside the frame, after it has been zoomed
+		doc = locatorMap(reg, doc, data.LocatorSize, data.LocatorCorner)
+	}
+	title := ""
+	if data.Title { // Captions go outside any margin, so they stay clear of the map
+		title = data.TaxonName
+	}
+	doc = captionMap(doc, title, data.Attribution)
+	if theme.greyscale { // Once everything is drawn, captions included
+		doc = greyscaleSVG(doc)
+	}
+	if !data.FullDetail { // Small maps can't show the coastline's full detail
+		doc = simplifyOutline(doc, data.Width, data.Height)
+	}
+	doc = setSize(doc, data.Width, data.Height)
+	if data.Layers {
+		doc = layeredSVG(doc)
+	}
+	return addMetadata(doc, data.TaxonName, mapType, p.records), nil
+}
+
+// mapperDraw draws the map of the given type with the mapper into w. The mapper is held only
+// while it draws, so the rest of the work on a map is done alongside other maps.
+func mapperDraw(ctx context.Context, reg *baseRegion, data *mapData, p *parsedMap, rl *mapper.RecordList, mapType string, w *bytes.Buffer) error {
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	if err := checkDeadline(ctx); err != nil { // The time may have run out waiting for other maps
+		return err
+	}
+
+	switch mapType { // Select map type to draw depending on user input on page
 	case "grid": // for grid maps
-		if voucherPattern { // draw a map with solid circles for vouchered specimens
-			mapper.VoucherMap(rl, mapBuffer) // and empty circles for anecdotal records
+		if data.CellKm != defaultCellKm && data.CellKm != 0 { // Cells of another size are drawn by the server
+			cellGridMap(reg, rl, p.records, p.vouchered, data.CellKm, w)
+		} else if err := drawRecordList(rl, mapType, w, withVouchers(p.vouchered)); err != nil {
+			return err // Solid circles for vouchered specimens, empty ones for anecdotal records
+		}
+	case "plain", "web":
+		if multiTaxon(p.records) { // Several taxa are told apart by colour and shape
+			taxaMap(reg, rl, p.records, w)
+		} else if err := drawRecordList(rl, mapType, w); err != nil {
+			return err
+		}
+	case "region":
+		choroplethMap(reg, rl, p.records, w)
+	case "arrow":
+		arrowMap(reg, rl, p.records, w)
+	case "distance":
+		ref, ok := parseLine(data.Reference)
+		if !ok {
+			return errors.New("The reference coordinate can't be interpreted")
+		}
+		distanceMap(reg, rl, p.records, ref, data.ShowReference, w)
+	case "source":
+		sourceMap(reg, rl, p.records, w)
+	case "heat":
+		heatMap(reg, rl, p.records, w)
+	case "proportional":
+		places := defaultDedupePlaces
+		if data.Dedupe { // Localities are as close as the user chose for merging duplicates
+			places = data.DedupePlaces
+		}
+		proportionalMap(reg, rl, p.records, places, w)
+	case "category":
+		if hasCategories(p.records) {
+			categoryMap(reg, p.positions, p.records, p.legend, w) // The positions are always readable by the mapper
 		} else {
-			mapper.GridMap(rl, mapBuffer) // and a plain grid map for lat,long data
+			mapper.ExactMap(rl, w)
 		}
-	case "plain":
-		mapper.ExactMap(rl, mapBuffer)
-	case "web":
-		mapper.WebMap(rl, mapBuffer)
+	default:
+		return checkMapType(mapType)
 	}
-
-	return mapBuffer.String()
+	return nil
 }
 
 // ### Below are the three handlers for the three separate pages that are served ###
 
-// mapAsFile will serve the SVG map as a file rather than inline, if a map
-// file is in memory
-func (svm *svgMap) mapAsFile(w http.ResponseWriter, r *http.Request) {
-	if svm.svgMap == "" { // If the URL for mapfile is accessed directly, return error message
+// mapAsFile will serve the SVG map generated for a request, given "?id=" with the
+// id from the results page, as a file rather than inline. With "&tiles=2x2" the map is split
+// into tiles served as a zip, with "&format=png" it is drawn as a PNG image at "&dpi=", and
+// with "&format=pdf" it is converted to a PDF. SVG maps are minified unless "&pretty=1" is
+// given.
+func (ms *mapStore) mapAsFile(w http.ResponseWriter, r *http.Request) {
+	svm, ok := ms.get(r.FormValue("id"))
+	if !ok { // If the URL for mapfile is accessed directly or the map has expired, return error message
 		errorLog.Println("Attempt to access map from memory before a map is generated")
-		fmt.Fprint(w, "There is no map in memory")
+		writeError(w, r, http.StatusNotFound, "There is no map in memory. Please generate a map first.")
+	} else if tiles := r.FormValue("tiles"); tiles != "" { // Serve the map split into tiles
+		svm.serveTiles(w, tiles)
+	} else if r.FormValue("format") == "png" { // Serve the map drawn as an image
+		svm.servePNG(w, r.FormValue("dpi"))
+	} else if r.FormValue("format") == "pdf" { // Serve the map as a PDF for printing
+		svm.servePDF(w)
 	} else { // If there is a map in memory, serve it as an SVG image with calculated filename
-		fileName := fmt.Sprintf("attachment; filename=%s", svm.mapName)
 		w.Header().Set("Content-Type", "image/svg+xml")
-		w.Header().Set("Content-Disposition", fileName)
-		fmt.Fprint(w, svm.svgMap)
-	}
-}
-
-// parsingError checks whether the templates can be parsed correctly and stops
-// execution of subroutine if they can't.
-// Work on better handling this so the user is returned to "/"
-func parsingError(err error, w http.ResponseWriter, filename string) {
-	if err != nil {
-		fmt.Fprintf(w, "<h1>Map could not be rendered</h1><p>Error parsing template file: %s</p>", filename)
-		errorLog.Printf("Error parsing template file: %s", filename)
+		setAttachment(w, svm.mapName)
+		doc := svm.svgMap
+		if minifyDownloads && r.FormValue("pretty") != "1" {
+			doc = minifySVG(doc)
+		}
+		writeDownload(w, r, doc)
 	}
 }
 
 // mapDisplay handles displaying a page with results, including the generated map
-// as inline SVG. A reference to an svgMap object serves for data sharing
-func (svm *svgMap) mapDisplay(w http.ResponseWriter, r *http.Request) {
+// as inline SVG. The map is kept in ms so that it can be downloaded afterwards. A GET
+// request with coordinates in its query is answered with the map alone.
+func (ms *mapStore) mapDisplay(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") { // The form includes a CSV file
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			serveError(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("The uploaded file could not be read. Files can be at most %d MB.", maxUploadSize>>20))
+			return
+		}
+	}
 	r.ParseForm() // Parse all the form information
 
 	if r.Method == "POST" { // If the request is a form submission
 		// Create a new mapData object and populate its variables from user input
 		data := newMapData(r)
-		pageTitle := "Preview map for " + data.TaxonName
-		svm.mapType = data.MapType
-		svm.mapName = strings.ReplaceAll(strings.ToLower(data.TaxonName), " ", "-") +
-			"." + svm.mapType + ".svg"
-		svm.svgMap = mapSVG(data)
-		data.SVGmap = svm.svgMap
-
-		// Parse the various page templates and execute them in succession to build the page html.
-		head, err := htmt.ParseFiles("assets/head.html")
-		if err == nil {
-			head.Execute(w, pageTitle)
-		} else {
-			parsingError(err, w, "head.html")
+		if !addCSVFile(w, r, data) {
+			return
 		}
-
-		header, err := htmt.ParseFiles("assets/header.html")
-		if err == nil {
-			header.Execute(w, data)
-		} else {
-			parsingError(err, w, "header.html")
+		if strings.TrimSpace(data.RawCoords) == "" { // Nothing was entered, so there is nothing to correct either
+			serveForm(w, http.StatusBadRequest, pageText{
+				"taxon":   html.UnescapeString(data.TaxonName),
+				"maptype": data.MapType,
+				"notice":  errNoCoordinates.Error() + " to draw a map.",
+			})
+			return
 		}
-		body, err := text.ParseFiles("assets/svg.html")
-		if err == nil {
-			body.Execute(w, data)
-		} else {
-			parsingError(err, w, "svg.html")
+		if r.FormValue("format") == "ascii" { // Serve a plain text map for terminals instead
+			serveASCII(w, r, data)
+			return
 		}
-		footer, err := htmt.ParseFiles("assets/footer.html")
-		if err == nil {
-			footer.Execute(w, data)
-		} else {
-			parsingError(err, w, "footer.html")
+		if types := compositeTypes(r); len(types) > 0 { // Serve several map types together
+			serveComposite(w, r, data, types)
+			return
 		}
+		if err := checkMapType(data.MapType); err != nil { // The coordinates are fine, so the form is kept as it was
+			serveForm(w, http.StatusBadRequest, pageText{
+				"taxon":       html.UnescapeString(data.TaxonName),
+				"coordinates": html.UnescapeString(data.RawCoords),
+				"notice":      err.Error() + ".",
+			})
+			return
+		}
+		ms.showMap(w, r, data)
+	} else if r.Method == "GET" && hasQueryMap(r) { // A link to a map, drawn straight from its URL
+		serveQueryMap(w, r)
 	} else {
 		http.Redirect(w, r, "/", http.StatusMovedPermanently)
 	}
 }
 
-// dataEntry handles requests to the main page and presents a form for data entry.
-// Form submission directs user to "/map", where the SVG map will be rendered
-func dataEntry(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+// mapFileName returns the name a map of the given taxon and type is downloaded as. Maps
+// drawn without a taxon name are simply named "map".
+func mapFileName(taxon, mapType string) string {
+	return safeFileName(taxon) + "." + mapType + ".svg"
+}
+
+// showMap generates the map described by data, keeps it in memory for download
+// and renders the results page. If no map can be drawn the user is returned to the
+// form with their input, to correct it.
+func (ms *mapStore) showMap(w http.ResponseWriter, r *http.Request, data *mapData) {
+	pageTitle := "Preview map for " + data.TaxonName
+	svm := &svgMap{mapType: data.MapType}
+	svm.mapName = mapFileName(data.TaxonName, svm.mapType)
+	svm.input = pageText{ // Taken before drawing changes the coordinates
+		"taxon":       html.UnescapeString(data.TaxonName),
+		"maptype":     data.MapType,
+		"coordinates": html.UnescapeString(data.RawCoords),
+	}
 
-	// Normal requests to this page should be GET. If so, process the dataEntry template and serve it.
-	if r.Method == "GET" {
-		pageText := map[string]string{
-			"title":           "Data entry form",
-			"placeHolderText": "Please enter comma-separated latitude and longitude. You can use decimal degrees or degrees, minutes, seconds.",
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	svgMap, records, err := mapSVG(ctx, data)
+	if err != nil { // The form is refilled with the input as it was sent, not as drawing left it
+		text := pageText{"error": err.Error(), "problems": unescapeAll(data.Warnings)}
+		for k, v := range svm.input {
+			text[k] = v
 		}
+		serveForm(w, renderStatus(err), text)
+		return
+	}
+	svm.svgMap, svm.taxon, svm.records = svgMap, data.TaxonName, records
+	places := defaultDedupePlaces
+	if data.Dedupe {
+		places = data.DedupePlaces
+	}
+	svm.places = places
+	data.Summary = summariseRecords(records, places)
+	data.SVGmap, data.Thumbnail = svm.svgMap, thumbnailSVG(svm.svgMap)
+	data.MapID = ms.add(svm)
+
+	pages, err := loadTemplates()
+	if err != nil {
+		errorLog.Printf("Error parsing map page templates: %s", err)
+		serveError(w, http.StatusInternalServerError, "")
+		return
+	}
 
-		head, err := htmt.ParseFiles("assets/head.html")
-		parsingError(err, w, "head.html")
-		head.Execute(w, pageText["title"])
+	// Execute the various page templates in succession to build the page html.
+	if err := pages.render(w, http.StatusOK, "svg.html", pageLayout{Title: pageTitle, Body: data}); err != nil {
+		serveError(w, http.StatusInternalServerError, "")
+	}
+}
 
-		header, err := htmt.ParseFiles("assets/header.html")
-		parsingError(err, w, "header.html")
-		header.Execute(w, nil)
+// unescapeAll reverses the escaping of user input in messages, for templates that escape
+// the messages themselves
+func unescapeAll(messages []string) []string {
+	out := make([]string, len(messages))
+	for i, msg := range messages {
+		out[i] = html.UnescapeString(msg)
+	}
+	return out
+}
 
-		body, err := htmt.ParseFiles("assets/dataEntry.html")
-		parsingError(err, w, "dataEntry.html")
-		body.Execute(w, pageText)
+// pageText holds the values shown on the data entry form
+type pageText map[string]interface{}
 
-		footer, err := htmt.ParseFiles("assets/footer.html")
-		parsingError(err, w, "footer.html")
-		footer.Execute(w, nil)
+// dataEntry handles requests to the main page and presents a form for data entry.
+// Form submission directs user to "/map", where the SVG map will be rendered. Any other
+// path that no handler matches is not found. Given "?edit=" with the id of a map, the form
+// is filled in with the input that map was drawn from.
+func (ms *mapStore) dataEntry(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" { // Paths no other handler matched are not the form
+		serveError(w, http.StatusNotFound, "")
+		return
 	}
+	// Requests to this page should be GET, as the form is submitted to /map
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		serveError(w, http.StatusMethodNotAllowed, "The data entry form can only be fetched. Maps are drawn by submitting it.")
+		return
+	}
+	text := pageText{}
+	if svm, ok := ms.get(r.FormValue("edit")); ok {
+		for k, v := range svm.input { // Copied, as serveForm adds to the values
+			text[k] = v
+		}
+	}
+	serveForm(w, http.StatusOK, text)
 }
 
-// style serves style.css stylesheet
-func style(w http.ResponseWriter, r *http.Request) {
-	stylesheet, err := htmt.ParseFiles("assets/style.css")
-	w.Header().Set("Content-Type", "text/css")
-	parsingError(err, w, "style.css")
-	stylesheet.Execute(w, nil)
+// serveForm renders the data entry form with the given status. Any taxon, coordinates,
+// error and problems in text are filled in, so that a user whose data couldn't be mapped can
+// see what went wrong and correct it.
+func serveForm(w http.ResponseWriter, status int, text pageText) {
+	text["placeHolderText"] = "Please enter comma-separated latitude and longitude. You can use decimal degrees or degrees, minutes, seconds."
+	text["regionNames"] = regionNames()
+	text["maxRecords"] = maxRecords
+	text["precision"] = coordPrecision
+	text["minfitkm"] = minFitKm
+	if _, ok := text["attribution"]; !ok {
+		text["attribution"] = defaultAttribution
+	}
+
+	pages, err := loadTemplates()
+	if err != nil { // Check the templates before writing anything, so the error page is all that's sent
+		errorLog.Printf("Error parsing data entry templates: %s", err)
+		serveError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := pages.render(w, status, "dataEntry.html", pageLayout{Title: "Data entry form", Body: text}); err != nil {
+		serveError(w, http.StatusInternalServerError, "")
+	}
 }
 
-// Only serves three pages: "/map" for the generated SVG map, "/mapfile" for the
-// generated SVG file and "/" for everything else
+// favicon serves the site icon that browsers ask for, so that their requests aren't
+// answered with the data entry page. Without an icon in the assets there is no content.
+func favicon(w http.ResponseWriter, r *http.Request) {
+	icon, err := readAsset("favicon.ico")
+	if err != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(icon)
+}
+
+// Serves "/map" for the generated SVG map, or the map alone for a GET with coordinates in
+// its query, "/mapfile?id=" for the generated SVG file,
+// "/upload" for resumable coordinate file uploads, "/api/map" for maps requested as JSON,
+// "/api/geojson" for the records as GeoJSON, "/healthz" and "/readyz" for health checks,
+// "/stats" for map cache figures, "/metrics" for figures about the maps drawn, "/static/"
+// for the stylesheet and other static assets and "/" for everything else.
+// With -ascii it instead prints a text map of coordinates read from standard input.
 func main() {
 	accessLog.SetOutput(os.Stdout)
 	errorLog.SetOutput(os.Stderr)
-	svgm := new(svgMap)
-	http.HandleFunc("/", dataEntry)
-	http.HandleFunc("/map", svgm.mapDisplay)
-	http.HandleFunc("/mapfile", svgm.mapAsFile)
-	http.HandleFunc("/style.css", style)
 
-	err := http.ListenAndServe(":9090", nil) // setting listening port
-	if err != nil {
+	ascii := flag.Bool("ascii", false, "print an ASCII map of the coordinates on standard input and exit")
+	svgType := flag.String("svg", "", "print an SVG map of this type of the coordinates on standard input and exit")
+	taxon := flag.String("taxon", "", "taxon named on maps printed with -svg")
+	cols := flag.Int("cols", asciiDefaultCols, "width of the ASCII map in characters")
+	rows := flag.Int("rows", 0, "height of the ASCII map in characters (0 to fit the width)")
+	logLevel := flag.String("loglevel", "info", "logging level, info or debug")
+	flag.StringVar(&logFormat, "logformat", logFormat, "format of the request log, text or json")
+	flag.StringVar(&metricsFormat, "metricsformat", metricsFormat, "format of the figures at /metrics, json or prometheus")
+	flag.StringVar(&debugInput, "debuginput", debugInput,
+		"how submitted coordinates appear in debug logs: truncate, redact or full")
+	addr := flag.String("addr", envOr("MAPSERVER_ADDR", ":9090"), "address to listen on, or set MAPSERVER_ADDR")
+	flag.StringVar(&assetsDir, "assets", envOr("MAPSERVER_ASSETS", ""),
+		"directory to read the page templates and stylesheet from instead of the built-in ones, or set MAPSERVER_ASSETS")
+	flag.IntVar(&maxRecords, "maxrecords", maxRecords, "largest number of records drawn on one map (0 for no limit)")
+	flag.Float64Var(&minFitKm, "minfitkm", minFitKm, "smallest width or height in km a map is zoomed to when fitted to its records")
+	flag.IntVar(&coordPrecision, "precision", coordPrecision, "decimal places coordinates are rounded to unless a request asks for another")
+	flag.StringVar(&defaultAttribution, "attribution", defaultAttribution, "data source credited below maps unless a request gives another")
+	flag.BoolVar(&minifyDownloads, "minify", minifyDownloads, "minify downloaded maps unless they are asked for with pretty=1")
+	cacheSize := flag.Int("cachesize", defaultCacheSize, "number of drawn maps kept for identical requests (0 to turn off)")
+	rate := flag.Float64("ratelimit", defaultRate, "maps each client may draw per second (0 for no limit)")
+	burst := flag.Int("rateburst", defaultBurst, "maps each client may draw at once before the rate limit applies")
+	flag.IntVar(&batchWorkers, "workers", batchWorkers, "maps of a batch drawn at once (defaults to the number of CPUs)")
+	flag.BoolVar(&trustProxy, "trustproxy", trustProxy, "tell clients apart by X-Forwarded-For, for running behind a proxy")
+	flag.DurationVar(&renderTimeout, "rendertimeout", renderTimeout, "time allowed for drawing a map (0 for no limit)")
+	shutdownTimeout := flag.Duration("shutdowntimeout", 30*time.Second,
+		"time allowed for requests in progress to finish when shutting down")
+	flag.Parse()
+	renderCache = newMapCache(*cacheSize)
+
+	if err := setLogLevel(*logLevel); err != nil {
+		errorLog.Fatal("Error starting: ", err)
+	}
+	if logFormat != "text" && logFormat != "json" {
+		errorLog.Fatalf("unknown log format %q, use text or json", logFormat)
+	}
+	if metricsFormat != "json" && metricsFormat != "prometheus" {
+		errorLog.Fatalf("unknown metrics format %q, use json or prometheus", metricsFormat)
+	}
+	if batchWorkers < 1 {
+		errorLog.Fatalf("-workers must be at least 1, not %d", batchWorkers)
+	}
+
+	if *ascii {
+		input, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			errorLog.Fatal("Error reading coordinates: ", err)
+		}
+		c, r := asciiSize(*cols, *rows)
+		fmt.Print(asciiMap(baseRegions[defaultRegion], parseRecords(cleanCoords(string(input))), c, r))
+		return
+	}
+	if *svgType != "" {
+		input, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			errorLog.Fatal("Error reading coordinates: ", err)
+		}
+		if err := writeMap(os.Stdout, *taxon, *svgType, string(input)); err != nil {
+			errorLog.Fatal("Error writing map: ", err)
+		}
+		return
+	}
+
+	if err := checkAssetsDir(assetsDir); err != nil {
+		errorLog.Fatal("Error starting: ", err)
+	}
+	if _, err := loadTemplates(); err != nil {
+		errorLog.Fatal("Error parsing page templates: ", err)
+	}
+
+	maps := newMapStore()
+	uploads := newUploadStore()
+	batches := newBatchStore()
+	limiter := newRateLimiter(*rate, *burst)
+	http.HandleFunc("/", maps.dataEntry)
+	http.HandleFunc("/map", limiter.limit(gzipHandler(maps.mapDisplay)))
+	http.HandleFunc("/mapfile", gzipHandler(limitConversions(limiter, maps.mapAsFile)))
+	http.HandleFunc("/upload", limiter.limit(uploads.uploadChunk))
+	http.HandleFunc("/upload/complete", limiter.limit(uploads.uploadComplete(maps)))
+	http.HandleFunc("/api/map", limiter.limit(gzipHandler(apiMap)))
+	http.HandleFunc("/api/batch", limiter.limit(batches.apiBatch))
+	http.HandleFunc("/api/geojson", limiter.limit(gzipHandler(maps.apiGeoJSON)))
+	http.HandleFunc("/api/csv", limiter.limit(gzipHandler(maps.apiCSV)))
+	http.HandleFunc("/api/kml", limiter.limit(gzipHandler(maps.apiKML)))
+	http.HandleFunc("/static/", static)
+	http.Handle("/style.css", http.RedirectHandler("/static/style.css", http.StatusMovedPermanently)) // For pages cached before
+	http.HandleFunc("/favicon.ico", favicon)
+	http.HandleFunc("/healthz", healthz)
+	http.HandleFunc("/readyz", readyz)
+	http.HandleFunc("/stats", stats)
+	http.HandleFunc("/metrics", metricsHandler)
+
+	server := &http.Server{Addr: *addr, Handler: logRequests(http.DefaultServeMux)} // setting listening port
+	if err := serve(server, *shutdownTimeout); err != nil {
 		errorLog.Fatal("ListenAndServe: ", err)
 	}
 }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestMain sends the server's logs nowhere, as the tests make plenty of requests that are
+// meant to fail
+func TestMain(m *testing.M) {
+	accessLog.SetOutput(io.Discard)
+	errorLog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// postForm submits form values to a handler as the data entry form would, returning the
+// response
+func postForm(h http.HandlerFunc, target string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// postJSON sends a JSON body to a handler, returning the response
+func postJSON(h http.HandlerFunc, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestBadCoordinatesReturnToForm(t *testing.T) {
+	for _, coords := range []string{"garbage\nnonsense", "-30.0,140.0\n-31.0,141.0"} {
+		rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+			"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {coords},
+		})
+		page := rec.Body.String()
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q gave %d, want 400", coords, rec.Code)
+		}
+		if !strings.Contains(page, ">"+coords+"</textarea>") || !strings.Contains(page, `value="Aus bus"`) {
+			t.Errorf("%q not refilled for correction", coords)
+		}
+		if strings.Contains(page, "<svg") {
+			t.Errorf("%q drew a map", coords)
+		}
+	}
+}
+
+func TestEmptySubmission(t *testing.T) {
+	for _, coords := range []string{"", "   \n\t\r\n  "} {
+		rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+			"maptype": {"grid"}, "taxon": {"Aus bus"}, "coordinates": {coords},
+		})
+		page := rec.Body.String()
+		if rec.Code != http.StatusBadRequest || !strings.Contains(page, errNoCoordinates.Error()+" to draw a map.") {
+			t.Errorf("%q gave %d without asking for coordinates", coords, rec.Code)
+		}
+		if !strings.Contains(page, `value="Aus bus"`) || strings.Contains(page, "<svg") {
+			t.Errorf("%q did not return to the form with the taxon", coords)
+		}
+		if _, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", coords, defaultZone)); err != errNoCoordinates {
+			t.Errorf("mapSVG of %q gave %v", coords, err)
+		}
+	}
+}
+
+func TestMissingTaxon(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{"maptype": {"plain"}, "coordinates": {"-42.1,147.2"}})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || m == nil {
+		t.Fatalf("map without a taxon gave %d", rec.Code)
+	}
+	dl := httptest.NewRecorder()
+	ms.mapAsFile(dl, httptest.NewRequest("GET", "/mapfile?id="+m[1], nil))
+	if cd := dl.Header().Get("Content-Disposition"); !strings.Contains(cd, "map.plain.svg") {
+		t.Errorf("map without a taxon downloaded as %q", cd)
+	}
+}
+
+func TestLineEndingsNormalised(t *testing.T) {
+	lf := "-42.1,147.2,1\n-41.5,146.5,0\n-41.2,146.0,1"
+	want, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", lf, defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, coords := range map[string]string{
+		"CRLF":         strings.ReplaceAll(lf, "\n", "\r\n") + "\r\n",
+		"CR":           strings.ReplaceAll(lf, "\n", "\r"),
+		"BOM":          "\uFEFF" + lf,
+		"BOM and CRLF": "\uFEFF" + strings.ReplaceAll(lf, "\n", "\r\n"),
+	} {
+		if got := cleanCoords(coords); got != lf {
+			t.Errorf("%s input cleaned to %q", name, got)
+		}
+		doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", coords, defaultZone))
+		if err != nil || doc != want || len(records) != 3 || !records[0].voucher || records[1].voucher {
+			t.Errorf("%s input drawn differently from LF input (%v)", name, err)
+		}
+	}
+}
+
+func TestRootOnlyServesForm(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", newMapStore().dataEntry)
+	mux.HandleFunc("/favicon.ico", favicon)
+	tests := []struct {
+		method, target string
+		status         int
+		form           bool
+	}{
+		{"GET", "/", http.StatusOK, true},
+		{"HEAD", "/", http.StatusOK, true}, // The server drops the body, not the handler
+		{"GET", "/robots.txt", http.StatusNotFound, false},
+		{"GET", "/foo/bar", http.StatusNotFound, false},
+		{"POST", "/", http.StatusMethodNotAllowed, false},
+		{"DELETE", "/", http.StatusMethodNotAllowed, false},
+		{"GET", "/favicon.ico", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s gave %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+		if form := strings.Contains(rec.Body.String(), "<form"); form != tt.form {
+			t.Errorf("%s %s sent the form %v", tt.method, tt.target, form)
+		}
+		if tt.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s %s allows %q", tt.method, tt.target, rec.Header().Get("Allow"))
+		}
+	}
+}
+
+var editLink = regexp.MustCompile(`<a class="edit" href="/\?edit=([0-9a-f]+)">`)
+
+func TestEditInputRoundTrip(t *testing.T) {
+	ms := newMapStore()
+	coords := "# two <sites>\n147.2,-42.1\n147.2,-42.1\n146.5,-41.5" // Reversed, so drawing rewrites the coordinates
+	page := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "taxon": {"Aus bus & co"}, "coordinates": {coords}, "dedupe": {"1"},
+	}).Body.String()
+	m := editLink.FindStringSubmatch(page)
+	if m == nil {
+		t.Fatal("results page has no link to edit the input")
+	}
+
+	rec := httptest.NewRecorder()
+	ms.dataEntry(rec, httptest.NewRequest("GET", "/?edit="+m[1], nil))
+	form := rec.Body.String()
+	want := html.EscapeString(html.UnescapeString(cleanCoords(coords)))
+	for _, part := range []string{">" + want + "</textarea>", `value="Aus bus &amp; co"`, `value="grid" checked`} {
+		if !strings.Contains(form, part) {
+			t.Errorf("edit form has no %q", part)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	ms.dataEntry(rec, httptest.NewRequest("GET", "/?edit=gone", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="plain" checked`) || strings.Contains(rec.Body.String(), "147.2") {
+		t.Errorf("editing an expired map gave %d without an empty form", rec.Code)
+	}
+}
+
+func TestUserInputEscaped(t *testing.T) {
+	const taxon = `Aus </svg><script>alert(1)</script> & "bus"`
+	coords := "-42.1,147.2,1,<b>wet</b> & shady\n-41.5,146.5,0"
+	for _, mapType := range []string{"plain", "grid", "web", "heat", "category", "source"} {
+		data := baseMapData(taxon, mapType, coords, defaultZone)
+		data.Title, data.Attribution = true, "<i>TAS</i> & partners"
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Errorf("%s: %v", mapType, err)
+			continue
+		}
+		if err := wellFormed(doc); err != nil {
+			t.Errorf("%s: map is not well-formed: %v", mapType, err)
+		}
+		if n := strings.Count(doc, "</svg>"); n != 1 {
+			t.Errorf("%s: map closed %d times", mapType, n)
+		}
+		for _, raw := range []string{"<script", "<b>", "<i>"} {
+			if strings.Contains(doc, raw) {
+				t.Errorf("%s: map holds %q unescaped", mapType, raw)
+			}
+		}
+		if !strings.Contains(doc, "&lt;script&gt;") {
+			t.Errorf("%s: taxon name missing from the map", mapType)
+		}
+	}
+
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"web"}, "taxon": {taxon}, "coordinates": {coords}, "title": {"1"},
+	})
+	if page := rec.Body.String(); rec.Code != http.StatusOK || strings.Contains(page, "<script>alert") {
+		t.Errorf("results page gave %d with the script unescaped", rec.Code)
+	}
+}
+
+func TestMapTypeChecked(t *testing.T) {
+	coords := "-42.1,147.2\n-41.5,146.5"
+	for mapType, want := range map[string]string{"": errNoMapType.Error() + ".", "voucher": `Unknown map type &#34;voucher&#34;.`} {
+		rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+			"maptype": {mapType}, "taxon": {"Aus bus"}, "coordinates": {coords},
+		})
+		page := rec.Body.String()
+		if rec.Code != http.StatusBadRequest || !strings.Contains(page, want) {
+			t.Errorf("map type %q gave %d without %q", mapType, rec.Code, want)
+		}
+		if !strings.Contains(page, ">"+coords+"</textarea>") || strings.Contains(page, "<svg") {
+			t.Errorf("map type %q did not return to the form with the coordinates", mapType)
+		}
+	}
+
+	rec := postJSON(apiMap, "/api/map", `{"maptype": "voucher", "coordinates": "-42.1,147.2"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `unknown map type \"voucher\"`) {
+		t.Errorf("API gave %d for an unknown map type", rec.Code)
+	}
+	data := baseMapData("Aus bus", "plain", coords, defaultZone)
+	if _, err := drawMap(context.Background(), data, parseMapData(context.Background(), data), "voucher"); err == nil ||
+		err.Error() != `Unknown map type "voucher"` {
+		t.Errorf("drawing an unknown map type gave %v", err)
+	}
+}
+
+func TestVoucherDataOnEveryMapType(t *testing.T) {
+	coords := "-42.1,147.2,1\n-41.5,146.5,0"
+	for mapType, fills := range map[string]string{"grid": "black,white", "plain": "black,black"} {
+		doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", mapType, coords, defaultZone))
+		if err != nil || len(records) != 2 {
+			t.Errorf("%s: %d records drawn (%v)", mapType, len(records), err)
+			continue
+		}
+		var got []string
+		for _, m := range circleFill.FindAllStringSubmatch(doc, -1) {
+			got = append(got, m[1])
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != fills {
+			t.Errorf("%s: records drawn in %v, want %s", mapType, got, fills)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	maxStoredMaps = 500       // Largest number of generated maps kept for download at once
+	mapExpiry     = time.Hour // Time after it is generated that a map can no longer be downloaded
+)
+
+// mapperMu serialises drawing with the mapper package, which draws every map on a single
+// package-level canvas and so can't be used by several requests at once
+var mapperMu sync.Mutex
+
+// mapStore keeps the maps generated for each request so that they can be downloaded later,
+// keyed by a random id given out with the results page
+type mapStore struct {
+	mu    sync.Mutex
+	maps  map[string]*svgMap
+	order []string // Ids in the order their maps were stored, oldest first
+}
+
+// newMapStore creates an empty mapStore
+func newMapStore() *mapStore {
+	return &mapStore{maps: make(map[string]*svgMap)}
+}
+
+// add stores a generated map and returns the id it can be retrieved with. Expired maps are
+// discarded first, and the oldest maps are dropped if the store is still full.
+func (ms *mapStore) add(m *svgMap) string {
+	id := newMapID()
+	m.created = time.Now()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.expire()
+	for len(ms.order) >= maxStoredMaps {
+		delete(ms.maps, ms.order[0])
+		ms.order = ms.order[1:]
+	}
+	ms.maps[id] = m
+	ms.order = append(ms.order, id)
+	return id
+}
+
+// get returns the map stored with the given id, if it is still available
+func (ms *mapStore) get(id string) (*svgMap, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.expire()
+	m, ok := ms.maps[id]
+	return m, ok
+}
+
+// expire discards maps generated longer ago than mapExpiry. Maps are stored in order, so
+// it stops at the first one that is still current. The caller must hold ms.mu.
+func (ms *mapStore) expire() {
+	for len(ms.order) > 0 {
+		id := ms.order[0]
+		if m := ms.maps[id]; m != nil && time.Since(m.created) < mapExpiry {
+			return
+		}
+		delete(ms.maps, id)
+		ms.order = ms.order[1:]
+	}
+}
+
+// newMapID returns a random id that can't be guessed from the ids of other users' maps
+func newMapID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		errorLog.Printf("Error generating map id: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
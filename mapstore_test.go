@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var mapfileLink = regexp.MustCompile(`href="/mapfile\?id=([0-9a-f]+)"`)
+
+func TestConcurrentMapsStaySeparate(t *testing.T) {
+	ms := newMapStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			taxon := fmt.Sprintf("Aus species%d", i)
+			rec := postForm(ms.mapDisplay, "/map", url.Values{
+				"maptype": {"plain"}, "taxon": {taxon}, "coordinates": {fmt.Sprintf("-42.%d,146.5", i)},
+			})
+			m := mapfileLink.FindStringSubmatch(rec.Body.String())
+			if m == nil {
+				t.Errorf("%s: no download link on the results page", taxon)
+				return
+			}
+
+			dl := httptest.NewRecorder()
+			ms.mapAsFile(dl, httptest.NewRequest("GET", "/mapfile?id="+m[1], nil))
+			if cd := dl.Header().Get("Content-Disposition"); !strings.Contains(cd, fmt.Sprintf("aus-species%d.plain.svg", i)) {
+				t.Errorf("%s downloaded as %q", taxon, cd)
+			}
+			if !strings.Contains(dl.Body.String(), ">"+taxon+"<") {
+				t.Errorf("%s downloaded another request's map", taxon)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMapStoreEviction(t *testing.T) {
+	ms := newMapStore()
+	first := ms.add(&svgMap{mapName: "first.svg"})
+	for i := 1; i < maxStoredMaps; i++ {
+		ms.add(&svgMap{})
+	}
+	if _, ok := ms.get(first); !ok {
+		t.Fatal("map dropped before the store was full")
+	}
+	ms.add(&svgMap{})
+	if _, ok := ms.get(first); ok {
+		t.Error("oldest map kept past maxStoredMaps")
+	}
+	if len(ms.maps) != maxStoredMaps || len(ms.order) != maxStoredMaps {
+		t.Errorf("store holds %d maps in order of %d, want %d", len(ms.maps), len(ms.order), maxStoredMaps)
+	}
+}
+
+func TestMapStoreExpiry(t *testing.T) {
+	ms := newMapStore()
+	old := ms.add(&svgMap{})
+	current := ms.add(&svgMap{})
+	ms.maps[old].created = time.Now().Add(-mapExpiry - time.Minute)
+	if _, ok := ms.get(old); ok {
+		t.Error("expired map still available")
+	}
+	if _, ok := ms.get(current); !ok {
+		t.Error("current map expired")
+	}
+	if a, b := newMapID(), newMapID(); a == b || len(a) != 24 {
+		t.Errorf("map ids %q and %q", a, b)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const maxMargin = 500 // Largest margin in pixels that can be added around a map
+
+// parseMargin reads a margin given in pixels, such as "40", or as a percentage of the canvas
+// width, such as "5%". Empty, negative, infinite or unreadable values give no margin.
+func parseMargin(value string) float64 {
+	value = strings.TrimSpace(value)
+	scale := 1.0
+	if strings.HasSuffix(value, "%") {
+		value = strings.TrimSuffix(value, "%")
+		scale = canvasWidth / 100.0
+	}
+	m, err := strconv.ParseFloat(value, 64)
+	if err != nil || m <= 0 || math.IsNaN(m) || math.IsInf(m, 0) {
+		return 0
+	}
+	if m*scale > maxMargin {
+		return maxMargin
+	}
+	return m * scale
+}
+
+// addMargin pads a map with an empty border of the given width in pixels on every side.
+// Only the viewBox grows, so the coastline and points keep their positions relative to
+// each other and the drawing is just scaled down a little within the image.
+func addMargin(doc string, margin float64) string {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil || margin <= 0 {
+		return doc
+	}
+	x0, _ := strconv.ParseFloat(m[1], 64)
+	y0, _ := strconv.ParseFloat(m[2], 64)
+	width, _ := strconv.ParseFloat(m[3], 64)
+	height, _ := strconv.ParseFloat(m[4], 64)
+
+	viewBox := fmt.Sprintf(`viewBox="%g %g %g %g"`, x0-margin, y0-margin, width+2*margin, height+2*margin)
+	return strings.Replace(doc, m[0], viewBox, 1)
+}
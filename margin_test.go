@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// marginMap draws a plain map of a single record with the given margin and the full
+// coastline, returning the viewBox, the coastline and the position of the record
+func marginMap(t *testing.T, margin float64) (viewBox []float64, coast, point string) {
+	t.Helper()
+	data := baseMapData("Aus bus", "plain", "-42.0,146.5\n", defaultZone)
+	data.Margin, data.FullDetail = margin, true // The coastline is otherwise simplified to the extent
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	for _, s := range m[1:] {
+		v, _ := strconv.ParseFloat(s, 64)
+		viewBox = append(viewBox, v)
+	}
+	return viewBox, coastPath.FindString(doc), circleShape.FindString(doc)
+}
+
+func TestMarginWidensBorderOnly(t *testing.T) {
+	vb0, coast0, point0 := marginMap(t, 0)
+	for _, margin := range []float64{20, 60} {
+		vb, coast, point := marginMap(t, margin)
+		want := []float64{vb0[0] - margin, vb0[1] - margin, vb0[2] + 2*margin, vb0[3] + 2*margin}
+		for i := range want {
+			if vb[i] != want[i] {
+				t.Errorf("margin %g gives viewBox %v, want %v", margin, vb, want)
+				break
+			}
+		}
+		if coast != coast0 || point != point0 {
+			t.Errorf("margin %g moved the coastline or the record", margin)
+		}
+	}
+}
+
+func TestParseMargin(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 0},
+		{"40", 40},
+		{" 12.5 ", 12.5},
+		{"10%", 91},
+		{"-5", 0},
+		{"wide", 0},
+		{"9000", maxMargin},
+		{"NaN", 0},
+		{"nan%", 0},
+		{"Inf", 0},
+		{"-Inf", 0},
+		{"+Inf%", 0},
+	}
+	for _, tt := range tests {
+		if got := parseMargin(tt.value); got != tt.want {
+			t.Errorf("parseMargin(%q) = %g, want %g", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormMarginNotANumber(t *testing.T) {
+	for _, margin := range []string{"NaN", "Inf"} {
+		rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+			"maptype": {"plain"}, "coordinates": {"-42.1,147.2"}, "margin": {margin},
+		})
+		m := viewBoxAttr.FindStringSubmatch(rec.Body.String())
+		if rec.Code != http.StatusOK || m == nil || strings.Join(m[1:], " ") != "0 0 910 1260" {
+			t.Errorf("margin %s gave %d with viewBox %q", margin, rec.Code, m)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	minMarkerRadius = 2  // Smallest radius in pixels that markers can be drawn at
+	maxMarkerRadius = 30 // Largest radius in pixels that markers can be drawn at
+)
+
+// dotCircle matches a circle that the mapper draws for a record, capturing its position and style
+var dotCircle = regexp.MustCompile(`<circle cx="(-?\d+)" cy="(-?\d+)" r="\d+" style="([^"]*)"`)
+
+// markerStyle is the colour and size that the records on point and grid maps are drawn in
+type markerStyle struct {
+	colour    string // Fill of the markers, and of vouchered specimens on voucher maps
+	anecdotal string // Outline of the empty markers of observations on voucher maps
+	radius    int
+}
+
+// defaultMarkers are the black markers the mapper draws itself
+var defaultMarkers = markerStyle{colour: "black", anecdotal: "black", radius: markerRadius}
+
+// markerColour checks a colour given for markers as #rgb or #rrggbb, giving "" if none was
+// given
+func markerColour(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if !hexColour.MatchString(value) {
+		return "", fmt.Errorf("The marker colour %q is not a hex colour such as #1f78b4", value)
+	}
+	return strings.ToLower(value), nil
+}
+
+// parseRadius reads the radius in pixels given for markers, limited to between
+// minMarkerRadius and maxMarkerRadius. Anything that isn't a number gives 0, the default.
+func parseRadius(value string) int {
+	r, err := strconv.Atoi(value)
+	if err != nil || r <= 0 {
+		return 0
+	}
+	if r < minMarkerRadius {
+		return minMarkerRadius
+	}
+	if r > maxMarkerRadius {
+		return maxMarkerRadius
+	}
+	return r
+}
+
+// markers returns the style the records are drawn in, checking the colours asked for.
+// Colours asked for are used over those of the map's theme, and observations are outlined
+// in the marker colour unless given a colour of their own.
+func (data *mapData) markers() (markerStyle, error) {
+	m := defaultMarkers
+	if t := data.theme(); t.markers != "" {
+		m.colour, m.anecdotal = t.markers, t.markers
+	}
+	colour, err := markerColour(data.MarkerColour)
+	if err != nil {
+		return m, err
+	}
+	anecdotal, err := markerColour(data.ObsColour)
+	if err != nil {
+		return m, err
+	}
+	if colour != "" {
+		m.colour, m.anecdotal = colour, colour
+	}
+	if anecdotal != "" {
+		m.anecdotal = anecdotal
+	}
+	if data.MarkerRadius > 0 {
+		m.radius = data.MarkerRadius
+	}
+	return m, nil
+}
+
+// restyleDots redraws the circles the mapper draws for each record in the given style. The
+// empty circles of observations on voucher maps keep their white fill and take the
+// anecdotal colour as their outline.
+func restyleDots(doc string, m markerStyle) string {
+	if m == defaultMarkers {
+		return doc
+	}
+	open := `<g id="dots">`
+	start := strings.Index(doc, open)
+	if start < 0 {
+		return doc
+	}
+	start += len(open)
+	end := strings.Index(doc[start:], "</g>")
+	if end < 0 {
+		return doc
+	}
+
+	dots := dotCircle.ReplaceAllStringFunc(doc[start:start+end], func(circle string) string {
+		c := dotCircle.FindStringSubmatch(circle)
+		style := c[3]
+		if strings.HasPrefix(style, "fill:white") {
+			style = strings.Replace(style, "stroke:black", "stroke:"+m.anecdotal, 1)
+		} else {
+			style = strings.Replace(style, "fill:black", "fill:"+m.colour, 1)
+			style = strings.Replace(style, "stroke:black", "stroke:"+m.colour, 1)
+		}
+		return fmt.Sprintf(`<circle cx="%s" cy="%s" r="%d" style="%s"`, c[1], c[2], m.radius, style)
+	})
+	return doc[:start] + dots + doc[start+end:]
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// dotsGroup returns the circles drawn for records in the dots group of a map
+func dotsGroup(doc string) [][]string {
+	start := strings.Index(doc, `<g id="dots">`)
+	if start < 0 {
+		return nil
+	}
+	end := strings.Index(doc[start:], "</g>")
+	return dotCircle.FindAllStringSubmatch(doc[start:start+end], -1)
+}
+
+func TestMarkerColour(t *testing.T) {
+	for value, want := range map[string]string{"": "", "#1F78B4": "#1f78b4", " #abc ": "#abc"} {
+		if got, err := markerColour(value); err != nil || got != want {
+			t.Errorf("markerColour(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"red", "#12345", "1f78b4", "#ggg", `#fff"/><script>`} {
+		if _, err := markerColour(value); err == nil {
+			t.Errorf("markerColour(%q) accepted", value)
+		}
+	}
+	for value, want := range map[string]int{"": 0, "7": 7, "1": minMarkerRadius, "500": maxMarkerRadius, "-3": 0, "big": 0} {
+		if got := parseRadius(value); got != want {
+			t.Errorf("parseRadius(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestMarkerStyleDrawn(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.1,147.2\n-41.5,146.5", defaultZone)
+	data.MarkerColour, data.MarkerRadius = "#1F78B4", 7
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dots := dotsGroup(doc)
+	if len(dots) != 2 {
+		t.Fatalf("%d markers drawn", len(dots))
+	}
+	for _, c := range dots {
+		if !strings.Contains(c[0], `r="7"`) || !strings.Contains(c[3], "fill:#1f78b4") {
+			t.Errorf("marker drawn as %s", c[0])
+		}
+	}
+
+	// Vouchered specimens and observations take their own colours on voucher maps
+	data = baseMapData("Aus bus", "grid", "-42.1,147.2,1\n-41.5,146.5,0", defaultZone)
+	data.MarkerColour, data.ObsColour = "#1f78b4", "#e31a1c"
+	if doc, _, err = mapSVG(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	var vouchered, observed int
+	for _, c := range dotsGroup(doc) {
+		switch {
+		case strings.Contains(c[3], "fill:#1f78b4"):
+			vouchered++
+		case strings.HasPrefix(c[3], "fill:white") && strings.Contains(c[3], "stroke:#e31a1c"):
+			observed++
+		}
+	}
+	if vouchered != 1 || observed != 1 {
+		t.Errorf("%d vouchered and %d observed markers in their colours", vouchered, observed)
+	}
+}
+
+func TestBadMarkerColourRejected(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"-42.1,147.2"}, "markercolour": {"blue"},
+	})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "is not a hex colour") {
+		t.Errorf("non-hex colour gave %d", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mapTypeNames are the names map types are described by in the metadata of a map
+var mapTypeNames = map[string]string{
+	"grid": "grid map", "plain": "plain map", "web": "web map", "region": "region map",
+	"arrow": "direction map", "distance": "distance map", "source": "source map", "heat": "density map",
+	"category": "category map", "proportional": "proportional symbol map",
+}
+
+// mapDescription summarises the records on a map and the area they cover
+func mapDescription(records []record) string {
+	count := 0
+	north, south, west, east := -90.0, 0.0, 180.0, 0.0
+	for _, rec := range records {
+		count += rec.weight()
+		north, south = math.Max(north, rec.lat), math.Min(south, rec.lat)
+		west, east = math.Min(west, rec.lon), math.Max(east, rec.lon)
+	}
+
+	switch count {
+	case 0:
+		return "Map of Tasmania with no records."
+	case 1:
+		return fmt.Sprintf("Map of Tasmania with 1 record at %.4f, %.4f.", north, west)
+	}
+	return fmt.Sprintf("Map of Tasmania with %d records between latitudes %.4f and %.4f and longitudes %.4f and %.4f.",
+		count, north, south, west, east)
+}
+
+// addMetadata gives a map a title naming its taxon and type and a description of its
+// records, for screen readers and for software that catalogues images. The title doubles
+// as the accessible name of the image.
+func addMetadata(doc, taxon, mapType string, records []record) string {
+	title := mapTypeNames[mapType]
+	if taxon = html.UnescapeString(taxon); taxon != "" {
+		title = taxon + ", " + title
+	}
+	if first, size := utf8.DecodeRuneInString(title); size > 0 { // Names can start with any letter
+		title = string(unicode.ToUpper(first)) + title[size:]
+	}
+
+	var escTitle, escDesc bytes.Buffer
+	xml.EscapeText(&escTitle, []byte(title))
+	xml.EscapeText(&escDesc, []byte(mapDescription(records)))
+
+	doc = addRootAttr(doc, fmt.Sprintf(`role="img" aria-label="%s"`, escTitle.String()))
+	start := strings.Index(doc, "<svg")
+	if start < 0 {
+		return doc
+	}
+	end := strings.Index(doc[start:], ">")
+	if end < 0 {
+		return doc
+	}
+	end += start + 1
+	return doc[:end] + fmt.Sprintf("\n<title>%s</title>\n<desc>%s</desc>", escTitle.String(), escDesc.String()) + doc[end:]
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var rootTitle = regexp.MustCompile(`<svg[^>]* role="img" aria-label="([^"]*)"[^>]*>\s*<title>([^<]*)</title>\s*<desc>([^<]*)</desc>`)
+
+func TestMetadataForEveryMapType(t *testing.T) {
+	const desc = "Map of Tasmania with 2 records between latitudes -41.5000 and -42.0000 and longitudes 146.5000 and 147.0000."
+	for mapType := range knownMapTypes {
+		data := baseMapData("Aus bus", mapType, "-42.0,146.5\n-41.5,147.0\n", defaultZone)
+		data.Reference = "-42.88,147.32" // Distance maps measure from a reference point
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Errorf("%s: %v", mapType, err)
+			continue
+		}
+		m := rootTitle.FindStringSubmatch(doc)
+		if m == nil {
+			t.Errorf("%s map has no title and description at its root", mapType)
+			continue
+		}
+		if want := "Aus bus, " + mapTypeNames[mapType]; m[1] != want || m[2] != want {
+			t.Errorf("%s map labelled %q and titled %q, want %q", mapType, m[1], m[2], want)
+		}
+		if m[3] != desc {
+			t.Errorf("%s map described as %q", mapType, m[3])
+		}
+	}
+}
+
+func TestMetadataEscaped(t *testing.T) {
+	doc := addMetadata(`<svg width="10" height="10"></svg>`, "Aus &quot;bus&quot; & <b>", "plain", []record{{lat: -42, lon: 147}})
+	for _, want := range []string{`aria-label="Aus &#34;bus&#34; &amp; &lt;b&gt;, plain map"`,
+		"<title>Aus &#34;bus&#34; &amp; &lt;b&gt;, plain map</title>", "<desc>Map of Tasmania with 1 record at -42.0000, 147.0000.</desc>"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("metadata %q has no %q", doc, want)
+		}
+	}
+	if err := wellFormed(doc); err != nil {
+		t.Error(err)
+	}
+	if got := addMetadata(`<svg></svg>`, "", "heat", nil); !strings.Contains(got, "<title>Density map</title>") ||
+		!strings.Contains(got, "<desc>Map of Tasmania with no records.</desc>") {
+		t.Errorf("untitled map of no records gave %q", got)
+	}
+}
+
+func TestMetadataAccentedName(t *testing.T) {
+	tests := []struct {
+		taxon, want string
+	}{
+		{"Épacris impressa", "Épacris impressa, plain map"},
+		{"éricacées", "Éricacées, plain map"},
+		{"ōbus", "Ōbus, plain map"},
+	}
+	for _, tt := range tests {
+		doc := addMetadata(`<svg width="10" height="10"></svg>`, html.EscapeString(tt.taxon), "plain", nil)
+		if !strings.Contains(doc, `aria-label="`+tt.want+`"`) || !strings.Contains(doc, "<title>"+tt.want+"</title>") || !utf8.ValidString(doc) {
+			t.Errorf("%s gave metadata %q, want %q", tt.taxon, doc, tt.want)
+		}
+	}
+	if got := addMetadata(`<svg></svg>`, "", "nosuch", nil); !strings.Contains(got, "<title></title>") {
+		t.Errorf("map type without a name gave %q", got)
+	}
+}
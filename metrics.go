@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsFormat is how "/metrics" reports its figures, "json" or "prometheus", set by
+// -metricsformat
+var metricsFormat = "json"
+
+// renderMetrics counts the maps drawn since the server started, safely for concurrent requests
+type renderMetrics struct {
+	mu         sync.Mutex
+	rendered   int            // Maps drawn successfully
+	byType     map[string]int // Maps drawn successfully of each type
+	errors     int            // Maps that couldn't be drawn
+	renderTime time.Duration  // Total time spent drawing the maps that were drawn
+}
+
+// metrics are the figures for every map drawn by the server
+var metrics = &renderMetrics{byType: make(map[string]int)}
+
+// record counts a map of the given type that took elapsed to draw, or failed with err
+func (rm *renderMetrics) record(mapType string, elapsed time.Duration, err error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if err != nil {
+		rm.errors++
+		return
+	}
+	rm.rendered++
+	rm.byType[mapType]++
+	rm.renderTime += elapsed
+}
+
+// metricsReport are the figures reported by "/metrics"
+type metricsReport struct {
+	Rendered        int            `json:"rendered"`
+	ByType          map[string]int `json:"by_type"`
+	Errors          int            `json:"errors"`
+	AverageRenderMs float64        `json:"average_render_ms"`
+	CacheHits       int            `json:"cache_hits"`
+	CacheMisses     int            `json:"cache_misses"`
+}
+
+// report returns the current figures along with those of the map cache
+func (rm *renderMetrics) report() metricsReport {
+	cache := renderCache.stats()
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rep := metricsReport{Rendered: rm.rendered, ByType: make(map[string]int), Errors: rm.errors,
+		CacheHits: cache.Hits, CacheMisses: cache.Misses}
+	for t, n := range rm.byType {
+		rep.ByType[t] = n
+	}
+	if rm.rendered > 0 {
+		rep.AverageRenderMs = float64(rm.renderTime.Microseconds()) / 1000 / float64(rm.rendered)
+	}
+	return rep
+}
+
+// metricsHandler handles "/metrics", reporting the maps drawn as JSON, or in the Prometheus
+// text format with -metricsformat prometheus
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	rep := metrics.report()
+	w.Header().Set("Cache-Control", "no-store")
+	if metricsFormat != "prometheus" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rep)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP mapserver_maps_rendered_total Maps drawn successfully, by map type.")
+	fmt.Fprintln(w, "# TYPE mapserver_maps_rendered_total counter")
+	types := make([]string, 0, len(rep.ByType))
+	for t := range rep.ByType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(w, "mapserver_maps_rendered_total{type=%q} %d\n", t, rep.ByType[t])
+	}
+	fmt.Fprintln(w, "# HELP mapserver_render_errors_total Maps that couldn't be drawn.")
+	fmt.Fprintln(w, "# TYPE mapserver_render_errors_total counter")
+	fmt.Fprintf(w, "mapserver_render_errors_total %d\n", rep.Errors)
+	fmt.Fprintln(w, "# HELP mapserver_render_seconds_average Average time taken to draw a map.")
+	fmt.Fprintln(w, "# TYPE mapserver_render_seconds_average gauge")
+	fmt.Fprintf(w, "mapserver_render_seconds_average %g\n", rep.AverageRenderMs/1000)
+	fmt.Fprintln(w, "# HELP mapserver_cache_hits_total Requests answered with a map already drawn.")
+	fmt.Fprintln(w, "# TYPE mapserver_cache_hits_total counter")
+	fmt.Fprintf(w, "mapserver_cache_hits_total %d\n", rep.CacheHits)
+	fmt.Fprintln(w, "# HELP mapserver_cache_misses_total Requests for maps that had to be drawn.")
+	fmt.Fprintln(w, "# TYPE mapserver_cache_misses_total counter")
+	fmt.Fprintf(w, "mapserver_cache_misses_total %d\n", rep.CacheMisses)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsCounted(t *testing.T) {
+	before := metrics.report()
+	for _, mapType := range []string{"plain", "grid"} {
+		if _, err := renderMap("Metrics testus", mapType, "-42.1,147.2\n-41.5,146.5"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	renderMap("Metrics testus", "plain", "-42.1,147.2\n-41.5,146.5") // Drawn already
+	renderMap("Metrics testus", "plain", "garbage")
+
+	after := metrics.report()
+	if got := after.Rendered - before.Rendered; got != 2 {
+		t.Errorf("%d maps counted as drawn, want 2", got)
+	}
+	for _, mapType := range []string{"plain", "grid"} {
+		if got := after.ByType[mapType] - before.ByType[mapType]; got != 1 {
+			t.Errorf("%d %s maps counted, want 1", got, mapType)
+		}
+	}
+	if got := after.Errors - before.Errors; got != 1 {
+		t.Errorf("%d errors counted, want 1", got)
+	}
+	if after.CacheHits-before.CacheHits != 1 || after.CacheMisses-before.CacheMisses != 3 {
+		t.Errorf("cache went from %d hits and %d misses to %d and %d",
+			before.CacheHits, before.CacheMisses, after.CacheHits, after.CacheMisses)
+	}
+	if after.AverageRenderMs <= 0 {
+		t.Errorf("average render time %g", after.AverageRenderMs)
+	}
+}
+
+func TestMetricsConcurrent(t *testing.T) {
+	rm := &renderMetrics{byType: make(map[string]int)}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%4 == 0 {
+				err = errors.New("failed")
+			}
+			rm.record("plain", time.Millisecond, err)
+		}(i)
+	}
+	wg.Wait()
+	if rm.rendered != 75 || rm.byType["plain"] != 75 || rm.errors != 25 || rm.renderTime != 75*time.Millisecond {
+		t.Errorf("got %d drawn, %d plain, %d errors in %s", rm.rendered, rm.byType["plain"], rm.errors, rm.renderTime)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	renderMap("Metrics testus", "plain", "-42.0,146.5")
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var rep metricsReport
+	if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil || rep.Rendered == 0 || rep.ByType["plain"] == 0 {
+		t.Errorf("JSON report %+v (%v)", rep, err)
+	}
+
+	defer func() { metricsFormat = "json" }()
+	metricsFormat = "prometheus"
+	rec = httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Prometheus report served as %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{`mapserver_maps_rendered_total{type="plain"} `, "mapserver_render_errors_total ",
+		"# TYPE mapserver_cache_hits_total counter"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Prometheus report has no %q", want)
+		}
+	}
+}
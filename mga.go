@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	utm "github.com/kurankat/tasutm"
+)
+
+// defaultZone is the UTM zone covering Tasmania, which MGA eastings and northings are read in
+// unless another is chosen
+const defaultZone = 55
+
+// utmLine matches a line holding an easting and a northing in metres, separated by spaces,
+// commas or semicolons and optionally followed by the fields that can follow a latitude
+// and longitude. Eastings have six figures and southern hemisphere northings seven, which
+// no latitude or longitude has.
+var utmLine = regexp.MustCompile(`^\x{FEFF}?\s*(\d{6}(?:\.\d+)?)[\s,;]+(\d{7}(?:\.\d+)?)(?:[\s,;]+(.*?))?\s*$`)
+
+// parseZone reads the UTM zone eastings and northings are given in, from 1 to 60, giving
+// defaultZone for anything else
+func parseZone(value string) int {
+	zone, err := strconv.Atoi(value)
+	if err != nil || zone < 1 || zone > 60 {
+		return defaultZone
+	}
+	return zone
+}
+
+// convertUTM rewrites every line of raw input holding an easting and northing in the given
+// zone of the southern hemisphere into a latitude and longitude in decimal degrees, keeping
+// anything after them. It returns the number of lines converted.
+func convertUTM(raw string, zone int) (string, int) {
+	converted := 0
+	raw = mapLines(raw, func(line string) (string, bool) {
+		rest, focal := splitFocal(line)
+		m := utmLine.FindStringSubmatch(rest)
+		if m == nil {
+			return line, true
+		}
+		easting, _ := strconv.ParseFloat(m[1], 64)
+		northing, _ := strconv.ParseFloat(m[2], 64)
+		lat, lon, err := utm.ToLatLon(easting, northing, zone, "", false) // Northings count from a false origin south of the equator
+		if err != nil {
+			return line, true // Left for validation to report as unparseable
+		}
+		converted++
+		line = fmt.Sprintf("%.6f,%.6f", lat, lon)
+		if m[3] != "" {
+			line += "," + m[3]
+		}
+		return markFocal(line, focal), true
+	})
+	return raw, converted
+}
+
+// readCoords cleans raw coordinates given for a map, first splitting lines holding several
+// records and converting any given as eastings and northings in the map's UTM zone, and
+// tells the user if there were any
+func (data *mapData) readCoords(raw string) string {
+	raw, split := splitRecordLines(raw)
+	if split > 0 {
+		data.Warnings = append(data.Warnings,
+			fmt.Sprintf("%d line(s) holding several records were split into one record per line", split))
+	}
+	raw, converted := convertUTM(raw, data.Zone)
+	if converted > 0 {
+		data.Warnings = append(data.Warnings,
+			fmt.Sprintf("%d line(s) were read as MGA eastings and northings in zone %d", converted, data.Zone))
+	}
+	return cleanCoords(raw)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConvertUTM(t *testing.T) {
+	// Points on the central meridian of each zone, whose northings are 10,000 km less
+	// the scaled meridian arc of GRS80 from the equator
+	tests := []struct {
+		line     string
+		zone     int
+		lat, lon float64
+		rest     string
+	}{
+		{"500000 5350224", 55, -42.0, 147.0, ""},
+		{"500000,5461243,1", 55, -41.0, 147.0, "1"},
+		{"500000;5239185", 55, -43.0, 147.0, ""},
+		{"500000 5461243", 54, -41.0, 141.0, ""},
+	}
+	for _, tt := range tests {
+		got, n := convertUTM(tt.line, tt.zone)
+		fields := strings.Split(got, ",")
+		if n != 1 || len(fields) < 2 {
+			t.Errorf("%q in zone %d gave %q", tt.line, tt.zone, got)
+			continue
+		}
+		lat, _ := strconv.ParseFloat(fields[0], 64)
+		lon, _ := strconv.ParseFloat(fields[1], 64)
+		if math.Abs(lat-tt.lat) > 1e-4 || math.Abs(lon-tt.lon) > 1e-4 {
+			t.Errorf("%q in zone %d gave %g,%g, want %g,%g", tt.line, tt.zone, lat, lon, tt.lat, tt.lon)
+		}
+		if rest := strings.Join(fields[2:], ","); rest != tt.rest {
+			t.Errorf("%q kept %q after the position, want %q", tt.line, rest, tt.rest)
+		}
+	}
+
+	raw := "-42.1,147.2\n# 500000 5350224\nnot utm"
+	if got, n := convertUTM(raw, defaultZone); n != 0 || got != raw {
+		t.Errorf("lines without eastings and northings became %q (%d converted)", got, n)
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	for value, want := range map[string]int{"": defaultZone, "54": 54, "56": 56, "0": defaultZone, "61": defaultZone, "z55": defaultZone} {
+		if got := parseZone(value); got != want {
+			t.Errorf("parseZone(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestUTMInputMapped(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"500000 5350224\n-41.5,146.5"},
+	})
+	page := rec.Body.String()
+	if rec.Code != 200 || !strings.Contains(page, "1 line(s) were read as MGA eastings and northings in zone 55") ||
+		strings.Contains(page, "could not be parsed") {
+		t.Errorf("eastings and northings not mapped, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// minifyDownloads is whether downloaded maps are minified unless "&pretty=1" is asked for,
+// set by -minify
+var minifyDownloads = true
+
+var (
+	svgToken  = regexp.MustCompile(`<!--[\s\S]*?-->|<!\[CDATA\[[\s\S]*?\]\]>|<[^>]*>`)
+	svgTag    = regexp.MustCompile(`^<(/?)([\w:.-]+)((?:\s+[\w:.-]+\s*=\s*"[^"]*")*)\s*(/?)>$`)
+	svgAttr   = regexp.MustCompile(`([\w:.-]+)\s*=\s*"([^"]*)"`)
+	svgNumber = regexp.MustCompile(`\d*\.\d+`)
+)
+
+// geometryAttrs are the attributes holding only numbers, whose trailing zeros can go
+var geometryAttrs = map[string]bool{
+	"d": true, "points": true, "x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "width": true, "height": true,
+	"viewBox": true, "transform": true,
+}
+
+// textElements are the elements whose whitespace is part of what they show
+var textElements = map[string]bool{"text": true, "tspan": true, "textPath": true, "title": true, "desc": true, "style": true}
+
+// minifySVG makes a map smaller to download without changing how it is drawn. Comments
+// and the whitespace between elements are removed, except inside text, tags are written
+// on one line, trailing zeros are trimmed from numbers in geometry and Inkscape's private
+// style properties, which nothing else reads, are dropped.
+func minifySVG(doc string) string {
+	var out strings.Builder
+	out.Grow(len(doc))
+	var open []string // Elements enclosing the current position
+	inText := func() bool { return len(open) > 0 && textElements[open[len(open)-1]] }
+
+	last := 0
+	for _, loc := range svgToken.FindAllStringIndex(doc, -1) {
+		if text := doc[last:loc[0]]; inText() || strings.TrimSpace(text) != "" {
+			out.WriteString(text)
+		}
+		last = loc[1]
+
+		token := doc[loc[0]:loc[1]]
+		if strings.HasPrefix(token, "<!--") {
+			continue
+		}
+		m := svgTag.FindStringSubmatch(token)
+		if m == nil { // The XML declaration and CDATA are kept as they are
+			out.WriteString(token)
+			continue
+		}
+		closing, name, attrs, empty := m[1] != "", m[2], m[3], m[4] != ""
+		switch {
+		case closing && len(open) > 0:
+			open = open[:len(open)-1]
+		case !closing && !empty:
+			open = append(open, name)
+		}
+
+		out.WriteString("<" + m[1] + name)
+		for _, a := range svgAttr.FindAllStringSubmatch(attrs, -1) {
+			if value, ok := minifyAttr(a[1], a[2]); ok {
+				out.WriteString(" " + a[1] + `="` + value + `"`)
+			}
+		}
+		out.WriteString(m[4] + ">")
+	}
+	out.WriteString(doc[last:])
+	return out.String()
+}
+
+// minifyAttr returns the shortened value of an attribute, or false if it can be left out
+func minifyAttr(name, value string) (string, bool) {
+	switch {
+	case geometryAttrs[name]:
+		value = strings.Join(strings.Fields(value), " ")
+		return svgNumber.ReplaceAllStringFunc(value, trimZeros), true
+	case name == "style":
+		var kept []string
+		for _, decl := range strings.Split(value, ";") {
+			decl = strings.TrimSpace(decl)
+			if decl != "" && !strings.HasPrefix(decl, "-inkscape-") {
+				kept = append(kept, decl)
+			}
+		}
+		if len(kept) == 0 {
+			return "", false
+		}
+		return strings.Join(kept, ";"), true
+	}
+	return value, true
+}
+
+// trimZeros removes the trailing zeros of a decimal number, and its point if nothing is left
+// after it
+func trimZeros(n string) string {
+	n = strings.TrimSuffix(strings.TrimRight(n, "0"), ".")
+	if n == "" {
+		return "0"
+	}
+	return n
+}
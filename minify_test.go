@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var geometryNumber = regexp.MustCompile(`-?\d*\.?\d+(?:e-?\d+)?`)
+
+// geometry returns the numbers in the geometry attributes of every element of doc, in order
+func geometry(t *testing.T, doc string) []float64 {
+	t.Helper()
+	var nums []float64
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nums
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			for _, a := range el.Attr {
+				if !geometryAttrs[a.Name.Local] {
+					continue
+				}
+				for _, s := range geometryNumber.FindAllString(a.Value, -1) {
+					n, _ := strconv.ParseFloat(s, 64)
+					nums = append(nums, n)
+				}
+			}
+		}
+	}
+}
+
+func TestMinifiedDownload(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2\n-41.5,146.5"},
+	})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no download link on the results page")
+	}
+	download := func(query string) string {
+		dl := httptest.NewRecorder()
+		ms.mapAsFile(dl, httptest.NewRequest("GET", "/mapfile?id="+m[1]+query, nil))
+		return dl.Body.String()
+	}
+	minified, pretty := download(""), download("&pretty=1")
+	if len(minified) >= len(pretty) {
+		t.Errorf("minified map is %d bytes, the pretty one %d", len(minified), len(pretty))
+	}
+	for name, doc := range map[string]string{"minified": minified, "pretty": pretty} {
+		if err := wellFormed(doc); err != nil {
+			t.Errorf("%s map is not well-formed XML: %v", name, err)
+		}
+	}
+	a, b := geometry(t, minified), geometry(t, pretty)
+	if len(a) != len(b) {
+		t.Fatalf("minifying left %d numbers in the geometry of %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("minifying changed geometry number %d from %g to %g", i, b[i], a[i])
+		}
+	}
+}
+
+func TestMinifySVG(t *testing.T) {
+	doc := "<svg>\n  <!-- drawn by hand -->\n  <circle cx=\"10.500\" cy=\"20.0\" r=\"3\" style=\"fill:red;-inkscape-font-specification:Sans\"/>\n" +
+		"  <text x=\"1.10\">  Aus  bus </text>\n</svg>"
+	want := `<svg><circle cx="10.5" cy="20" r="3" style="fill:red"/><text x="1.1">  Aus  bus </text></svg>`
+	if got := minifySVG(doc); got != want {
+		t.Errorf("minifySVG gave\n%s\nwant\n%s", got, want)
+	}
+	for n, want := range map[string]string{"1.500": "1.5", "2.000": "2", ".0": "0", "0.25": "0.25"} {
+		if got := trimZeros(n); got != want {
+			t.Errorf("trimZeros(%q) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// shoreTolerance is how far in pixels outside the coastline a record can be before it is
+// taken to be at sea, as the coastline is only drawn to the nearest 400 m
+const shoreTolerance = 1.0
+
+// atSea reports whether a record falls in the sea rather than on land, going by the
+// coastline drawn on the map
+func atSea(reg *baseRegion, rec record) bool {
+	x, y := reg.project(rec.lat, rec.lon)
+	p := pixel{float64(x), float64(y)}
+	if onLand(reg, p) {
+		return false
+	}
+	_, dist := nearestCoast(reg, p)
+	return dist > shoreTolerance
+}
+
+// seaRecords finds the records that fall in the sea, which are usually mistakes in the
+// data, and describes each of them. They are left out of the records returned unless
+// plotSea is set. Checking gives up with errTooComplex once ctx is done.
+func seaRecords(ctx context.Context, reg *baseRegion, records []record, plotSea bool) (kept []record, problems []string, err error) {
+	extra := 0
+	for i, rec := range records {
+		if i%deadlineEvery == 0 {
+			if err := checkDeadline(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !atSea(reg, rec) {
+			kept = append(kept, rec)
+			continue
+		}
+		problem := "was left off the map"
+		if plotSea {
+			kept = append(kept, rec)
+			problem = "was plotted anyway"
+		}
+		if len(problems) < maxLineProblems {
+			problems = append(problems, fmt.Sprintf("`%.5f,%.5f` is possibly in the ocean, and %s", rec.lat, rec.lon, problem))
+		} else {
+			extra++
+		}
+	}
+	if extra > 0 {
+		problems = append(problems, fmt.Sprintf("%d more record(s) are possibly in the ocean", extra))
+	}
+	return kept, problems, nil
+}
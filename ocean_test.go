@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAtSea(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"central highlands", -42.0, 146.5, false},
+		{"Hobart", -42.88, 147.33, false},
+		{"King Island", -39.9, 143.9, false}, // Drawn in its inset
+		{"off the west coast", -42.5, 144.5, true},
+		{"Bass Strait", -40.2, 146.0, true},
+	}
+	for _, tt := range tests {
+		if got := atSea(tasmania, record{lat: tt.lat, lon: tt.lon}); got != tt.want {
+			t.Errorf("%s: atSea = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSeaRecords(t *testing.T) {
+	inland, offshore := record{lat: -42.0, lon: 146.5}, record{lat: -42.5, lon: 144.5}
+	for _, plotSea := range []bool{false, true} {
+		kept, problems, err := seaRecords(context.Background(), tasmania, []record{inland, offshore}, plotSea)
+		want := "`-42.50000,144.50000` is possibly in the ocean, and was left off the map"
+		wantKept := 1
+		if plotSea {
+			want, wantKept = "`-42.50000,144.50000` is possibly in the ocean, and was plotted anyway", 2
+		}
+		if err != nil || len(kept) != wantKept || len(problems) != 1 || problems[0] != want {
+			t.Errorf("plotting sea %v: kept %d with problems %q (%v)", plotSea, len(kept), problems, err)
+		}
+	}
+
+	if _, problems, _ := seaRecords(context.Background(), tasmania, []record{inland}, false); len(problems) != 0 {
+		t.Errorf("inland record gave %q", problems)
+	}
+}
+
+func TestOceanWarningShown(t *testing.T) {
+	for _, plot := range []bool{false, true} {
+		values := url.Values{"maptype": {"plain"}, "coordinates": {"-42.0,146.5\n-42.5,144.5"}}
+		want := "is possibly in the ocean, and was left off the map"
+		if plot {
+			values.Set("plotsea", "1")
+			want = "is possibly in the ocean, and was plotted anyway"
+		}
+		rec := postForm(newMapStore().mapDisplay, "/map", values)
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("plotting sea %v: got %d without the ocean warning", plot, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Ranges that latitudes and longitudes in and around Tasmania fall in, ignoring the sign
+const (
+	latRangeMin, latRangeMax = 39.0, 44.5
+	lonRangeMin, lonRangeMax = 143.0, 149.5
+)
+
+// reversedWarning is shown when the order of the coordinates is corrected
+const reversedWarning = "coordinates appear to be in lon,lat order; auto-corrected"
+
+// lineOrder reports whether a line of cleaned coordinates has its latitude first, its
+// longitude first, or can't be told either way. Decimal lines are judged by their first two
+// fields and degrees, minutes and seconds by the degrees of each coordinate.
+func lineOrder(line string) (ordered, reversed bool) {
+	line, _ = splitFocal(line)
+	fields := strings.Split(line, ",")
+	first, second := 0, 1
+	if len(fields) >= 6 {
+		first, second = 0, 3
+	} else if len(fields) < 2 {
+		return false, false
+	}
+	a, errA := strconv.ParseFloat(fields[first], 64)
+	b, errB := strconv.ParseFloat(fields[second], 64)
+	if errA != nil || errB != nil {
+		return false, false
+	}
+	a, b = math.Abs(a), math.Abs(b)
+	isLat := func(v float64) bool { return v >= latRangeMin && v <= latRangeMax }
+	isLon := func(v float64) bool { return v >= lonRangeMin && v <= lonRangeMax }
+	return isLat(a) && isLon(b), isLon(a) && isLat(b)
+}
+
+// swapLine exchanges the latitude and longitude of a line of cleaned coordinates, keeping
+// any trailing field and the mark of a focal record where they are
+func swapLine(line string) string {
+	line, focal := splitFocal(line)
+	fields := strings.Split(line, ",")
+	if len(fields) >= 6 {
+		swapped := append(append(append([]string{}, fields[3:6]...), fields[0:3]...), fields[6:]...)
+		return markFocal(strings.Join(swapped, ","), focal)
+	}
+	fields[0], fields[1] = fields[1], fields[0]
+	return markFocal(strings.Join(fields, ","), focal)
+}
+
+// fixCoordOrder swaps the latitude and longitude on every line of coords when they appear
+// to have been entered longitude first. That is only decided when every line that can be
+// told apart is reversed, so mixed or ambiguous input is left as it was entered.
+func fixCoordOrder(coords string) (string, bool) {
+	reversedCount := 0
+	lines := newTextLines(coords)
+	for lines.Scan() { // Comments and blank lines can't be told apart either way
+		ordered, reversed := lineOrder(lines.Text())
+		if ordered {
+			return coords, false
+		} else if reversed {
+			reversedCount++
+		}
+	}
+	if reversedCount == 0 {
+		return coords, false
+	}
+
+	return mapLines(coords, func(line string) (string, bool) {
+		if _, reversed := lineOrder(line); reversed {
+			return swapLine(line), true
+		}
+		return line, true
+	}), true
+}
+
+// fixSourceOrder corrects the order of the coordinates of each source of data separately,
+// as an uploaded file can be in a different order from the coordinates typed in, and warns
+// the user if any were changed
+func (data *mapData) fixSourceOrder() {
+	changed := false
+	if len(data.Sources) == 0 {
+		data.RawCoords, changed = fixCoordOrder(data.RawCoords)
+	} else {
+		var all []string
+		for i, src := range data.Sources {
+			var swapped bool
+			data.Sources[i].coords, swapped = fixCoordOrder(src.coords)
+			changed = changed || swapped
+			all = append(all, data.Sources[i].coords)
+		}
+		data.RawCoords = strings.Join(all, "\n")
+	}
+	if changed {
+		data.Warnings = append(data.Warnings, reversedWarning)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFixCoordOrder(t *testing.T) {
+	tests := []struct {
+		name, coords, want string
+		swapped            bool
+	}{
+		{"ordered", "-42.1,147.2\n-41.5,146.5,1", "-42.1,147.2\n-41.5,146.5,1", false},
+		{"reversed", "147.2,-42.1\n146.5,-41.5,1", "-42.1,147.2\n-41.5,146.5,1", true},
+		{"reversed with comments", "# lon first\n147.2,-42.1\n\n146.5,-41.5", "# lon first\n-42.1,147.2\n\n-41.5,146.5", true},
+		{"reversed degrees and minutes", "147,12,0,-42,6,0", "-42,6,0,147,12,0", true},
+		{"mixed", "147.2,-42.1\n-41.5,146.5", "147.2,-42.1\n-41.5,146.5", false},
+		{"ambiguous", "12.5,30.1\n-1,2", "12.5,30.1\n-1,2", false},
+		{"unparsed", "garbage\nnonsense", "garbage\nnonsense", false},
+	}
+	for _, tt := range tests {
+		if got, swapped := fixCoordOrder(tt.coords); got != tt.want || swapped != tt.swapped {
+			t.Errorf("%s: got %q, swapped %v, want %q, %v", tt.name, got, swapped, tt.want, tt.swapped)
+		}
+	}
+}
+
+func TestReversedCoordsMapped(t *testing.T) {
+	reversed := "147.2,-42.1\n146.5,-41.5"
+	for _, keep := range []bool{false, true} {
+		data := baseMapData("Aus bus", "plain", reversed, defaultZone)
+		data.KeepOrder = keep
+		_, records, err := mapSVG(context.Background(), data)
+		if keep != (err != nil) {
+			t.Errorf("keeping the order %v gave %v", keep, err)
+		}
+		if !keep && (len(records) != 2 || records[0].lat != -42.1 || records[0].lon != 147.2) {
+			t.Errorf("reversed coordinates mapped as %+v", records)
+		}
+		if hasWarning := strings.Contains(strings.Join(data.Warnings, "\n"), reversedWarning); hasWarning == keep {
+			t.Errorf("keeping the order %v: warnings %q", keep, data.Warnings)
+		}
+	}
+
+	page := postForm(newMapStore().mapDisplay, "/map", url.Values{"maptype": {"plain"}, "coordinates": {reversed}}).Body.String()
+	if !strings.Contains(page, reversedWarning) {
+		t.Error("results page doesn't warn that the coordinates were swapped")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const pointsPerUnit = 72.0 / svgDPI // PDF points in one SVG user unit
+
+// circleKappa places the control points of the four Bézier curves that draw a circle
+const circleKappa = 0.5522847498
+
+// helveticaWidths are the widths of the printable ASCII characters in Helvetica, in
+// thousandths of the font size, for placing centred and right aligned text
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfWriter builds the content of a single page PDF from the elements of an SVG map
+type pdfWriter struct {
+	content bytes.Buffer
+	alphas  map[string]string // Graphics state name for each fill and stroke opacity used
+	state   string            // Graphics state in use
+}
+
+// mapPDF converts an SVG map to a single page vector PDF the size of the map. Shapes are
+// drawn as they are on PNG maps, and text is set in Helvetica, the nearest of the fonts
+// every PDF reader has. Tooltips only show in browsers, so they are left out.
+func mapPDF(doc string) ([]byte, error) {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return nil, fmt.Errorf("the map has no viewBox")
+	}
+	x0, y0, vw, vh := parseFloat(m[1]), parseFloat(m[2]), parseFloat(m[3]), parseFloat(m[4])
+	if vw <= 0 || vh <= 0 {
+		return nil, fmt.Errorf("the map has an empty viewBox")
+	}
+
+	pw := &pdfWriter{alphas: make(map[string]string), state: "1 1"}
+	// Draw in SVG units with y pointing down, as the map does
+	fmt.Fprintf(&pw.content, "%s 0 0 %s %s %s cm 1 j 1 J\n", pdfNum(pointsPerUnit), pdfNum(-pointsPerUnit),
+		pdfNum(-x0*pointsPerUnit), pdfNum((vh+y0)*pointsPerUnit))
+	err := walkSVG(doc, func(name string, attrs map[string]string, p paint, text string) {
+		if name == "text" {
+			if !strings.Contains(" "+attrs["class"]+" ", " tip ") {
+				pw.text(attrs, p, text)
+			}
+		} else {
+			pw.shape(name, attrs, p)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pw.document(vw*pointsPerUnit, vh*pointsPerUnit)
+}
+
+// shape draws a shape element, filling and outlining it as its paint says
+func (pw *pdfWriter) shape(name string, attrs map[string]string, p paint) {
+	fill, hasFill := parseColour(p.fill, p.opacity*p.fillOpacity)
+	stroke, hasStroke := parseColour(p.stroke, p.opacity*p.strokeOpacity)
+
+	var path strings.Builder
+	closed := true
+	if name == "circle" { // Drawn as curves, so it stays round however far it is zoomed
+		cx, cy, r := parseFloat(attrs["cx"]), parseFloat(attrs["cy"]), parseFloat(attrs["r"])
+		k := r * circleKappa
+		pt := func(x, y float64) string {
+			q := p.transform(pixel{cx + x, cy + y})
+			return pdfNum(q.x) + " " + pdfNum(q.y)
+		}
+		path.WriteString(pt(r, 0) + " m\n")
+		path.WriteString(pt(r, k) + " " + pt(k, r) + " " + pt(0, r) + " c\n")
+		path.WriteString(pt(-k, r) + " " + pt(-r, k) + " " + pt(-r, 0) + " c\n")
+		path.WriteString(pt(-r, -k) + " " + pt(-k, -r) + " " + pt(0, -r) + " c\n")
+		path.WriteString(pt(k, -r) + " " + pt(r, -k) + " " + pt(r, 0) + " c h\n")
+	} else {
+		var shapes [][]pixel
+		shapes, closed = elementShapes(name, attrs)
+		for _, shape := range shapes {
+			for i, pt := range shape {
+				q := p.transform(pt)
+				op := " l\n"
+				if i == 0 {
+					op = " m\n"
+				}
+				path.WriteString(pdfNum(q.x) + " " + pdfNum(q.y) + op)
+			}
+			if closed && len(shape) > 0 {
+				path.WriteString("h\n")
+			}
+		}
+	}
+	if path.Len() == 0 {
+		return
+	}
+	hasFill = hasFill && closed
+
+	var op string
+	switch {
+	case hasFill && hasStroke:
+		op = "B*"
+	case hasFill:
+		op = "f*" // Even-odd, so that lakes drawn as separate rings stay empty
+	case hasStroke:
+		op = "S"
+	default:
+		return
+	}
+	pw.setAlpha(fill.A, stroke.A, hasFill, hasStroke)
+	if hasFill {
+		fmt.Fprintf(&pw.content, "%s rg\n", pdfColour(fill.R, fill.G, fill.B))
+	}
+	if hasStroke {
+		fmt.Fprintf(&pw.content, "%s RG %s w\n", pdfColour(stroke.R, stroke.G, stroke.B), pdfNum(p.strokeWidth))
+	}
+	pw.content.WriteString(path.String() + op + "\n")
+}
+
+// text sets a text element at its position, aligned as its text-anchor says
+func (pw *pdfWriter) text(attrs map[string]string, p paint, text string) {
+	text = strings.Join(strings.Fields(text), " ")
+	fill, ok := parseColour(p.fill, p.opacity*p.fillOpacity)
+	if text == "" || !ok {
+		return
+	}
+
+	width := 0.0
+	for _, r := range text {
+		w := 556 // Anything outside ASCII is given the width of a digit
+		if r >= 32 && r <= 126 {
+			w = helveticaWidths[r-32]
+		}
+		width += float64(w) / 1000 * p.fontSize
+	}
+	pos := p.transform(pixel{parseFloat(attrs["x"]), parseFloat(attrs["y"])})
+	switch p.anchor {
+	case "middle":
+		pos.x -= width / 2
+	case "end":
+		pos.x -= width
+	}
+
+	font := "F1"
+	if p.bold {
+		font = "F2"
+	}
+	pw.setAlpha(fill.A, 255, true, false)
+	// The text matrix flips the text back up the right way, as the page is drawn upside down
+	fmt.Fprintf(&pw.content, "BT %s rg /%s %s Tf 1 0 0 -1 %s %s Tm (%s) Tj ET\n", pdfColour(fill.R, fill.G, fill.B),
+		font, pdfNum(p.fontSize), pdfNum(pos.x), pdfNum(pos.y), pdfString(text))
+}
+
+// setAlpha switches to the graphics state with the given fill and stroke opacities
+func (pw *pdfWriter) setAlpha(fillA, strokeA uint8, fill, stroke bool) {
+	if !fill {
+		fillA = 255
+	}
+	if !stroke {
+		strokeA = 255
+	}
+	key := pdfNum(float64(fillA)/255) + " " + pdfNum(float64(strokeA)/255)
+	if key == pw.state {
+		return
+	}
+	name, ok := pw.alphas[key]
+	if !ok {
+		name = fmt.Sprintf("GS%d", len(pw.alphas))
+		pw.alphas[key] = name
+	}
+	pw.state = key
+	fmt.Fprintf(&pw.content, "/%s gs\n", name)
+}
+
+// document assembles the PDF of a page of the given size in points around the content
+func (pw *pdfWriter) document(width, height float64) ([]byte, error) {
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	if _, err := io.Copy(zw, &pw.content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(pw.alphas))
+	for key := range pw.alphas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // So that the same map always gives the same file
+	var states strings.Builder
+	for _, key := range keys {
+		alpha := strings.Fields(key)
+		fmt.Fprintf(&states, "/%s << /ca %s /CA %s >> ", pw.alphas[key], alpha[0], alpha[1])
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Contents 4 0 R "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> /ExtGState << %s>> >> >>", pdfNum(width), pdfNum(height), states.String()),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes(), nil
+}
+
+// pdfNum writes a number as briefly as PDF allows, to three decimal places
+func pdfNum(f float64) string {
+	s := fmt.Sprintf("%.3f", f)
+	s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdfColour writes an RGB colour as PDF colour components
+func pdfColour(r, g, b uint8) string {
+	return pdfNum(float64(r)/255) + " " + pdfNum(float64(g)/255) + " " + pdfNum(float64(b)/255)
+}
+
+// pdfString escapes text for a PDF string in WinAnsiEncoding. Characters it can't hold are
+// written as question marks.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r <= 126:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255: // Latin-1 characters have the same codes in WinAnsiEncoding
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// servePDF responds with the map in memory as a PDF
+func (svm *svgMap) servePDF(w http.ResponseWriter) {
+	pdf, err := mapPDF(svm.svgMap)
+	if err != nil {
+		errorLog.Printf("Error converting map to PDF: %s", err)
+		serveError(w, http.StatusInternalServerError, "The map could not be converted to PDF.")
+		return
+	}
+
+	fileName := strings.TrimSuffix(svm.mapName, ".svg") + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	setAttachment(w, fileName)
+	if _, err := w.Write(pdf); err != nil {
+		errorLog.Printf("Error writing PDF map: %s", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	mediaBox  = regexp.MustCompile(`/MediaBox \[0 0 ([\d.]+) ([\d.]+)\]`)
+	pdfStream = regexp.MustCompile(`(?s)stream\n(.*)\nendstream`)
+)
+
+func TestPDFDownload(t *testing.T) {
+	ms := newMapStore()
+	rec := postForm(ms.mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2\n-41.5,146.5"},
+		"scalebar": {"1"}, "legend": {"1"},
+	})
+	m := mapfileLink.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no download link on the results page")
+	}
+	dl := httptest.NewRecorder()
+	ms.mapAsFile(dl, httptest.NewRequest("GET", "/mapfile?id="+m[1]+"&format=pdf", nil))
+	pdf := dl.Body.Bytes()
+	if ct := dl.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("PDF served as %q", ct)
+	}
+	if cd := dl.Header().Get("Content-Disposition"); !strings.Contains(cd, "aus-bus.plain.pdf") {
+		t.Errorf("PDF downloaded as %q", cd)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("response of %d bytes is not a PDF", len(pdf))
+	}
+
+	// The page has the map's shape
+	doc, _ := ms.get(m[1])
+	vb := viewBoxAttr.FindStringSubmatch(doc.svgMap)
+	box := mediaBox.FindSubmatch(pdf)
+	if vb == nil || box == nil {
+		t.Fatal("no viewBox or MediaBox")
+	}
+	pageW, _ := strconv.ParseFloat(string(box[1]), 64)
+	pageH, _ := strconv.ParseFloat(string(box[2]), 64)
+	if got, want := pageW/pageH, parseFloat(vb[3])/parseFloat(vb[4]); got < want*0.999 || got > want*1.001 {
+		t.Errorf("page is %gx%g, with aspect %g rather than the map's %g", pageW, pageH, got, want)
+	}
+
+	// The title and the scale bar's labels are set as text
+	s := pdfStream.FindSubmatch(pdf)
+	if s == nil {
+		t.Fatal("no content stream")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(s[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"(Aus bus) Tj", "km) Tj"} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("content has no %q", want)
+		}
+	}
+}
+
+func TestPDFStrings(t *testing.T) {
+	if got := pdfString("Aus (bus) \\ café ✓"); got != `Aus \(bus\) \\ caf\351 ?` {
+		t.Errorf("pdfString gave %q", got)
+	}
+	for f, want := range map[float64]string{1.5: "1.5", 2: "2", -0.0001: "0", 0.12345: "0.123"} {
+		if got := pdfNum(f); got != want {
+			t.Errorf("pdfNum(%g) = %q, want %q", f, got, want)
+		}
+	}
+	if _, err := mapPDF("<svg></svg>"); err == nil {
+		t.Error("map without a viewBox converted")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+const maxPrecision = 10 // Most decimal places coordinates are read with
+
+// coordPrecision is the number of decimal places coordinates are rounded to unless a
+// request asks for another, set by -precision. Five places is about a metre, finer than
+// any herbarium record is located.
+var coordPrecision = 5
+
+// parsePrecision reads the requested number of decimal places to round coordinates to,
+// from 1 to maxPrecision, giving coordPrecision for anything else
+func parsePrecision(value string) int {
+	places, err := strconv.Atoi(value)
+	if err != nil || places < 1 {
+		return coordPrecision
+	}
+	if places > maxPrecision {
+		return maxPrecision
+	}
+	return places
+}
+
+// parseDecimals reads the number of decimal places asked for in exported coordinates,
+// from 1 to maxPrecision, giving 0 for anything else, which exports them as they were
+// given
+func parseDecimals(value string) int {
+	places, err := strconv.Atoi(value)
+	if err != nil || places < 1 {
+		return 0
+	}
+	if places > maxPrecision {
+		return maxPrecision
+	}
+	return places
+}
+
+// roundRecords rounds the coordinates of every record to the given number of decimal
+// places, so that everything worked out from them, such as duplicates and the area they
+// cover, agrees with the precision they are mapped at. The coordinates as given are kept,
+// for exports that ask for them.
+func roundRecords(records []record, places int) {
+	scale := math.Pow(10, float64(places))
+	for i := range records {
+		if !records[i].rounded {
+			records[i].exactLat, records[i].exactLon = records[i].given()
+			records[i].rounded = true
+		}
+		records[i].lat = math.Round(records[i].lat*scale) / scale
+		records[i].lon = math.Round(records[i].lon*scale) / scale
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRoundRecords(t *testing.T) {
+	records := []record{{lat: -42.1234567891, lon: 147.9876543219}, {lat: -41.000005, lon: 146.499995}}
+	roundRecords(records, 5)
+	if records[0].lat != -42.12346 || records[0].lon != 147.98765 || records[1].lat != -41.00001 || records[1].lon != 146.5 {
+		t.Errorf("rounded to %+v", records)
+	}
+}
+
+func TestPrecisionFeedsDedupe(t *testing.T) {
+	coords := "-42.123451,147.234561\n-42.123454,147.234564\n" // Apart in the sixth decimal place
+	for _, tt := range []struct{ precision, records int }{{5, 1}, {10, 2}} {
+		data := baseMapData("Aus bus", "plain", coords, defaultZone)
+		data.Precision, data.Dedupe, data.DedupePlaces = tt.precision, true, maxDedupePlaces
+		_, records, err := mapSVG(context.Background(), data)
+		if err != nil || len(records) != tt.records {
+			t.Errorf("precision %d: %d records after merging duplicates (%v), want %d", tt.precision, len(records), err, tt.records)
+		}
+		if tt.precision == 5 && len(records) == 1 && (records[0].lat != -42.12345 || records[0].lon != 147.23456) {
+			t.Errorf("merged record at %g, %g", records[0].lat, records[0].lon)
+		}
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", coordPrecision},
+		{"3", 3},
+		{"0", coordPrecision},
+		{"-2", coordPrecision},
+		{"12", maxPrecision},
+		{"five", coordPrecision},
+	}
+	for _, tt := range tests {
+		if got := parsePrecision(tt.value); got != tt.want {
+			t.Errorf("parsePrecision(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	utm "github.com/kurankat/tasutm"
+)
+
+// Map layout used by the mapper package. Overlays drawn by the server must use the same
+// values so that they register with the coastline and the points the mapper draws.
+const (
+	leftMargin   = 30   // Left margin of map in pixels
+	topMargin    = 30   // Top margin of map in pixels
+	canvasWidth  = 910  // Width of the SVG canvas in pixels
+	canvasHeight = 1260 // Height of the SVG canvas in pixels
+	cellSide     = 25   // Pixel dimensions of each side of a cell in grid map
+	pixelSize    = 400  // Metres per pixel, the same in both directions
+)
+
+// inset is an outlying part of a region that is drawn moved closer to the rest of it
+type inset struct {
+	minEasting, maxEasting   int // Area of the inset in UTM metres
+	minNorthing, maxNorthing int
+	westLine                 int // Easting drawn at the left margin for positions in the inset
+}
+
+// baseRegion is an area that maps are drawn of, with its outline, the bounds of the
+// coordinates it covers and how those coordinates are projected onto the canvas
+type baseRegion struct {
+	name                     string
+	outline                  func() [][]pixel // Closed rings of the coastline in canvas pixels
+	north, south, west, east float64          // Area covered in decimal degrees
+	zone                     int              // UTM zone coordinates are projected in
+	westLine, northLine      int              // Easting and northing at the top left of the map
+	pixelSize                int              // Metres per pixel, the same in both directions
+	insets                   []inset
+}
+
+// tasmania is the region drawn by the mapper package, including King Island, which is
+// moved east to sit closer to the main island, and the Furneaux Group
+var tasmania = &baseRegion{
+	name:    "Tasmania",
+	outline: coastline,
+	north:   -39.2, south: -43.9, west: 143.5, east: 148.9,
+	zone:      55,
+	westLine:  290000,
+	northLine: 5620000,
+	pixelSize: pixelSize,
+	insets:    []inset{{220000, 260000, 5540000, 5620000, 220000}},
+}
+
+// victoria is the mainland across Bass Strait, projected at 1 km a pixel so that the
+// whole state fits on the canvas. The mapper can only draw Tasmania, and no coastline has
+// been traced for Victoria yet, so it isn't offered on the form.
+var victoria = &baseRegion{
+	name:    "Victoria",
+	outline: func() [][]pixel { return nil },
+	north:   -33.9, south: -39.2, west: 140.9, east: 150.0,
+	zone:      55,
+	westLine:  -60000,
+	northLine: 6250000,
+	pixelSize: 1000,
+}
+
+// baseRegions are the regions maps can be drawn of, by name
+var baseRegions = map[string]*baseRegion{
+	"tasmania": tasmania,
+	"victoria": victoria,
+}
+
+// defaultRegion is the region maps are drawn of unless another is chosen
+const defaultRegion = "tasmania"
+
+// region returns the base region the map is drawn of, or Tasmania if none was chosen
+func (data *mapData) region() *baseRegion {
+	if reg, ok := baseRegions[data.Region]; ok {
+		return reg
+	}
+	return baseRegions[defaultRegion]
+}
+
+// project converts a latitude and longitude to the pixel position it is plotted at on maps
+// of the region, including any shift into an inset such as King Island's
+func (reg *baseRegion) project(lat, lon float64) (x, y int) {
+	x, y, _ = reg.projectFrame(lat, lon)
+	return x, y
+}
+
+// projectFrame converts a latitude and longitude to a pixel position on maps of the region,
+// also returning the inset the position was shifted into, or nil if it wasn't
+func (reg *baseRegion) projectFrame(lat, lon float64) (x, y int, in *inset) {
+	easting, northing, _, _, err := utm.FromLatLonZone(lat, lon, false, reg.zone)
+	if err != nil {
+		return 0, 0, nil
+	}
+	e, n := int(easting), int(northing)
+
+	westLine := reg.westLine
+	for i, ins := range reg.insets {
+		if e > ins.minEasting && e < ins.maxEasting && n > ins.minNorthing && n < ins.maxNorthing {
+			in, westLine = &reg.insets[i], ins.westLine
+			break
+		}
+	}
+
+	x = (e-westLine)/reg.pixelSize + leftMargin
+	y = ((reg.northLine-1)-n)/reg.pixelSize + topMargin
+	return x, y, in
+}
+
+// unproject converts a canvas position on maps of the region back to a latitude and
+// longitude, in the frame of the given inset if it isn't nil
+func (reg *baseRegion) unproject(p pixel, in *inset) (lat, lon float64, err error) {
+	westLine := float64(reg.westLine)
+	if in != nil {
+		westLine = float64(in.westLine)
+	}
+
+	easting := (p.x-leftMargin)*float64(reg.pixelSize) + westLine
+	northing := float64(reg.northLine-1) - (p.y-topMargin)*float64(reg.pixelSize)
+	return utm.ToLatLon(easting, northing, reg.zone, "", false)
+}
+
+// contains reports whether a latitude and longitude fall within the area the region covers
+func (reg *baseRegion) contains(lat, lon float64) bool {
+	return lat <= reg.north && lat >= reg.south && lon >= reg.west && lon <= reg.east
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	utm "github.com/kurankat/tasutm"
+)
+
+func TestProjectAgainstRegions(t *testing.T) {
+	const lat, lon = -39.6, 146.4 // In Bass Strait, between the two regions
+	easting, northing, _, _, err := utm.FromLatLonZone(lat, lon, false, 55)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]int
+	for _, reg := range []*baseRegion{tasmania, victoria} {
+		x, y := reg.project(lat, lon)
+		wantX := (int(easting)-reg.westLine)/reg.pixelSize + leftMargin
+		wantY := ((reg.northLine-1)-int(northing))/reg.pixelSize + topMargin
+		if x != wantX || y != wantY {
+			t.Errorf("%s: projected to %d,%d, want %d,%d", reg.name, x, y, wantX, wantY)
+		}
+		got = append(got, [2]int{x, y})
+	}
+	if got[0] == got[1] {
+		t.Errorf("both regions place the point at %v", got[0])
+	}
+}
+
+func TestMapRegion(t *testing.T) {
+	data := baseMapData("", "plain", "-37.81,144.96\n-42.88,147.33", defaultZone)
+	if data.region() != tasmania {
+		t.Errorf("maps drawn of %s by default", data.region().name)
+	}
+	problems, _ := validateLines(context.Background(), data.region(), data.RawCoords, false, false, false)
+	if len(problems) != 1 || problems[0] != "line 1: `-37.81,144.96` is outside the area covered by the map, and was left off it" {
+		t.Errorf("Tasmania gave problems %q", problems)
+	}
+
+	data.Region = "victoria"
+	problems, _ = validateLines(context.Background(), data.region(), data.RawCoords, false, false, false)
+	if data.region() != victoria || len(problems) != 1 || problems[0] != "line 2: `-42.88,147.33` is outside the area covered by the map, and was left off it" {
+		t.Errorf("Victoria gave problems %q", problems)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+const (
+	minSymbolRadius = 4.0  // Radius in pixels of the symbol of a locality with a single record
+	maxSymbolRadius = 40.0 // Radius in pixels of the symbol of the locality with the most records
+)
+
+const symbolStyle = "fill:#3182bd;fill-opacity:0.6;stroke:black"
+
+// symbolRadius returns the radius of the symbol for a locality with count records, where
+// max is the most records at any locality. Areas rather than radii are proportional to the
+// counts, so that large counts don't swamp the map.
+func symbolRadius(count, max int) int {
+	if max <= 1 {
+		return int(minSymbolRadius)
+	}
+	return int(math.Round(math.Max(minSymbolRadius, maxSymbolRadius*math.Sqrt(float64(count)/float64(max)))))
+}
+
+// proportionalMap draws the Tasmania outline with a circle at each locality sized by the
+// number of records there. Records are grouped into localities by rounding their
+// coordinates to the given number of decimal places, and the circles are drawn from the
+// largest to the smallest so that small ones aren't hidden.
+func proportionalMap(reg *baseRegion, rl *mapper.RecordList, records []record, places int, w io.Writer) {
+	localities, _ := dedupeRecords(records, places)
+	sort.SliceStable(localities, func(i, j int) bool { return localities[i].weight() > localities[j].weight() })
+	max := 0
+	if len(localities) > 0 {
+		max = localities[0].weight()
+	}
+
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid("symbols")
+	for _, loc := range localities {
+		x, y := reg.project(loc.lat, loc.lon)
+		canvas.Circle(x, y, symbolRadius(loc.weight(), max), symbolStyle, fmt.Sprintf(`data-count="%d"`, loc.weight()))
+	}
+	canvas.Gend()
+
+	if max > 0 {
+		symbolSizeLegend(canvas, max)
+	}
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
+
+// symbolSizeLegend draws example symbols for the largest count on the map, about a quarter
+// of it and a single record, each labelled with its count
+func symbolSizeLegend(canvas *svg.SVG, max int) {
+	const x, y = 40, 950
+	textStyle := "font-size:20px;font-family:Arial;fill:#000000"
+
+	examples := []int{max}
+	for _, n := range []int{(max + 2) / 4, 1} {
+		if n < examples[len(examples)-1] {
+			examples = append(examples, n)
+		}
+	}
+
+	canvas.Gid("legend")
+	canvas.Text(x, y, "Records per locality", textStyle+";font-weight:bold")
+	top := y + 15
+	for _, n := range examples {
+		r := symbolRadius(n, max)
+		row := int(math.Max(float64(2*r), 20)) // Small symbols still get a full row for their label
+		canvas.Circle(x+int(maxSymbolRadius), top+row/2, r, symbolStyle)
+		canvas.Text(x+int(2*maxSymbolRadius)+15, top+row/2+7, fmt.Sprint(n), textStyle)
+		top += row + 10
+	}
+	canvas.Gend()
+}
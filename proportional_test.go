@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var symbolCircle = regexp.MustCompile(`<circle cx="\d+" cy="\d+" r="(\d+)" [^>]*data-count="(\d+)"`)
+
+func TestSymbolRadiusFollowsCount(t *testing.T) {
+	coords := strings.Repeat("-42.0,146.5\n", 9) + strings.Repeat("-41.5,147.0\n", 4) + "-41.2,146.0\n" +
+		strings.Repeat("-42.5,147.2\n", 16)
+	doc, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "proportional", coords, defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counts, radii []int
+	for _, m := range symbolCircle.FindAllStringSubmatch(doc, -1) {
+		r, _ := strconv.Atoi(m[1])
+		n, _ := strconv.Atoi(m[2])
+		radii, counts = append(radii, r), append(counts, n)
+	}
+	if want := []int{16, 9, 4, 1}; len(counts) != len(want) {
+		t.Fatalf("symbols drawn for counts %v, want %v", counts, want)
+	} else {
+		for i := range want {
+			if counts[i] != want[i] {
+				t.Errorf("symbols drawn for counts %v, want largest first %v", counts, want)
+				break
+			}
+		}
+	}
+	for i := 1; i < len(radii); i++ {
+		if radii[i] >= radii[i-1] {
+			t.Errorf("radii %v don't fall with counts %v", radii, counts)
+		}
+	}
+	if radii[0] != int(maxSymbolRadius) || radii[len(radii)-1] != 10 { // A sixteenth of the records, a quarter of the radius
+		t.Errorf("radii run from %d to %d, want 40 to 10", radii[0], radii[len(radii)-1])
+	}
+	for _, want := range []string{"Records per locality", ">16<", ">4<", ">1<"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("size legend has no %q", want)
+		}
+	}
+}
+
+func TestSymbolRadius(t *testing.T) {
+	tests := []struct{ count, max, want int }{
+		{1, 1, 4},
+		{16, 16, 40},
+		{4, 16, 20}, // A quarter of the records gives a quarter of the area
+		{1, 10000, 4},
+	}
+	for _, tt := range tests {
+		if got := symbolRadius(tt.count, tt.max); got != tt.want {
+			t.Errorf("symbolRadius(%d, %d) = %d, want %d", tt.count, tt.max, got, tt.want)
+		}
+	}
+}
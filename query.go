@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const maxQueryLength = 8000 // Longest query string in bytes read for a map linked to by its URL
+
+// hasQueryMap reports whether a GET request to "/map" carries coordinates to draw, rather
+// than being a visit to be sent to the form
+func hasQueryMap(r *http.Request) bool {
+	return r.URL.Query().Get("coords") != "" || r.URL.Query().Get("coordinates") != ""
+}
+
+// queryCoords returns the coordinates given in a map's URL, as "coords" or "coordinates".
+// Records are separated by newlines, or by the character given as "sep", such as "|", for
+// links written by hand. A separator that can appear within a record is refused.
+func queryCoords(r *http.Request) (string, error) {
+	coords := r.FormValue("coords")
+	if coords == "" {
+		coords = r.FormValue("coordinates")
+	}
+	sep := r.FormValue("sep")
+	if sep == "" {
+		return coords, nil
+	}
+	if strings.ContainsAny(sep, ",.-+0123456789 ") {
+		return "", fmt.Errorf("The separator %q can't be used, as it can appear within a record", sep)
+	}
+	return strings.ReplaceAll(coords, sep, "\n"), nil
+}
+
+// serveQueryMap draws a map from the query parameters of a GET request, taking the same
+// options as the form, and responds with the SVG itself so that the URL can be linked to or
+// used as an image. The map type is plain unless another is given.
+func serveQueryMap(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.RawQuery) > maxQueryLength {
+		serveError(w, http.StatusRequestURITooLong, fmt.Sprintf("The link is too long to draw a map from. "+
+			"Links can hold at most %d characters of coordinates and options; please use the form for larger data sets.",
+			maxQueryLength))
+		return
+	}
+	coords, err := queryCoords(r)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Form.Set("coordinates", coords)
+	if r.FormValue("maptype") == "" {
+		r.Form.Set("maptype", "plain")
+	}
+
+	data := newMapData(r)
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	svgMap, _, err := mapSVG(ctx, data)
+	if err != nil {
+		serveError(w, renderStatus(err), err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	writeDownload(w, r, svgMap)
+}
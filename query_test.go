@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// getMap requests a map by its URL, returning the response
+func getMap(query url.Values) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	newMapStore().mapDisplay(rec, httptest.NewRequest("GET", "/map?"+query.Encode(), nil))
+	return rec
+}
+
+func TestQueryMap(t *testing.T) {
+	rec := getMap(url.Values{"taxon": {"Aus bus"}, "maptype": {"grid"}, "coords": {"-42.1,147.2\n-41.5,146.5"}})
+	doc := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" ||
+		!strings.HasPrefix(doc, "<?xml") || !strings.Contains(doc, "<title>Aus bus, grid map</title>") {
+		t.Fatalf("GET with coordinates gave %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if sep := getMap(url.Values{"taxon": {"Aus bus"}, "maptype": {"grid"}, "coords": {"-42.1,147.2|-41.5,146.5"}, "sep": {"|"}}); sep.Body.String() != doc {
+		t.Error("records separated by sep drew another map")
+	}
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+	}{
+		{"separator within a record", url.Values{"coords": {"-42.1,147.2"}, "sep": {","}}, http.StatusBadRequest},
+		{"too long", url.Values{"coords": {strings.Repeat("-42.1,147.2\n", maxQueryLength/10)}}, http.StatusRequestURITooLong},
+		{"no coordinates", url.Values{"taxon": {"Aus bus"}}, http.StatusMovedPermanently},
+	}
+	for _, tt := range tests {
+		if rec := getMap(tt.query); rec.Code != tt.status || rec.Header().Get("Content-Type") == "image/svg+xml" {
+			t.Errorf("%s gave %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+
+	rec = postForm(newMapStore().mapDisplay, "/map", url.Values{"maptype": {"grid"}, "coordinates": {"-42.1,147.2\n-41.5,146.5"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<div id="svg-map-preview">`) {
+		t.Errorf("form submission gave %d without the results page", rec.Code)
+	}
+}
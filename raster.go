@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPNGWidth = 1200    // Width in pixels of PNG maps when no DPI is requested
+	maxPNGWidth     = 6000    // Largest width in pixels a PNG map can be drawn at
+	maxPNGPixels    = 8000000 // Largest number of pixels a PNG map can be drawn with, about 32 MB of image
+	svgDPI          = 96      // Resolution that one SVG user unit corresponds to
+)
+
+var (
+	transformFunc = regexp.MustCompile(`(matrix|translate|scale|rotate)\(([^)]*)\)`)
+	hexColour     = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+	namedColours = map[string]color.RGBA{
+		"black": {0, 0, 0, 255}, "white": {255, 255, 255, 255}, "red": {255, 0, 0, 255},
+		"blue": {0, 0, 255, 255}, "green": {0, 128, 0, 255}, "grey": {128, 128, 128, 255},
+		"gray": {128, 128, 128, 255},
+	}
+)
+
+// paint describes how a shape is filled and outlined, following the SVG style properties
+// the maps use
+type paint struct {
+	fill, stroke  string
+	strokeWidth   float64
+	opacity       float64
+	fillOpacity   float64
+	strokeOpacity float64
+	matrix        affine // Transform from the element's coordinates to those of the document
+	fontSize      float64
+	bold          bool
+	anchor        string // Which end of text its position is at, as text-anchor gives it
+}
+
+// rasterizer draws the shapes of an SVG map onto an image
+type rasterizer struct {
+	img           *image.RGBA
+	scale, x0, y0 float64 // Mapping from the SVG viewBox to image pixels
+}
+
+// affine is an SVG transform matrix [a b c d e f], taking x, y to ax+cy+e, bx+dy+f
+type affine [6]float64
+
+// identity is the transform that leaves points where they are
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+// then returns the transform that applies m and then t, as a parent's transform t applies
+// to what a child's transform m gives
+func (m affine) then(t affine) affine {
+	return affine{
+		t[0]*m[0] + t[2]*m[1], t[1]*m[0] + t[3]*m[1],
+		t[0]*m[2] + t[2]*m[3], t[1]*m[2] + t[3]*m[3],
+		t[0]*m[4] + t[2]*m[5] + t[4], t[1]*m[4] + t[3]*m[5] + t[5],
+	}
+}
+
+// apply transforms a point
+func (m affine) apply(pt pixel) pixel {
+	return pixel{m[0]*pt.x + m[2]*pt.y + m[4], m[1]*pt.x + m[3]*pt.y + m[5]}
+}
+
+// scale returns how much the transform enlarges lengths, on average over directions
+func (m affine) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// parseTransform reads an SVG transform attribute. Its functions apply from the last to the
+// first, the way SVG nests them.
+func parseTransform(value string) affine {
+	m := identity
+	for _, fn := range transformFunc.FindAllStringSubmatch(value, -1) {
+		var args []float64
+		for _, f := range strings.FieldsFunc(fn[2], func(r rune) bool { return r == ',' || r == ' ' }) {
+			args = append(args, parseFloat(f))
+		}
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+
+		var t affine
+		switch fn[1] {
+		case "matrix":
+			if len(args) != 6 {
+				continue
+			}
+			copy(t[:], args)
+		case "translate":
+			t = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			t = affine{arg(0, 1), 0, 0, arg(1, arg(0, 1)), 0, 0}
+		case "rotate": // About the origin, or about a point given after the angle
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			cos, sin := math.Cos(a), math.Sin(a)
+			t = affine{cos, sin, -sin, cos, cx - cos*cx + sin*cy, cy - sin*cx - cos*cy}
+		}
+		m = t.then(m)
+	}
+	return m
+}
+
+// pngWidth works out the width in pixels of a PNG map of the given viewBox size from a
+// requested DPI, defaulting to defaultPNGWidth. The width is never larger than maxPNGWidth,
+// and is made smaller still if the map would otherwise take more than maxPNGPixels.
+func pngWidth(dpi string, viewWidth, viewHeight float64) int {
+	width := defaultPNGWidth
+	if d, err := strconv.ParseFloat(dpi, 64); err == nil && d > 0 {
+		width = int(math.Min(viewWidth*d/svgDPI, maxPNGWidth))
+	}
+	if viewWidth > 0 && viewHeight > 0 {
+		fit := int(math.Sqrt(maxPNGPixels * viewWidth / viewHeight)) // Widest the map can be within the pixels allowed
+		if width > fit {
+			width = fit
+		}
+	}
+	if width < 1 {
+		return 1
+	}
+	return width
+}
+
+// rasterize draws an SVG map onto a white image of the given width. It understands the
+// shapes and styles the mapper and this server produce, which are lines, rectangles,
+// circles, polygons, paths and text. Curves in paths are drawn as straight lines, and text is
+// drawn in a small built-in bitmap font, as there are no other fonts to draw it with.
+func rasterize(doc string, width int) (*image.RGBA, error) {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return nil, fmt.Errorf("the map has no viewBox")
+	}
+	x0, _ := strconv.ParseFloat(m[1], 64)
+	y0, _ := strconv.ParseFloat(m[2], 64)
+	vw, _ := strconv.ParseFloat(m[3], 64)
+	vh, _ := strconv.ParseFloat(m[4], 64)
+	if vw <= 0 || vh <= 0 {
+		return nil, fmt.Errorf("the map has an empty viewBox")
+	}
+
+	scale := float64(width) / vw
+	height := int(math.Ceil(vh * scale))
+	if float64(width)*float64(height) > maxPNGPixels*1.01 { // Allowing for height rounding up
+		return nil, fmt.Errorf("the map would take more than %d pixels", maxPNGPixels)
+	}
+	ras := &rasterizer{img: image.NewRGBA(image.Rect(0, 0, width, height)), scale: scale, x0: x0, y0: y0}
+	ras.fillRect(0, 0, width, height, color.RGBA{255, 255, 255, 255})
+
+	err := walkSVG(doc, func(name string, attrs map[string]string, p paint, text string) {
+		if name == "text" {
+			if !strings.Contains(" "+attrs["class"]+" ", " tip ") { // Tooltips are only shown on hover
+				ras.text(attrs, p, text)
+			}
+		} else {
+			ras.draw(name, attrs, p)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ras.img, nil
+}
+
+// walkSVG calls visit for every element of an SVG document in order, with its attributes
+// and the paint it is drawn with. Text elements are visited once their end is reached, with
+// all the text they hold.
+func walkSVG(doc string, visit func(name string, attrs map[string]string, p paint, text string)) error {
+	type open struct {
+		name  string
+		attrs map[string]string
+		paint paint
+		text  strings.Builder
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	root := &open{paint: paint{fill: "black", stroke: "none", strokeWidth: 1, opacity: 1, fillOpacity: 1, strokeOpacity: 1, fontSize: 16, matrix: identity}}
+	stack := []*open{root}
+	var inText *open // Text element being read, if any
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &open{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				el.attrs[a.Name.Local] = a.Value
+			}
+			el.paint = stack[len(stack)-1].paint.inherit(el.attrs)
+			stack = append(stack, el)
+			if el.name == "text" {
+				inText = el
+			} else if inText == nil {
+				visit(el.name, el.attrs, el.paint, "")
+			}
+		case xml.CharData:
+			if inText != nil {
+				inText.text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) > 1 {
+				el := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if el == inText {
+					visit(el.name, el.attrs, el.paint, el.text.String())
+					inText = nil
+				}
+			}
+		}
+	}
+}
+
+// inherit returns the paint of an element, starting from that of its parent and applying
+// the element's own style and presentation attributes. The element's transform applies
+// within its parent's, so that shapes in a moved group move with it.
+func (p paint) inherit(attrs map[string]string) paint {
+	props := make(map[string]string)
+	for _, name := range []string{"fill", "stroke", "stroke-width", "opacity", "fill-opacity", "stroke-opacity",
+		"font-size", "font-weight", "text-anchor"} {
+		if v, ok := attrs[name]; ok {
+			props[name] = v
+		}
+	}
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if kv := strings.SplitN(decl, ":", 2); len(kv) == 2 {
+			props[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	for name, v := range props {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "px"), 64)
+		switch name {
+		case "fill":
+			p.fill = v
+		case "stroke":
+			p.stroke = v
+		case "stroke-width":
+			if err == nil {
+				p.strokeWidth = f
+			}
+		case "opacity":
+			if err == nil {
+				p.opacity *= f
+			}
+		case "fill-opacity":
+			if err == nil {
+				p.fillOpacity = f
+			}
+		case "stroke-opacity":
+			if err == nil {
+				p.strokeOpacity = f
+			}
+		case "font-size":
+			if err == nil {
+				p.fontSize = f
+			}
+		case "font-weight":
+			p.bold = v == "bold" || v == "bolder" || f >= 600
+		case "text-anchor":
+			p.anchor = v
+		}
+	}
+
+	if t, ok := attrs["transform"]; ok {
+		p.matrix = parseTransform(t).then(p.matrix)
+	}
+	return p
+}
+
+// draw draws a single element
+func (ras *rasterizer) draw(name string, attrs map[string]string, p paint) {
+	shapes, closed := elementShapes(name, attrs)
+	if shapes == nil {
+		return
+	}
+	for _, shape := range shapes {
+		for i, pt := range shape {
+			shape[i] = ras.toImage(p.transform(pt))
+		}
+	}
+
+	if closed {
+		if c, ok := parseColour(p.fill, p.opacity*p.fillOpacity); ok {
+			ras.fillPolygons(shapes, c)
+		}
+	}
+	if c, ok := parseColour(p.stroke, p.opacity*p.strokeOpacity); ok {
+		width := math.Max(1, p.strokeWidth*p.matrix.scale()*ras.scale)
+		for _, shape := range shapes {
+			for i := 0; i+1 < len(shape); i++ {
+				ras.strokeSegment(shape[i], shape[i+1], width, c)
+			}
+			if closed && len(shape) > 2 {
+				ras.strokeSegment(shape[len(shape)-1], shape[0], width, c)
+			}
+		}
+	}
+}
+
+// elementShapes returns the outlines of a shape element in its own coordinates, and
+// whether they are closed. Elements that aren't shapes have none.
+func elementShapes(name string, attrs map[string]string) (shapes [][]pixel, closed bool) {
+	num := func(key string) float64 { return parseFloat(attrs[key]) }
+
+	closed = true
+	switch name {
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		shapes = [][]pixel{{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}}
+	case "circle":
+		cx, cy, r := num("cx"), num("cy"), num("r")
+		const steps = 48
+		ring := make([]pixel, steps)
+		for i := range ring {
+			a := 2 * math.Pi * float64(i) / steps
+			ring[i] = pixel{cx + r*math.Cos(a), cy + r*math.Sin(a)}
+		}
+		shapes = [][]pixel{ring}
+	case "line":
+		shapes = [][]pixel{{{num("x1"), num("y1")}, {num("x2"), num("y2")}}}
+		closed = false
+	case "polygon", "polyline":
+		var ring []pixel
+		fields := strings.FieldsFunc(attrs["points"], func(r rune) bool { return r == ',' || r == ' ' })
+		for i := 0; i+1 < len(fields); i += 2 {
+			ring = append(ring, pixel{parseFloat(fields[i]), parseFloat(fields[i+1])})
+		}
+		shapes = [][]pixel{ring}
+		closed = name == "polygon"
+	case "path":
+		shapes = parsePath(attrs["d"])
+	}
+	return shapes, closed
+}
+
+// transform takes a point in an element's own coordinates to those of the document
+func (p paint) transform(pt pixel) pixel {
+	return p.matrix.apply(pt)
+}
+
+// toImage converts a point in SVG user units to image pixels
+func (ras *rasterizer) toImage(pt pixel) pixel {
+	return pixel{(pt.x - ras.x0) * ras.scale, (pt.y - ras.y0) * ras.scale}
+}
+
+// fillPolygons fills the area inside a set of rings by the even-odd rule, sampling the
+// centre of each pixel along every row
+func (ras *rasterizer) fillPolygons(rings [][]pixel, c color.RGBA) {
+	bounds := ras.img.Bounds()
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, ring := range rings {
+		for _, pt := range ring {
+			minY, maxY = math.Min(minY, pt.y), math.Max(maxY, pt.y)
+		}
+	}
+
+	for y := int(math.Max(0, math.Floor(minY))); y < bounds.Max.Y && float64(y) <= maxY; y++ {
+		sy := float64(y) + 0.5
+		var xs []float64
+		for _, ring := range rings {
+			for i := range ring {
+				a, b := ring[i], ring[(i+1)%len(ring)]
+				if (a.y > sy) != (b.y > sy) {
+					xs = append(xs, a.x+(sy-a.y)/(b.y-a.y)*(b.x-a.x))
+				}
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(math.Ceil(xs[i] - 0.5)); float64(x)+0.5 <= xs[i+1]; x++ {
+				ras.blend(x, y, c)
+			}
+		}
+	}
+}
+
+// strokeSegment draws a straight line of the given width in pixels between two points
+func (ras *rasterizer) strokeSegment(a, b pixel, width float64, c color.RGBA) {
+	dx, dy := b.x-a.x, b.y-a.y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return
+	}
+	nx, ny := -dy/length*width/2, dx/length*width/2
+	ras.fillPolygons([][]pixel{{{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny}, {b.x - nx, b.y - ny}, {a.x - nx, a.y - ny}}}, c)
+}
+
+// fillRect fills a rectangle of the image with a solid colour
+func (ras *rasterizer) fillRect(x0, y0, x1, y1 int, c color.RGBA) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			ras.img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// blend draws a colour over a single pixel, mixing it with what is there by its alpha
+func (ras *rasterizer) blend(x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(ras.img.Bounds())) {
+		return
+	}
+	under := ras.img.RGBAAt(x, y)
+	a := float64(c.A) / 255
+	mix := func(top, bottom uint8) uint8 { return uint8(float64(top)*a + float64(bottom)*(1-a) + 0.5) }
+	ras.img.SetRGBA(x, y, color.RGBA{mix(c.R, under.R), mix(c.G, under.G), mix(c.B, under.B), 255})
+}
+
+// parseColour reads an SVG colour as hex or by name, with the given opacity. It reports
+// false for "none" and colours it doesn't know.
+func parseColour(value string, opacity float64) (color.RGBA, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	c, ok := namedColours[value]
+	if m := hexColour.FindStringSubmatch(value); m != nil {
+		hex := m[1]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, _ := strconv.ParseUint(hex, 16, 32)
+		c, ok = color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true
+	}
+	if !ok || opacity <= 0 {
+		return c, false
+	}
+	c.A = uint8(math.Min(1, opacity)*255 + 0.5)
+	return c, true
+}
+
+// servePNG responds with the map in memory drawn as a PNG image at the requested DPI
+func (svm *svgMap) servePNG(w http.ResponseWriter, dpi string) {
+	viewWidth, viewHeight := float64(canvasWidth), float64(canvasHeight)
+	if m := viewBoxAttr.FindStringSubmatch(svm.svgMap); m != nil {
+		viewWidth, viewHeight = parseFloat(m[3]), parseFloat(m[4])
+	}
+
+	img, err := rasterize(svm.svgMap, pngWidth(dpi, viewWidth, viewHeight))
+	if err != nil {
+		errorLog.Printf("Error rasterising map: %s", err)
+		serveError(w, http.StatusInternalServerError, "The map could not be converted to PNG.")
+		return
+	}
+
+	fileName := strings.TrimSuffix(svm.mapName, ".svg") + ".png"
+	w.Header().Set("Content-Type", "image/png")
+	setAttachment(w, fileName)
+	if err := png.Encode(w, img); err != nil {
+		errorLog.Printf("Error writing PNG map: %s", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPNGDownload(t *testing.T) {
+	ms := newMapStore()
+	doc, err := renderMap("Aus bus", "plain", "-42.1,147.2\n-41.5,146.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ms.add(&svgMap{mapName: "aus-bus.plain.svg", svgMap: doc})
+
+	for _, tt := range []struct {
+		dpi   string
+		width int
+	}{{"", defaultPNGWidth}, {"192", 2 * canvasWidth}} {
+		rec := httptest.NewRecorder()
+		ms.mapAsFile(rec, httptest.NewRequest("GET", "/mapfile?id="+id+"&format=png&dpi="+tt.dpi, nil))
+		body := rec.Body.Bytes()
+		if rec.Code != http.StatusOK || !bytes.HasPrefix(body, []byte("\x89PNG\r\n\x1a\n")) {
+			t.Fatalf("dpi %q gave %d without a PNG", tt.dpi, rec.Code)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(body))
+		height := (tt.width*canvasHeight + canvasWidth - 1) / canvasWidth
+		if err != nil || cfg.Width != tt.width || cfg.Height != height {
+			t.Errorf("dpi %q gave %dx%d, want %dx%d (%v)", tt.dpi, cfg.Width, cfg.Height, tt.width, height, err)
+		}
+	}
+}
+
+func TestPNGWidthLimitsPixels(t *testing.T) {
+	tests := []struct {
+		dpi        string
+		vw, vh     float64
+		wantAtMost int
+	}{
+		{"", 910, 1260, defaultPNGWidth},
+		{"9600", 910, 1260, maxPNGWidth},
+		{"9600", 10, 5000, 219}, // Tall and narrow, so the height would be far too great
+		{"9600", 100, 100000, 154},
+	}
+	for _, tt := range tests {
+		w := pngWidth(tt.dpi, tt.vw, tt.vh)
+		h := int(float64(w) * tt.vh / tt.vw)
+		if w > tt.wantAtMost || w < 1 || w*h > maxPNGPixels {
+			t.Errorf("pngWidth(%q, %g, %g) = %d, giving %d pixels", tt.dpi, tt.vw, tt.vh, w, w*h)
+		}
+	}
+	if _, err := rasterize(`<svg viewBox="0 0 1 1000"></svg>`, 1000); err == nil {
+		t.Error("map of too many pixels drawn")
+	}
+}
+
+// dark reports whether the pixel at x, y has been drawn on
+func dark(img *image.RGBA, x, y int) bool {
+	return img.RGBAAt(x, y).R < 128
+}
+
+func TestRasterizeNestedTransforms(t *testing.T) {
+	doc := `<svg viewBox="0 0 100 100"><g transform="translate(50 0)"><g transform="scale(2)">` +
+		`<circle cx="5" cy="10" r="2" fill="black"/></g></g>` +
+		`<rect x="0" y="0" width="4" height="4" transform="rotate(90 10 10)" fill="black"/></svg>`
+	img, err := rasterize(doc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dark(img, 60, 20) || dark(img, 5, 10) || dark(img, 10, 20) {
+		t.Error("circle not moved by both of its groups")
+	}
+	if !dark(img, 18, 2) || dark(img, 2, 2) {
+		t.Error("square not rotated about its centre point")
+	}
+}
+
+func TestRasterizeText(t *testing.T) {
+	doc := `<svg viewBox="0 0 200 40"><text x="100" y="30" font-size="20" text-anchor="middle">HO</text>` +
+		`<text x="0" y="30" class="tip">hidden</text></svg>`
+	img, err := rasterize(doc, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drawn, left, right := 0, 200, 0
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 200; x++ {
+			if dark(img, x, y) {
+				drawn++
+				if x < left {
+					left = x
+				}
+				if x > right {
+					right = x
+				}
+			}
+		}
+	}
+	if drawn == 0 || left < 85 || right > 115 || (left+right)/2 < 97 || (left+right)/2 > 103 {
+		t.Errorf("text drawn over %d pixels from x %d to %d, want it centred on 100", drawn, left, right)
+	}
+}
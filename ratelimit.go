@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRate  = 2.0 // Maps each client may draw per second over time, set by -ratelimit
+	defaultBurst = 10  // Maps a client may draw at once before being limited, set by -rateburst
+	sweepEvery   = time.Minute
+)
+
+// trustProxy is whether clients are told apart by X-Forwarded-For, set by -trustproxy when
+// the server runs behind a proxy that sets it
+var trustProxy = false
+
+// bucket holds the tokens left to a client and when they were last counted
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits how often each client can draw maps with a token bucket per client
+// IP. Buckets fill at rate tokens a second up to burst, and each request takes one.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a limiter allowing rate requests a second with bursts of up to
+// burst. A rate of 0 or less turns limiting off.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// allow takes a token from the bucket of client, reporting whether there was one and if
+// not, how long until there will be
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(rl.burst), last: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(rl.burst), b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have filled up again, as they are the same as new ones, so
+// that clients seen once aren't kept for good
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < sweepEvery {
+		return
+	}
+	rl.lastSweep = now
+	for client, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= float64(rl.burst) {
+			delete(rl.buckets, client)
+		}
+	}
+}
+
+// limit refuses requests to a handler with 429 Too Many Requests once a client has used
+// up its bucket, telling it how many seconds to wait
+func (rl *rateLimiter) limit(h http.HandlerFunc) http.HandlerFunc {
+	if rl.rate <= 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := rl.allow(clientIP(r))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, r, http.StatusTooManyRequests,
+				fmt.Sprintf("Too many maps have been requested. Please try again in %d seconds.", seconds))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// clientIP returns the address of the client making a request. Behind a proxy that is the
+// last address in X-Forwarded-For, the one the proxy added, as earlier ones can be forged.
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			addrs := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
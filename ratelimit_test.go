@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fromClient sends a request from the client address to h, returning the response
+func fromClient(h http.HandlerFunc, addr, forwarded string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/map", nil)
+	req.RemoteAddr = addr
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	h := newRateLimiter(1, 3).limit(ok)
+
+	for i := 0; i < 3; i++ {
+		if rec := fromClient(h, "192.0.2.1:4000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst gave %d", i+1, rec.Code)
+		}
+	}
+	rec := fromClient(h, "192.0.2.1:4001", "") // Another port is the same client
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst gave %d, want 429", rec.Code)
+	}
+	if wait, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || wait != 1 {
+		t.Errorf("told to retry after %q, want 1 second", rec.Header().Get("Retry-After"))
+	}
+	if rec := fromClient(h, "192.0.2.2:4000", ""); rec.Code != http.StatusOK {
+		t.Errorf("another client gave %d", rec.Code)
+	}
+
+	if rec := fromClient(newRateLimiter(0, 1).limit(ok), "192.0.2.1:4000", ""); rec.Code != http.StatusOK {
+		t.Errorf("limiting turned off gave %d", rec.Code)
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	rl := newRateLimiter(10, 1)
+	if ok, _ := rl.allow("a"); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, wait := rl.allow("a"); ok || wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("second request allowed %v, wait %s", ok, wait)
+	}
+	rl.buckets["a"].last = time.Now().Add(-200 * time.Millisecond)
+	if ok, _ := rl.allow("a"); !ok {
+		t.Error("bucket didn't refill")
+	}
+
+	rl.buckets["b"] = &bucket{tokens: 1, last: time.Now().Add(-time.Hour)}
+	rl.lastSweep = time.Now().Add(-2 * sweepEvery)
+	rl.allow("c")
+	if _, kept := rl.buckets["b"]; kept {
+		t.Error("full bucket kept past a sweep")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	defer func(trust bool) { trustProxy = trust }(trustProxy)
+	tests := []struct {
+		trust     bool
+		forwarded string
+		want      string
+	}{
+		{false, "", "192.0.2.1"},
+		{false, "198.51.100.7", "192.0.2.1"}, // Not behind a proxy, so it may be forged
+		{true, "203.0.113.9, 198.51.100.7", "198.51.100.7"},
+		{true, "", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		trustProxy = tt.trust
+		req := httptest.NewRequest("GET", "/map", nil)
+		req.RemoteAddr = "192.0.2.1:4000"
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientIP(req); got != tt.want {
+			t.Errorf("trusting the proxy %v with %q gave %q, want %q", tt.trust, tt.forwarded, got, tt.want)
+		}
+	}
+
+	trustProxy = true
+	h := newRateLimiter(1, 1).limit(func(w http.ResponseWriter, r *http.Request) {})
+	fromClient(h, "10.0.0.1:80", "203.0.113.9")
+	if rec := fromClient(h, "10.0.0.1:80", "203.0.113.10"); rec.Code != http.StatusOK {
+		t.Errorf("second client behind the proxy gave %d", rec.Code)
+	}
+	if rec := fromClient(h, "10.0.0.1:80", "203.0.113.9"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("first client behind the proxy again gave %d, want 429", rec.Code)
+	}
+}
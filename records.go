@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// record is a single coordinate from the user input, converted to decimal degrees
+type record struct {
+	lat, lon   float64
+	voucher    bool
+	hasVoucher bool    // Whether the input line gave a voucher status
+	bearing    float64 // Direction in degrees clockwise from north, for directional data
+	hasBearing bool    // Whether the input line gave a bearing
+	source     string  // Where the record came from when data from several places is merged
+	count      int     // Number of duplicate records merged into this one, 0 if not merged
+	taxon      string  // Taxon named by the "##" header above the record, when several are mapped
+	category   string  // Attribute the record is coloured by on category maps, such as a decade
+	url        string  // Address of the record in an online catalogue
+	year       int     // Year the record was collected in, 0 if no date was given
+	focal      bool    // Whether the record is highlighted, from a focalPrefix on its input line
+	exactLat   float64 // Latitude as given, when lat has been rounded from it
+	exactLon   float64 // Longitude as given, when lon has been rounded from it
+	rounded    bool    // Whether lat and lon were rounded from exactLat and exactLon
+}
+
+// given returns the coordinates of the record as they were given, before rounding to the
+// precision of the map. A record moved since, such as onto land, is where it was moved to.
+func (rec record) given() (lat, lon float64) {
+	if rec.rounded {
+		return rec.exactLat, rec.exactLon
+	}
+	return rec.lat, rec.lon
+}
+
+// Patterns for a single line of input in decimal degrees or degrees, minutes and optional
+// seconds, each with an optional trailing field holding either a voucher status or a
+// bearing. They mirror the patterns used by the mapper package so that both sides agree
+// about which lines are mappable.
+var (
+	ddLine  = regexp.MustCompile(`^(-?\d{2}(?:\.\d{0,10})?),(\d{3}(?:\.\d{0,10})?)(?:,([av]|\d{1,3}(?:\.\d+)?))?$`)
+	dmsLine = regexp.MustCompile(`^(-?\d{2}),([0-5]?\d),([0-5]?\d(?:\.\d{1,9})?)?,(\d{3}),([0-5]?\d),([0-5]?\d(?:\.\d{1,9})?)?(?:,([av]|\d{1,3}(?:\.\d+)?))?$`)
+)
+
+// normaliseDelimiters rewrites lines separated by semicolons or tabs, as exported by some
+// spreadsheets, into the comma separated form the mapper expects. Semicolon separated
+// files often use decimal commas, so commas in such lines are read as decimal points
+// unless the line already has some.
+func normaliseDelimiters(raw string) string {
+	if !strings.ContainsAny(raw, ";\t") {
+		return raw
+	}
+	return mapLines(raw, func(line string) (string, bool) {
+		if !strings.ContainsAny(line, ";\t") {
+			return line, true
+		}
+		if !strings.Contains(line, ".") {
+			line = strings.ReplaceAll(line, ",", ".")
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ';' || r == '\t' })
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+		return strings.Join(fields, ","), true
+	})
+}
+
+// parseRecords reads the cleaned coordinate data line by line and returns every record it
+// can interpret. Lines that can't be interpreted are skipped, as the mapper does.
+func parseRecords(coords string) (records []record) {
+	lines := newTextLines(coords)
+	var taxon string
+	for lines.Scan() {
+		if name, ok := taxonHeading(lines.Text()); ok {
+			taxon = html.UnescapeString(name)
+		} else if rec, ok := parseLine(strings.TrimSpace(lines.Text())); ok {
+			rec.taxon = taxon
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// parseLine converts a single line of input into a record, refusing coordinates that can't
+// be anywhere on Earth
+func parseLine(line string) (rec record, ok bool) {
+	if rec, ok = parseFields(line); ok && impossibleCoords(rec) != "" {
+		return rec, false
+	}
+	return rec, ok
+}
+
+// impossibleCoords describes what is wrong with a record whose latitude or longitude is out
+// of range, such as from transposed digits that still match the line patterns, or gives ""
+// if both are possible
+func impossibleCoords(rec record) string {
+	switch {
+	case math.Abs(rec.lat) > 90:
+		return fmt.Sprintf("has a latitude of %g, beyond 90°", rec.lat)
+	case math.Abs(rec.lon) > 180:
+		return fmt.Sprintf("has a longitude of %g, beyond 180°", rec.lon)
+	}
+	return ""
+}
+
+// dropImpossible removes the lines of coords holding coordinates that can't be real, so
+// that the mapper, which doesn't check them, never draws them
+func dropImpossible(coords string) string {
+	return mapLines(coords, func(line string) (string, bool) {
+		rec, ok := parseFields(strings.TrimSpace(line))
+		return line, !ok || impossibleCoords(rec) == ""
+	})
+}
+
+// parseFields reads the fields of a single line of input into a record, without checking
+// that its coordinates are possible
+func parseFields(line string) (rec record, ok bool) {
+	var extra string
+	line, rec.focal = splitFocal(line)
+	line, rec.category, rec.url, rec.year = splitExtras(line)
+
+	if m := ddLine.FindStringSubmatch(line); m != nil {
+		rec.lat = parseFloat(m[1])
+		rec.lon = parseFloat(m[2])
+		extra = m[3]
+	} else if m := dmsLine.FindStringSubmatch(line); m != nil {
+		rec.lat = dmsToDecimal(m[1], m[2], m[3])
+		rec.lon = dmsToDecimal(m[4], m[5], m[6])
+		extra = m[7]
+	} else {
+		return rec, false
+	}
+
+	if rec.lat > 0 { // The data is all in the southern hemisphere, whatever the sign given
+		rec.lat = -rec.lat
+	}
+	// A trailing 0 or 1 could be either a voucher status or a bearing, so it is kept as both
+	// and the map type decides which is used
+	if extra == "a" || extra == "v" || extra == "0" || extra == "1" {
+		rec.voucher = extra == "v" || extra == "1"
+		rec.hasVoucher = true
+	}
+	if b, err := strconv.ParseFloat(extra, 64); err == nil {
+		if b > 360 {
+			return rec, false
+		}
+		rec.bearing, rec.hasBearing = b, true
+	}
+
+	return rec, true
+}
+
+// splitExtras separates the optional fields that can follow the voucher status or bearing
+// field, which can then be left empty: any two of a category, a collection date and a link
+// to the online record. They are the fourth and fifth fields of decimal lines and the eighth
+// and ninth of degrees, minutes and seconds. Anything starting with a URL scheme is taken as
+// the link, and kept only if it is a valid web address. A date gives the year, and is the
+// category as well unless there is another.
+func splitExtras(line string) (rest, category, link string, year int) {
+	fields := strings.Split(line, ",")
+	base := 0
+	switch len(fields) {
+	case 4, 5:
+		base = 3
+	case 8, 9:
+		base = 7
+	default:
+		return line, "", "", 0
+	}
+
+	var date string
+	for _, field := range fields[base:] {
+		field = html.UnescapeString(field)
+		if strings.Contains(field, "://") {
+			link = recordURL(field)
+		} else if y, ok := fieldYear(field); ok && year == 0 {
+			date, year = field, y
+		} else if field != "" {
+			category = field
+		}
+	}
+	if category == "" {
+		category = date
+	}
+	fields = fields[:base]
+	if fields[base-1] == "" { // No voucher status or bearing before the extra fields
+		fields = fields[:base-1]
+	}
+	return strings.Join(fields, ","), category, link, year
+}
+
+// recordURL returns the address of an online record if it is a valid http or https URL,
+// and nothing otherwise
+func recordURL(field string) string {
+	u, err := url.Parse(field)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// stripExtras removes any category or link fields, and the marks of focal records, from
+// every line of coords, leaving lines the mapper can read
+func stripExtras(coords string) string {
+	if !strings.Contains(coords, ",") {
+		return coords
+	}
+	return mapLines(coords, func(line string) (string, bool) {
+		if _, ok := taxonHeading(line); !ok {
+			line, _ = splitFocal(line)
+			line, _, _, _ = splitExtras(line)
+		}
+		return line, true
+	})
+}
+
+// dmsToDecimal converts degrees, minutes and seconds fields to decimal degrees, keeping the
+// sign of the degrees field
+func dmsToDecimal(deg, min, sec string) float64 {
+	d := parseFloat(deg)
+	dd := math.Abs(d) + parseFloat(min)/60 + parseFloat(sec)/3600
+	if strings.HasPrefix(deg, "-") {
+		return -dd
+	}
+	return dd
+}
+
+// parseFloat parses a numeric field, treating empty or malformed fields as 0
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// recordsText converts records back into decimal degree coordinate lines that the mapper
+// can read, with voucher or bearing fields if the records came with them
+func recordsText(records []record) string {
+	var sb strings.Builder
+	for _, rec := range records {
+		fmt.Fprintf(&sb, "%.6f,%.6f", rec.lat, rec.lon)
+		if rec.hasVoucher {
+			if rec.voucher {
+				sb.WriteString(",1")
+			} else {
+				sb.WriteString(",0")
+			}
+		} else if rec.hasBearing {
+			fmt.Fprintf(&sb, ",%g", rec.bearing)
+		}
+		sb.WriteByte('\n')
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormaliseDelimiters(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"-42.1;147.4", "-42.1,147.4"},
+		{"-42.1\t147.4", "-42.1,147.4"},
+		{"-42.1;147.4;1\n-41.5;146.5;0", "-42.1,147.4,1\n-41.5,146.5,0"},
+		{"-42.1\t147.4\t1\n-41.5\t146.5\t0", "-42.1,147.4,1\n-41.5,146.5,0"},
+		{"-42,1;147,4", "-42.1,147.4"}, // Decimal commas
+		{"-42.1 ; 147.4", "-42.1,147.4"},
+		{"-42.1,147.4\n-41.5;146.5", "-42.1,147.4\n-41.5,146.5"},
+	}
+	for _, tt := range tests {
+		if got := normaliseDelimiters(tt.raw); got != tt.want {
+			t.Errorf("normaliseDelimiters(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDelimitersMapAlike(t *testing.T) {
+	comma := "-42.1,147.4,1\n-41.5,146.5,0"
+	want, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", comma, defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, coords := range []string{"-42.1;147.4;1\n-41.5;146.5;0", "-42.1\t147.4\t1\n-41.5\t146.5\t0"} {
+		doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", coords, defaultZone))
+		if err != nil || doc != want || len(records) != 2 || !records[0].voucher || records[1].voucher {
+			t.Errorf("%q drawn differently from the comma separated records (%v)", coords, err)
+		}
+	}
+	plain := "-42.1;147.4\n-41.5;146.5"
+	if _, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "plain", plain, defaultZone)); err != nil ||
+		len(records) != 2 || records[0].hasVoucher {
+		t.Errorf("%q without voucher flags gave %d records (%v)", plain, len(records), err)
+	}
+}
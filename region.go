@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// mapRegion is a named area used to aggregate records on choropleth maps
+type mapRegion struct {
+	name    string
+	outline [][2]float64 // Polygon vertices as latitude, longitude pairs
+}
+
+// tasRegions are coarse regions of Tasmania used for choropleth maps. They are rough
+// rectangles taking in mainland Tasmania, King Island and the Furneaux Group, not the
+// whole state: outlying islands such as the Kent Group, Pedra Branca and Macquarie Island,
+// and the sea between the boxes, are in none of them, and records there are counted as
+// outside every region. King Island stays within the area the mapper shifts east, so its
+// outline moves with the island.
+var tasRegions = []mapRegion{
+	{"King Island", [][2]float64{{-39.58, 143.8}, {-39.58, 144.15}, {-40.15, 144.15}, {-40.15, 143.8}}},
+	{"Furneaux Group", [][2]float64{{-39.5, 147.6}, {-39.5, 148.6}, {-40.6, 148.6}, {-40.6, 147.6}}},
+	{"North West", [][2]float64{{-40.6, 144.5}, {-40.6, 146.2}, {-41.6, 146.2}, {-41.6, 144.5}}},
+	{"North", [][2]float64{{-40.6, 146.2}, {-40.6, 147.4}, {-41.6, 147.4}, {-41.6, 146.2}}},
+	{"North East", [][2]float64{{-40.6, 147.4}, {-40.6, 148.5}, {-41.6, 148.5}, {-41.6, 147.4}}},
+	{"West", [][2]float64{{-41.6, 144.5}, {-41.6, 146.0}, {-42.6, 146.0}, {-42.6, 144.5}}},
+	{"Central Highlands", [][2]float64{{-41.6, 146.0}, {-41.6, 147.0}, {-42.6, 147.0}, {-42.6, 146.0}}},
+	{"Midlands", [][2]float64{{-41.6, 147.0}, {-41.6, 147.6}, {-42.6, 147.6}, {-42.6, 147.0}}},
+	{"East Coast", [][2]float64{{-41.6, 147.6}, {-41.6, 148.5}, {-42.6, 148.5}, {-42.6, 147.6}}},
+	{"South West", [][2]float64{{-42.6, 145.4}, {-42.6, 146.7}, {-43.8, 146.7}, {-43.8, 145.4}}},
+	{"South East", [][2]float64{{-42.6, 146.7}, {-42.6, 148.2}, {-43.8, 148.2}, {-43.8, 146.7}}},
+}
+
+// choroplethRamp is the sequence of fills used to shade regions, from fewest to most records
+var choroplethRamp = []string{"#ffffb2", "#fecc5c", "#fd8d3c", "#f03b20", "#bd0026"}
+
+// contains reports whether a point lies inside the region, using the even-odd rule
+func (mr mapRegion) contains(lat, lon float64) bool {
+	in := false
+	for i, j := 0, len(mr.outline)-1; i < len(mr.outline); j, i = i, i+1 {
+		a, b := mr.outline[i], mr.outline[j]
+		if (a[0] > lat) != (b[0] > lat) &&
+			lon < (b[1]-a[1])*(lat-a[0])/(b[0]-a[0])+a[1] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// regionCounts counts the records that fall in each of the regions. Records that fall
+// outside all of them are counted separately.
+func regionCounts(records []record, regions []mapRegion) (counts []int, outside int) {
+	counts = make([]int, len(regions))
+	for _, rec := range records {
+		found := false
+		for i, reg := range regions {
+			if reg.contains(rec.lat, rec.lon) {
+				counts[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			outside++
+		}
+	}
+	return counts, outside
+}
+
+// rampIndex returns the position on a ramp of n colours for count, where max is the highest
+// count on the map
+func rampIndex(count, max, n int) int {
+	if count <= 0 || max <= 0 {
+		return -1
+	}
+	return (count*n - 1) / max
+}
+
+// choroplethMap draws the Tasmania outline with each region shaded according to how many
+// records fall within it, plus a legend explaining the shading
+func choroplethMap(reg *baseRegion, rl *mapper.RecordList, records []record, w io.Writer) {
+	counts, outside := regionCounts(records, tasRegions)
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid("regions")
+	for i, mr := range tasRegions {
+		xs, ys := make([]int, len(mr.outline)), make([]int, len(mr.outline))
+		for j, v := range mr.outline {
+			xs[j], ys[j] = reg.project(v[0], v[1])
+		}
+
+		style := "fill:none;stroke:#999999;stroke-dasharray:4"
+		if idx := rampIndex(counts[i], max, len(choroplethRamp)); idx >= 0 {
+			style = "fill:" + choroplethRamp[idx] + ";fill-opacity:0.6;stroke:#999999"
+		}
+		canvas.Polygon(xs, ys, style, fmt.Sprintf(`data-count="%d"`, counts[i]))
+	}
+	canvas.Gend()
+
+	choroplethLegend(canvas, max, outside)
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
+
+// choroplethLegend draws the legend for a choropleth map, one swatch per step of the
+// colour ramp that can contain records
+func choroplethLegend(canvas *svg.SVG, max, outside int) {
+	var fills, labels []string
+	for i, fill := range choroplethRamp {
+		low, high := i*max/len(choroplethRamp)+1, (i+1)*max/len(choroplethRamp)
+		if high < low { // Not every step is reachable when there are few records
+			continue
+		}
+		label := fmt.Sprint(low)
+		if high > low {
+			label = fmt.Sprintf("%d-%d", low, high)
+		}
+		fills, labels = append(fills, fill), append(labels, label)
+	}
+
+	rampLegend(canvas, "Records per region", fills, labels, 0.6, fmt.Sprintf("Outside all regions: %d", outside))
+}
+
+// rampLegend draws a legend of colour swatches with their labels in the empty ocean south
+// west of Tasmania, under a bold title and followed by an optional closing note. The
+// swatches are drawn with the same opacity as the features they describe.
+func rampLegend(canvas *svg.SVG, title string, fills, labels []string, opacity float64, note string) {
+	const x, y, rowHeight = 40, 950, 30
+	textStyle := "font-size:20px;font-family:Arial;fill:#000000"
+
+	canvas.Gid("legend")
+	canvas.Text(x, y, title, textStyle+";font-weight:bold")
+
+	row := 1
+	for i, fill := range fills {
+		top := y + row*rowHeight - 18
+		canvas.Rect(x, top, 30, 20, fmt.Sprintf("fill:%s;fill-opacity:%g;stroke:#999999", fill, opacity))
+		canvas.Text(x+40, top+17, labels[i], textStyle)
+		row++
+	}
+
+	if note != "" {
+		canvas.Text(x, y+row*rowHeight, note, textStyle)
+	}
+	canvas.Gend()
+}
+
+// regionNames returns the names of the bundled regions, for display on the data entry page
+func regionNames() string {
+	names := make([]string, len(tasRegions))
+	for i, reg := range tasRegions {
+		names[i] = reg.name
+	}
+	return strings.Join(names, ", ")
+}
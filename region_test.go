@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+var regionPolygon = regexp.MustCompile(`<polygon points="[^"]*" style="([^"]*)" data-count="(\d+)"`)
+
+func TestChoroplethShadesBusiestRegionMost(t *testing.T) {
+	coords := "-42.0,146.5\n-42.1,146.6\n-42.2,146.4\n-42.3,146.7\n-41.0,147.0\n"
+	records := parseRecords(coords)
+	buf := new(bytes.Buffer)
+	mapperMu.Lock()
+	choroplethMap(tasmania, mapper.NewRecordList(coords, ""), records, buf)
+	mapperMu.Unlock()
+
+	fills := map[string]string{}
+	for _, m := range regionPolygon.FindAllStringSubmatch(buf.String(), -1) {
+		fills[m[2]] = m[1]
+	}
+	if len(regionPolygon.FindAllString(buf.String(), -1)) != len(tasRegions) {
+		t.Fatalf("want one polygon for each of the %d regions", len(tasRegions))
+	}
+	darkest := "fill:" + choroplethRamp[len(choroplethRamp)-1] + ";"
+	if style := fills["4"]; !strings.HasPrefix(style, darkest) {
+		t.Errorf("region with 4 records styled %q, want the darkest fill", style)
+	}
+	if style := fills["1"]; style == "" || strings.HasPrefix(style, darkest) {
+		t.Errorf("region with 1 record styled %q, lighter than the busiest expected", style)
+	}
+	if style := fills["0"]; !strings.HasPrefix(style, "fill:none") {
+		t.Errorf("empty region styled %q, want no fill", style)
+	}
+}
+
+func TestRegionCounts(t *testing.T) {
+	records := parseRecords("-42.0,146.5\n-41.0,147.0\n-30.0,150.0\n")
+	counts, outside := regionCounts(records, tasRegions)
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if total != 2 || outside != 1 {
+		t.Errorf("counted %d inside and %d outside, want 2 and 1", total, outside)
+	}
+}
+
+func TestRampIndex(t *testing.T) {
+	tests := []struct{ count, max, want int }{
+		{0, 10, -1}, {1, 10, 0}, {10, 10, 4}, {5, 10, 2}, {1, 1, 4},
+	}
+	for _, tt := range tests {
+		if got := rampIndex(tt.count, tt.max, 5); got != tt.want {
+			t.Errorf("rampIndex(%d, %d, 5) = %d, want %d", tt.count, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestRegionsLeaveOutlyingIslands(t *testing.T) {
+	tests := []struct {
+		place    string
+		lat, lon float64
+		inside   bool
+	}{
+		{"Hobart", -42.88, 147.32, true},
+		{"Cape Grim", -40.68, 144.69, true},
+		{"Currie, King Island", -39.93, 143.85, true},
+		{"Whitemark, Flinders Island", -40.12, 148.02, true},
+		{"Deal Island, Kent Group", -39.48, 147.32, false},
+		{"Pedra Branca", -43.86, 146.98, false},
+		{"Macquarie Island", -54.62, 158.86, false},
+	}
+	for _, tt := range tests {
+		_, outside := regionCounts([]record{{lat: tt.lat, lon: tt.lon}}, tasRegions)
+		if inside := outside == 0; inside != tt.inside {
+			t.Errorf("%s in a region %v, want %v", tt.place, inside, tt.inside)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// baseMapData returns the data for a map of the given type of coords drawn for a taxon,
+// with any eastings and northings read in the given UTM zone and every other option left
+// at its default. The web form and the API start from it and add the options they were
+// given.
+func baseMapData(taxon, mapType, coords string, zone int) *mapData {
+	data := &mapData{
+		TaxonName:     html.EscapeString(taxon),
+		MapType:       mapType,
+		SnapTolerance: defaultSnapTolerance,
+		DedupePlaces:  defaultDedupePlaces,
+		CellKm:        defaultCellKm,
+		Precision:     coordPrecision,
+		Zone:          zone,
+	}
+	data.RawCoords = data.readCoords(coords)
+	return data
+}
+
+// renderMap draws a map of the given type of coords for a taxon with the default options,
+// independently of any request
+func renderMap(taxon, mapType, coords string) (string, error) {
+	svgMap, _, err := mapSVG(context.Background(), baseMapData(taxon, mapType, coords, defaultZone))
+	return svgMap, err
+}
+
+// writeMap draws a map as renderMap does and writes it to w, returning the error if it
+// can't be drawn or written
+func writeMap(w io.Writer, taxon, mapType, coords string) error {
+	svgMap, err := renderMap(taxon, mapType, coords)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, svgMap)
+	return err
+}
+
+// renderOptions holds the choices drawRecordList is given as mapOptions
+type renderOptions struct {
+	vouchered bool
+}
+
+// mapOption sets one of the choices drawRecordList draws a map with
+type mapOption func(*renderOptions)
+
+// withVouchers has grid maps drawn with solid circles for vouchered specimens and empty
+// ones for observations
+func withVouchers(vouchered bool) mapOption {
+	return func(o *renderOptions) { o.vouchered = vouchered }
+}
+
+// drawRecordList draws the mapper's own map of the given type of rl, writing it straight to
+// w as it is drawn rather than building it up in memory first. It returns the first error w
+// gave, after which nothing more is written. Only the types the mapper draws itself can be
+// rendered this way; the server's other map types need every record and return an error.
+// The caller must hold mapperMu, as the mapper draws every map on the same canvas.
+func drawRecordList(rl *mapper.RecordList, mapType string, w io.Writer, opts ...mapOption) error {
+	var o renderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ew := &errWriter{w: w}
+	switch mapType {
+	case "grid":
+		if o.vouchered {
+			mapper.VoucherMap(rl, ew)
+		} else {
+			mapper.GridMap(rl, ew)
+		}
+	case "plain":
+		mapper.ExactMap(rl, ew)
+	case "web":
+		mapper.WebMap(rl, ew)
+	default:
+		if err := checkMapType(mapType); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s maps can't be drawn from a record list alone", mapType)
+	}
+	return ew.err
+}
+
+// errWriter keeps the first error from writing to w, as the mapper ignores them, and
+// writes nothing more once there has been one
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(b []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var n int
+	n, ew.err = ew.w.Write(b)
+	return n, ew.err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+var circleFill = regexp.MustCompile(`<circle [^>]*style="fill:(\w+)`)
+
+func TestRenderMap(t *testing.T) {
+	const coords = "-42.1,147.2\n-41.5,146.5"
+	tests := []struct {
+		name, mapType, coords string
+		groups                []string // Groups the map must have
+		fills                 []string // Fills of the record markers, in any order
+		err                   string
+	}{
+		{"grid", "grid", coords, []string{"gridAndNumbers", "infoBox", "dots"}, []string{"black", "black"}, ""},
+		{"voucher", "grid", "-42.1,147.2,0\n-41.5,146.5,1", []string{"gridAndNumbers", "dots"}, []string{"black", "white"}, ""},
+		{"plain", "plain", coords, []string{"infoBox", "dots"}, []string{"black", "black"}, ""},
+		{"web", "web", coords, []string{"points"}, []string{"black", "black"}, ""},
+		{"DMS", "plain", "42,6,0,147,12,0\n41,30,0,146,30,0", []string{"dots"}, []string{"black", "black"}, ""},
+		{"no coordinates", "plain", "", nil, nil, errNoCoordinates.Error()},
+		{"only comments", "plain", "# nothing yet", nil, nil, "No coordinates were found"},
+		{"nothing readable", "grid", "garbage\nnonsense", nil, nil, "None of the data can be mapped"},
+		{"all outside the map", "plain", "-30.0,140.0", nil, nil, "None of the data can be mapped"},
+		{"no map type", "", coords, nil, nil, errNoMapType.Error()},
+		{"unknown map type", "voucher", coords, nil, nil, `Unknown map type "voucher"`},
+	}
+	for _, tt := range tests {
+		doc, err := renderMap("Aus bus", tt.mapType, tt.coords)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got %v, want an error with %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimSpace(doc), "<?xml") || !strings.Contains(doc, ">Aus bus<") {
+			t.Errorf("%s: not a map of Aus bus", tt.name)
+		}
+		for _, g := range tt.groups {
+			if !strings.Contains(doc, `<g id="`+g+`"`) {
+				t.Errorf("%s: map has no %s group", tt.name, g)
+			}
+		}
+		var fills []string
+		for _, m := range circleFill.FindAllStringSubmatch(doc, -1) {
+			fills = append(fills, m[1])
+		}
+		sort.Strings(fills)
+		if strings.Join(fills, ",") != strings.Join(tt.fills, ",") {
+			t.Errorf("%s: records drawn in %v, want %v", tt.name, fills, tt.fills)
+		}
+	}
+}
+
+func TestDrawRecordList(t *testing.T) {
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	rl := mapper.NewRecordList("-42.1,147.2,0\n-41.5,146.5,1", "Aus bus")
+	tests := []struct {
+		mapType string
+		opts    []mapOption
+		draw    func(*mapper.RecordList, io.Writer)
+	}{
+		{"grid", nil, mapper.GridMap},
+		{"grid", []mapOption{withVouchers(true)}, mapper.VoucherMap},
+		{"plain", nil, mapper.ExactMap},
+		{"web", nil, mapper.WebMap},
+	}
+	for _, tt := range tests {
+		var got, want bytes.Buffer
+		if err := drawRecordList(rl, tt.mapType, &got, tt.opts...); err != nil {
+			t.Errorf("%s: %v", tt.mapType, err)
+		}
+		tt.draw(rl, &want)
+		if got.Len() == 0 || got.String() != want.String() {
+			t.Errorf("%s: %d bytes written, want the mapper's %d", tt.mapType, got.Len(), want.Len())
+		}
+	}
+
+	for _, mapType := range []string{"heat", "voucher"} {
+		if err := drawRecordList(rl, mapType, new(bytes.Buffer)); err == nil {
+			t.Errorf("%s map rendered from a record list", mapType)
+		}
+	}
+}
+
+// failingWriter takes n bytes and then fails every write
+type failingWriter struct {
+	n, written int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.written+len(b) > fw.n {
+		return 0, errWriteFailed
+	}
+	fw.written += len(b)
+	return len(b), nil
+}
+
+func TestDrawRecordListWriteError(t *testing.T) {
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	rl := mapper.NewRecordList("-42.1,147.2\n-41.5,146.5", "Aus bus")
+	for _, n := range []int{0, 100} {
+		fw := &failingWriter{n: n}
+		if err := drawRecordList(rl, "plain", fw); err != errWriteFailed {
+			t.Errorf("writer failing after %d bytes gave %v", n, err)
+		}
+		if fw.written > n {
+			t.Errorf("%d bytes written past the failure", fw.written-n)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const maxScaleBarWidth = 150 // Longest a scale bar can be drawn on the whole map, in pixels
+
+// scaleSteps are the clean lengths in km a scale bar can show
+var scaleSteps = []int{1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// scaleBarKm returns the longest clean scale bar length in km that fits within maxPixels
+// at the given number of metres per pixel
+func scaleBarKm(metresPerPixel, maxPixels float64) int {
+	km := scaleSteps[0]
+	for _, step := range scaleSteps {
+		if float64(step)*1000/metresPerPixel <= maxPixels {
+			km = step
+		}
+	}
+	return km
+}
+
+// viewFrame returns the viewBox of a map and the scale its decorations are drawn at. The
+// scale is 1 on the whole canvas and smaller on maps zoomed in, so that decorations take up
+// the same share of the map however much of it is shown.
+func viewFrame(doc string) (x0, y0, width, height, scale float64, ok bool) {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return 0, 0, 0, 0, 0, false
+	}
+	x0, _ = strconv.ParseFloat(m[1], 64)
+	y0, _ = strconv.ParseFloat(m[2], 64)
+	width, _ = strconv.ParseFloat(m[3], 64)
+	height, _ = strconv.ParseFloat(m[4], 64)
+	if width <= 0 || height <= 0 {
+		return 0, 0, 0, 0, 0, false
+	}
+	return x0, y0, width, height, math.Min(width/canvasWidth, height/canvasHeight), true
+}
+
+// mapDecorations adds a scale bar in kilometres in the bottom left corner of the map and a
+// north arrow in the bottom right, as requested. They are placed in the corners of the
+// area the map shows, once it has been zoomed or given a margin, and the scale bar is only
+// as long as fits that area. The mapper draws north straight up, so the arrow is fixed.
+func mapDecorations(doc string, scaleBar, northArrow bool) string {
+	x0, y0, width, height, s, ok := viewFrame(doc)
+	if !ok {
+		return doc
+	}
+	buf := new(bytes.Buffer)
+	textStyle := fmt.Sprintf("font-size:%.2fpx;font-family:Arial;fill:#000000", 18*s)
+
+	if scaleBar {
+		km := scaleBarKm(pixelSize, maxScaleBarWidth*s)
+		bar := float64(km) * 1000 / pixelSize
+		x, y := x0+(leftMargin+10)*s, y0+height-50*s
+
+		fmt.Fprintln(buf, `<g id="scaleBar">`)
+		fmt.Fprintf(buf, "<rect x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\" style=\"fill:black;stroke:black;stroke-width:%.2f\" />\n",
+			x, y, bar/2, 8*s, s)
+		fmt.Fprintf(buf, "<rect x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\" style=\"fill:white;stroke:black;stroke-width:%.2f\" />\n",
+			x+bar/2, y, bar/2, 8*s, s)
+		fmt.Fprintf(buf, "<text x=\"%.2f\" y=\"%.2f\" style=\"%s;text-anchor:middle\">0</text>\n", x, y-6*s, textStyle)
+		fmt.Fprintf(buf, "<text x=\"%.2f\" y=\"%.2f\" style=\"%s;text-anchor:middle\">%d km</text>\n", x+bar, y-6*s, textStyle, km)
+		fmt.Fprintln(buf, "</g>")
+	}
+
+	if northArrow {
+		x, y := x0+width-70*s, y0+height-170*s
+
+		fmt.Fprintln(buf, `<g id="northArrow">`)
+		fmt.Fprintf(buf, "<polygon points=\"%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f\" style=\"fill:black;stroke:black;stroke-width:%.2f\" />\n",
+			x, y, x+12*s, y+50*s, x, y+38*s, x-12*s, y+50*s, s)
+		fmt.Fprintf(buf, "<text x=\"%.2f\" y=\"%.2f\" style=\"%s;font-weight:bold;text-anchor:middle\">N</text>\n", x, y-8*s, textStyle)
+		fmt.Fprintln(buf, "</g>")
+	}
+	return appendToSVG(doc, buf.String())
+}
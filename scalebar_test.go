@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	decorationGroup = regexp.MustCompile(`(?s)<g id="(scaleBar|northArrow|legend)">.*?</g>`)
+	decorationAt    = regexp.MustCompile(` (c?[xy])="([-\d.]+)"`)
+	scaleLabel      = regexp.MustCompile(`>(\d+) km</text>`)
+)
+
+func TestScaleBarKm(t *testing.T) {
+	tests := []struct {
+		metresPerPixel, maxPixels float64
+		want                      int
+	}{
+		{400, 150, 50},   // The whole state, 60 km at most
+		{100, 150, 10},   // 15 km at most
+		{10, 150, 1},     // 1.5 km at most
+		{1, 150, 1},      // Nothing shorter than 1 km
+		{4000, 150, 500}, // Nothing longer than 500 km
+	}
+	for _, tt := range tests {
+		if got := scaleBarKm(tt.metresPerPixel, tt.maxPixels); got != tt.want {
+			t.Errorf("scaleBarKm(%g, %g) = %d, want %d", tt.metresPerPixel, tt.maxPixels, got, tt.want)
+		}
+	}
+}
+
+func TestScaleBarAndNorthArrow(t *testing.T) {
+	for _, mapType := range []string{"grid", "plain", "web", "arrow"} {
+		data := baseMapData("Aus bus", mapType, "-42.1,147.2,1\n-41.5,146.5,0", defaultZone)
+		plain, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(plain, `id="scaleBar"`) || strings.Contains(plain, `id="northArrow"`) {
+			t.Errorf("%s map decorated without being asked", mapType)
+		}
+
+		data = baseMapData("Aus bus", mapType, "-42.1,147.2,1\n-41.5,146.5,0", defaultZone)
+		data.ScaleBar, data.NorthArrow = true, true
+		doc, _, err := mapSVG(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(doc, `id="scaleBar"`) || !strings.Contains(doc, ">50 km</text>") {
+			t.Errorf("%s map has no 50 km scale bar", mapType)
+		}
+		if !strings.Contains(doc, `id="northArrow"`) {
+			t.Errorf("%s map has no north arrow", mapType)
+		}
+	}
+}
+
+func TestDecorationsFollowViewBox(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.88,147.33\n-42.80,147.50\n", defaultZone)
+	data.FitToData, data.Margin, data.ScaleBar, data.NorthArrow, data.Legend = true, 10, true, true, true
+	doc, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x0, y0, w, h, _, ok := viewFrame(doc)
+	if !ok {
+		t.Fatal("no viewBox")
+	}
+
+	groups := decorationGroup.FindAllStringSubmatch(doc, -1)
+	if len(groups) != 3 {
+		t.Fatalf("found %d of the scale bar, north arrow and legend", len(groups))
+	}
+	for _, g := range groups {
+		for _, at := range decorationAt.FindAllStringSubmatch(g[0], -1) {
+			v, _ := strconv.ParseFloat(at[2], 64)
+			if strings.HasSuffix(at[1], "x") && (v < x0 || v > x0+w) || strings.HasSuffix(at[1], "y") && (v < y0 || v > y0+h) {
+				t.Errorf("%s has %s=%g outside the viewBox %g %g %g %g", g[1], at[1], v, x0, y0, w, h)
+			}
+		}
+	}
+
+	m := scaleLabel.FindStringSubmatch(doc)
+	km, _ := strconv.Atoi(m[1])
+	if bar := float64(km) * 1000 / pixelSize; km >= 50 || bar > w/2 {
+		t.Errorf("scale bar of %d km on a map %g km across", km, w*pixelSize/1000)
+	}
+}
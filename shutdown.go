@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs server until it fails or the process is asked to stop with SIGINT or SIGTERM.
+// On a signal it stops accepting connections and waits up to timeout for requests in
+// progress to finish before returning.
+func serve(server *http.Server, timeout time.Duration) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-stop:
+		accessLog.Printf("Received %s, shutting down with up to %s for requests in progress", sig, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	accessLog.Println("Shutdown complete")
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0") // Find a free port
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "finished")
+	})}
+	served := make(chan error, 1)
+	go func() { served <- serve(server, 5*time.Second) }()
+
+	var resp *http.Response
+	got := make(chan error, 1)
+	go func() {
+		for i := 0; i < 50; i++ { // Until the server is listening
+			if resp, err = http.Get("http://" + addr + "/"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		got <- err
+	}()
+	select {
+	case <-started:
+	case err := <-got:
+		t.Fatalf("request not started: %v", err)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	for i := 0; ; i++ { // New connections are refused once shutdown begins
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 100 {
+			t.Fatal("connections still accepted after SIGTERM")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	if err := <-got; err != nil {
+		t.Fatalf("request in progress failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "finished" {
+		t.Errorf("request in progress gave %d %q", resp.StatusCode, body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+}
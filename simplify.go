@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// outlineTolerance is the distance in pixels of the map as shown that its coastline may
+	// be moved by when it is simplified, which can't be seen at that size
+	outlineTolerance = 0.5
+	// minOutlineTolerance is the least distance in canvas pixels worth simplifying the
+	// coastline by. Maps zoomed in so far that it would be moved by less show it in full.
+	minOutlineTolerance = 0.1
+)
+
+// simplifyRing drops the points of a closed ring that lie within tolerance of the line
+// through the points kept around them, by the Douglas-Peucker algorithm. Rings too small to
+// keep their shape at that tolerance, such as specks of islands, give nil.
+func simplifyRing(ring []pixel, tolerance float64) []pixel {
+	if len(ring) < 3 {
+		return nil
+	}
+	// The ring is split at the point furthest from its first, so that neither half starts
+	// and ends at the same point
+	far := 0
+	for i, p := range ring {
+		if math.Hypot(p.x-ring[0].x, p.y-ring[0].y) > math.Hypot(ring[far].x-ring[0].x, ring[far].y-ring[0].y) {
+			far = i
+		}
+	}
+	if math.Hypot(ring[far].x-ring[0].x, ring[far].y-ring[0].y) <= tolerance {
+		return nil
+	}
+	closed := append(append([]pixel{}, ring...), ring[0])
+	kept := append(simplifyLine(closed[:far+1], tolerance), simplifyLine(closed[far:], tolerance)[1:]...)
+	kept = kept[:len(kept)-1] // The first point again, closing the ring
+	if len(kept) < 3 {
+		return nil
+	}
+	return kept
+}
+
+// simplifyLine drops the points of a line that lie within tolerance of the line between
+// its ends, then of the lines between the ends and the point furthest from them, and so on,
+// keeping both ends
+func simplifyLine(line []pixel, tolerance float64) []pixel {
+	if len(line) < 3 {
+		return line
+	}
+	a, b := line[0], line[len(line)-1]
+	far, farDist := 0, 0.0
+	for i := 1; i < len(line)-1; i++ {
+		if d := segmentDistance(line[i], a, b); d > farDist {
+			far, farDist = i, d
+		}
+	}
+	if farDist <= tolerance {
+		return []pixel{a, b}
+	}
+	return append(simplifyLine(line[:far+1], tolerance), simplifyLine(line[far:], tolerance)[1:]...)
+}
+
+// segmentDistance gives the distance from p to the nearest point on the segment from a to b
+func segmentDistance(p, a, b pixel) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	t := math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(p.x-a.x-t*dx, p.y-a.y-t*dy)
+}
+
+// shownScale gives the number of canvas pixels in each pixel of a map shown at width by
+// height, as set by setSize. Maps without a fixed size are taken to be shown as wide as the
+// full canvas, so that the scale still follows the area they are zoomed to. It is 0 for a
+// map without a viewBox.
+func shownScale(doc string, width, height int) float64 {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return 0
+	}
+	vw, _ := strconv.ParseFloat(m[3], 64)
+	vh, _ := strconv.ParseFloat(m[4], 64)
+	switch {
+	case width == 0 && height == 0:
+		return vw / canvasWidth
+	case width == 0:
+		return vh / float64(height)
+	case height == 0:
+		return vw / float64(width)
+	}
+	return math.Max(vw/float64(width), vh/float64(height))
+}
+
+// outlineDetail gives the distance in canvas pixels the coastline of a map shown at width
+// by height can be simplified by without it showing, worked out from the extent of the map
+// and the size it is shown at. The smaller the area a map is zoomed to, the finer its
+// coastline, down to 0 for maps zoomed in so far that it is kept in full.
+func outlineDetail(doc string, width, height int) float64 {
+	tolerance := outlineTolerance * shownScale(doc, width, height)
+	if tolerance < minOutlineTolerance {
+		return 0
+	}
+	return tolerance
+}
+
+// simplifyOutline redraws the coastline of a map with only as much detail as can be seen
+// at the extent and size it is shown at, as given by outlineDetail, so that small or
+// zoomed out maps such as thumbnails aren't weighed down by a coastline drawn for a close
+// view. Maps zoomed in closely keep the mapper's coastline in full.
+func simplifyOutline(doc string, width, height int) string {
+	tolerance := outlineDetail(doc, width, height)
+	if tolerance == 0 {
+		return doc
+	}
+
+	const attr = `<path d="` // The coastline is the first path drawn by the mapper
+	start := strings.Index(doc, attr)
+	if start < 0 {
+		return doc
+	}
+	start += len(attr)
+	end := strings.Index(doc[start:], `"`)
+	if end < 0 {
+		return doc
+	}
+	end += start
+
+	// Points are kept to tenths of a pixel, and after the first of each ring are given
+	// relative to the one before, as the mapper does
+	var d strings.Builder
+	tenths := func(v float64) int { return int(math.Round(v * 10)) }
+	point := func(cmd string, x, y int) {
+		d.WriteString(cmd)
+		d.WriteString(strconv.FormatFloat(float64(x)/10, 'f', -1, 64))
+		d.WriteString(" ")
+		d.WriteString(strconv.FormatFloat(float64(y)/10, 'f', -1, 64))
+	}
+	for _, ring := range parsePath(doc[start:end]) {
+		ring = simplifyRing(ring, tolerance)
+		if ring == nil {
+			continue
+		}
+		x, y := tenths(ring[0].x), tenths(ring[0].y)
+		point("M", x, y)
+		for _, p := range ring[1:] {
+			nx, ny := tenths(p.x), tenths(p.y)
+			point("l", nx-x, ny-y)
+			x, y = nx, ny
+		}
+		d.WriteString("z")
+	}
+	return doc[:start] + d.String() + doc[end:]
+}
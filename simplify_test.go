@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"testing"
+)
+
+var coastPath = regexp.MustCompile(`<path d="([^"]*)"`)
+
+// coastPoints counts the points of the coastline of a map
+func coastPoints(t *testing.T, doc string) int {
+	t.Helper()
+	m := coastPath.FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatal("map has no coastline")
+	}
+	n := 0
+	for _, ring := range parsePath(m[1]) {
+		n += len(ring)
+	}
+	return n
+}
+
+func TestSmallExtentGetsFinerCoastline(t *testing.T) {
+	const coords = "-42.88,147.33\n-42.89,147.35\n" // Two records in Hobart
+	whole, err := renderMap("Aus bus", "plain", coords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := baseMapData("Aus bus", "plain", coords, defaultZone)
+	data.FitToData = true
+	zoomed, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wholeTol, zoomedTol := outlineDetail(whole, 0, 0), outlineDetail(zoomed, 0, 0)
+	if wholeTol <= 0 || zoomedTol >= wholeTol {
+		t.Errorf("whole state simplified by %g pixels and the zoomed map by %g, want less for the zoomed map", wholeTol, zoomedTol)
+	}
+	if zoomedTol != 0 {
+		t.Errorf("map zoomed to Hobart simplified by %g pixels, want its coastline in full", zoomedTol)
+	}
+	if w, z := coastPoints(t, whole), coastPoints(t, zoomed); z <= w {
+		t.Errorf("zoomed map's coastline has %d points, no more than the %d of the whole state", z, w)
+	}
+
+	data = baseMapData("Aus bus", "plain", coords, defaultZone)
+	data.FullDetail = true
+	full, _, err := mapSVG(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, w := coastPoints(t, full), coastPoints(t, whole); f <= w {
+		t.Errorf("full coastline asked for has %d points, no more than the %d simplified", f, w)
+	}
+}
+
+func TestOutlineDetailFollowsSize(t *testing.T) {
+	doc := `<svg viewBox="0 0 910 1260">`
+	tests := []struct {
+		width, height int
+		want          float64
+	}{
+		{0, 0, outlineTolerance},
+		{455, 0, 2 * outlineTolerance},
+		{0, 630, 2 * outlineTolerance},
+		{9100, 0, 0}, // Shown so large there is nothing to drop
+	}
+	for _, tt := range tests {
+		if got := outlineDetail(doc, tt.width, tt.height); got != tt.want {
+			t.Errorf("outlineDetail at %dx%d = %g, want %g", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+// ringDistance gives the distance from p to the nearest edge of a closed ring
+func ringDistance(p pixel, ring []pixel) float64 {
+	d := math.Inf(1)
+	for i := range ring {
+		d = math.Min(d, segmentDistance(p, ring[i], ring[(i+1)%len(ring)]))
+	}
+	return d
+}
+
+func TestSimplifyRingWithinTolerance(t *testing.T) {
+	var island []pixel // The main island, the ring with the most points
+	for _, ring := range coastline() {
+		if len(ring) > len(island) {
+			island = ring
+		}
+	}
+	if len(island) == 0 {
+		t.Fatal("no coastline")
+	}
+
+	fine, coarse := simplifyRing(island, 0.5), simplifyRing(island, 4)
+	if len(coarse) == 0 || len(coarse) >= len(fine) || len(fine) >= len(island) {
+		t.Fatalf("%d points simplified to %d at 0.5 pixels and %d at 4", len(island), len(fine), len(coarse))
+	}
+	for _, tt := range []struct {
+		tolerance float64
+		ring      []pixel
+	}{{0.5, fine}, {4, coarse}} {
+		original := make(map[pixel]bool, len(island))
+		for _, p := range island {
+			original[p] = true
+		}
+		for _, p := range tt.ring {
+			if !original[p] {
+				t.Fatalf("simplifying by %g moved a point to %v", tt.tolerance, p)
+			}
+		}
+		for _, p := range island {
+			if d := ringDistance(p, tt.ring); d > tt.tolerance+1e-9 {
+				t.Errorf("simplifying by %g left %v %g pixels from the outline", tt.tolerance, p, d)
+				break
+			}
+		}
+	}
+
+	speck := []pixel{{0, 0}, {0.2, 0}, {0.1, 0.2}}
+	if got := simplifyRing(speck, 0.5); got != nil {
+		t.Errorf("island smaller than the tolerance kept as %v", got)
+	}
+}
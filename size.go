@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxMapSize = 20000 // Largest width or height in pixels that can be requested for a map
+
+var sizeAttr = regexp.MustCompile(`\s+(?:width|height)="[^"]*"`)
+
+// parseSize reads a requested map width or height in pixels, returning 0 for none
+func parseSize(value string) int {
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return clampSize(size)
+}
+
+// clampSize limits a requested map width or height to maxMapSize, treating sizes that
+// aren't positive as none
+func clampSize(size int) int {
+	if size <= 0 {
+		return 0
+	}
+	if size > maxMapSize {
+		return maxMapSize
+	}
+	return size
+}
+
+// setSize gives a map a width and height in pixels, so that it is shown at that size
+// rather than filling whatever it is placed in. With only one of them given the other is
+// worked out from the shape of the map. When both are given and don't match its shape the
+// map keeps its proportions, centred within the requested size.
+func setSize(doc string, width, height int) string {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil || (width == 0 && height == 0) {
+		return doc
+	}
+	vw, _ := strconv.ParseFloat(m[3], 64)
+	vh, _ := strconv.ParseFloat(m[4], 64)
+	if vw <= 0 || vh <= 0 {
+		return doc
+	}
+
+	switch {
+	case width == 0:
+		width = int(math.Round(float64(height) * vw / vh))
+	case height == 0:
+		height = int(math.Round(float64(width) * vh / vw))
+	}
+	return addRootAttr(doc, fmt.Sprintf(`width="%d" height="%d"`, width, height))
+}
+
+// stripSize drops any width and height set on a map, leaving it to fill whatever it is
+// placed in
+func stripSize(doc string) string {
+	start := strings.Index(doc, "<svg")
+	if start < 0 {
+		return doc
+	}
+	end := strings.Index(doc[start:], ">")
+	if end < 0 {
+		return doc
+	}
+	end += start
+	return doc[:start] + sizeAttr.ReplaceAllString(doc[start:end], "") + doc[end:]
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 0}, {"wide", 0}, {"-20", 0}, {"0", 0}, {"300", 300}, {"999999", maxMapSize},
+	}
+	for _, tt := range tests {
+		if got := parseSize(tt.value); got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSetSize(t *testing.T) {
+	const doc = `<svg viewBox="0 0 910 1260">`
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{0, 0, ""},
+		{455, 0, `width="455" height="630"`}, // Height worked out from the map's shape
+		{0, 630, `width="455" height="630"`},
+		{200, 200, `width="200" height="200"`}, // Kept in proportion within the box
+	}
+	for _, tt := range tests {
+		got := setSize(doc, tt.width, tt.height)
+		if tt.want == "" && got != doc || tt.want != "" && !strings.Contains(got, tt.want) {
+			t.Errorf("setSize(%d, %d) gave %q, want %q", tt.width, tt.height, got, tt.want)
+		}
+		if !strings.Contains(got, `viewBox="0 0 910 1260"`) {
+			t.Errorf("setSize(%d, %d) changed the viewBox", tt.width, tt.height)
+		}
+	}
+}
+
+func TestRequestedSize(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "coordinates": {"-42.1,147.2"}, "width": {"300"},
+	})
+	want := `width="300" height="` + strconv.Itoa(300*canvasHeight/canvasWidth) + `"`
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("form map not sized %s", want)
+	}
+
+	rec = postJSON(apiMap, "/api/map", `{"maptype": "web", "coordinates": "-42.1,147.2", "width": 30000, "height": 100}`)
+	if !strings.Contains(rec.Body.String(), `width=\"`+strconv.Itoa(maxMapSize)+`\" height=\"100\"`) {
+		t.Errorf("API map not sized to the largest width allowed")
+	}
+}
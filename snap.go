@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+const (
+	defaultSnapTolerance = 2.0  // Default distance in km from the coast within which points are snapped
+	maxSnapTolerance     = 20.0 // Largest snapping distance in km that can be requested
+)
+
+// snapResult counts what happened to the records when snapping them to land
+type snapResult struct {
+	snapped  int // Records moved from the sea onto the coastline
+	excluded int // Records too far out to sea to be snapped
+}
+
+// snapToLand moves records that fall in the sea within tolerance km of the coast onto the
+// nearest point of the coastline. Records further out to sea than that are left out of the
+// returned records and counted as excluded. Snapping gives up with errTooComplex once ctx
+// is done.
+func snapToLand(ctx context.Context, reg *baseRegion, records []record, tolerance float64) (kept []record, res snapResult, err error) {
+	maxDist := tolerance * 1000 / pixelSize
+
+	for i, rec := range records {
+		if i%deadlineEvery == 0 {
+			if err := checkDeadline(ctx); err != nil {
+				return nil, res, err
+			}
+		}
+		x, y, in := reg.projectFrame(rec.lat, rec.lon)
+		p := pixel{float64(x), float64(y)}
+		if onLand(reg, p) {
+			kept = append(kept, rec)
+			continue
+		}
+
+		nearest, dist := nearestCoast(reg, p)
+		if dist > maxDist {
+			res.excluded++
+			continue
+		}
+
+		lat, lon, err := reg.unproject(nearest, in)
+		if err != nil {
+			res.excluded++
+			continue
+		}
+		rec.lat, rec.lon, rec.rounded = lat, lon, false
+		kept = append(kept, rec)
+		res.snapped++
+	}
+	return kept, res, nil
+}
+
+// warnings describes the outcome of snapping for the results page
+func (res snapResult) warnings() (w []string) {
+	if res.snapped > 0 {
+		w = append(w, fmt.Sprintf("%d near-shore point(s) were snapped onto land", res.snapped))
+	}
+	if res.excluded > 0 {
+		w = append(w, fmt.Sprintf("%d point(s) too far out to sea to snap were left off the map", res.excluded))
+	}
+	return w
+}
+
+// nearestCoast finds the point on the coastline closest to p and its distance in pixels
+func nearestCoast(reg *baseRegion, p pixel) (nearest pixel, dist float64) {
+	dist = math.Inf(1)
+	for _, ring := range reg.outline() {
+		for i := range ring {
+			a, b := ring[i], ring[(i+1)%len(ring)]
+			q := closestOnSegment(p, a, b)
+			if d := math.Hypot(q.x-p.x, q.y-p.y); d < dist {
+				nearest, dist = q, d
+			}
+		}
+	}
+	return nearest, dist
+}
+
+// closestOnSegment returns the point on the segment from a to b that is closest to p
+func closestOnSegment(p, a, b pixel) pixel {
+	dx, dy := b.x-a.x, b.y-a.y
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return a
+	}
+	t := ((p.x-a.x)*dx + (p.y-a.y)*dy) / lenSq
+	t = math.Max(0, math.Min(1, t))
+	return pixel{a.x + t*dx, a.y + t*dy}
+}
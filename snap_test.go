@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSnapToLand(t *testing.T) {
+	nearShore := record{lat: -42.0, lon: 148.36} // A few km east of the Freycinet coast
+	midOcean := record{lat: -42.5, lon: 149.5}
+	inland := record{lat: -42.0, lon: 146.5}
+
+	kept, res, _ := snapToLand(context.Background(), tasmania, []record{nearShore, midOcean, inland}, 5)
+	if res.snapped != 1 || res.excluded != 1 || len(kept) != 2 {
+		t.Fatalf("snapped %d and excluded %d, keeping %d records, want 1, 1 and 2", res.snapped, res.excluded, len(kept))
+	}
+
+	moved := kept[0]
+	if moved == nearShore {
+		t.Fatal("near-shore record wasn't moved")
+	}
+	x, y, _ := tasmania.projectFrame(moved.lat, moved.lon)
+	p := pixel{float64(x), float64(y)}
+	if _, dist := nearestCoast(tasmania, p); !onLand(tasmania, p) && dist > 1 {
+		t.Errorf("near-shore record moved to %g,%g, %g pixels out to sea", moved.lat, moved.lon, dist)
+	}
+	if kept[1] != inland {
+		t.Errorf("inland record moved to %g,%g", kept[1].lat, kept[1].lon)
+	}
+
+	if _, res, _ := snapToLand(context.Background(), tasmania, []record{nearShore}, 1); res.snapped != 0 || res.excluded != 1 {
+		t.Errorf("record beyond the tolerance snapped %d and excluded %d, want 0 and 1", res.snapped, res.excluded)
+	}
+}
+
+func TestSnapReported(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"-42.0,148.36\n-42.0,146.5\n"}, "snap": {"on"}, "snaptolerance": {"5"},
+	})
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "1 near-shore point(s) were snapped onto land") {
+		t.Errorf("snapping not reported, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// dataSource is one origin of the coordinates merged into a map, such as the text typed
+// into the form or an uploaded file
+type dataSource struct {
+	name   string
+	coords string
+}
+
+// sourceFills are the fills given to the points of each source, taxon or category, in the
+// order they first appear
+var sourceFills = []string{"#1b9e77", "#d95f02", "#7570b3", "#e7298a", "#66a61e", "#e6ab02", "#a6761d", "#666666"}
+
+// sourceRecords parses the coordinates of each source separately, so that every record
+// remembers where it came from. Data without any recorded sources is parsed as a whole.
+func (data *mapData) sourceRecords() []record {
+	if len(data.Sources) == 0 {
+		return parseRecords(data.RawCoords)
+	}
+
+	var records []record
+	for _, src := range data.Sources {
+		for _, rec := range parseRecords(src.coords) {
+			rec.source = src.name
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// mergeSources combines the coordinates of several sources into data, ignoring sources
+// without any coordinates
+func (data *mapData) mergeSources(sources ...dataSource) {
+	data.Sources = nil
+	var all []string
+	for _, src := range sources {
+		if src.coords != "" {
+			data.Sources = append(data.Sources, src)
+			all = append(all, src.coords)
+		}
+	}
+	data.RawCoords = strings.Join(all, "\n")
+}
+
+// sourceMap draws the Tasmania outline with the records of each source in their own
+// colour and shape, and a legend naming the sources with their record counts
+func sourceMap(reg *baseRegion, rl *mapper.RecordList, records []record, w io.Writer) {
+	groupedMap(reg, rl, records, "sources", "Record source", func(rec record) string { return rec.source }, nil, w)
+}
+
+// groupedMap draws the Tasmania outline with the records of each group, as named by
+// groupOf, in their own colour and shape, and a legend under the given title naming the
+// groups with their record counts. The markers are drawn in a group with the given id.
+// The groups in fixed are listed first, in their own colours, even those without records;
+// any others follow in the order they first appear.
+func groupedMap(reg *baseRegion, rl *mapper.RecordList, records []record, id, title string, groupOf func(record) string,
+	fixed []legendEntry, w io.Writer) {
+	var names []string
+	style := make(map[string]int)
+	fills := make(map[string]string)
+	for _, entry := range fixed {
+		style[entry.name], fills[entry.name] = len(names)%len(sourceFills), entry.fill
+		names = append(names, entry.name)
+	}
+	counts := make(map[string]int)
+	for _, rec := range records {
+		name := groupOf(rec)
+		if _, ok := style[name]; !ok {
+			style[name] = len(names) % len(sourceFills)
+			fills[name] = sourceFills[style[name]]
+			names = append(names, name)
+		}
+		counts[name] += rec.weight()
+	}
+
+	overlay := new(bytes.Buffer)
+	canvas := svg.New(overlay)
+
+	canvas.Gid(id)
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		name := groupOf(rec)
+		sourceMarker(canvas, x, y, style[name], fills[name], fmt.Sprintf(`data-group="%s"`, html.EscapeString(name)))
+	}
+	canvas.Gend()
+
+	const x, y, rowHeight = 40, 950, 30
+	textStyle := "font-size:20px;font-family:Arial;fill:#000000"
+	canvas.Gid("legend")
+	canvas.Text(x, y, title, textStyle+";font-weight:bold")
+	for i, name := range names {
+		top := y + (i+1)*rowHeight
+		label := name
+		if label == "" {
+			label = "unknown"
+		}
+		sourceMarker(canvas, x+15, top-7, style[name], fills[name])
+		canvas.Text(x+40, top, fmt.Sprintf("%s (%d)", label, counts[name]), textStyle)
+	}
+	canvas.Gend()
+
+	fmt.Fprint(w, appendToSVG(baseMap(rl), overlay.String()))
+}
+
+// sourceMarker draws the marker for a source's records in the given fill: circles,
+// squares, triangles and diamonds in turn, so sources can be told apart without relying on
+// colour alone
+func sourceMarker(canvas *svg.SVG, x, y, style int, fill string, attrs ...string) {
+	s := append([]string{"fill:" + fill + ";stroke:black"}, attrs...)
+	switch style % 4 {
+	case 0:
+		canvas.Circle(x, y, 9, s...)
+	case 1:
+		canvas.Rect(x-8, y-8, 16, 16, s...)
+	case 2:
+		canvas.Polygon([]int{x, x + 10, x - 10}, []int{y - 10, y + 8, y + 8}, s...)
+	default:
+		canvas.Polygon([]int{x, x + 10, x, x - 10}, []int{y - 11, y, y + 11, y}, s...)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	sourceStyle  = regexp.MustCompile(`style="fill:(#[0-9a-f]+);stroke:black" data-group="([^"]*)"`)
+	sourceLegend = regexp.MustCompile(`>([a-z]+) \((\d+)\)</text>`)
+)
+
+func TestSourceMapStylesByOrigin(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("maptype", "source")
+	mw.WriteField("coordinates", "-42.0,146.5\n")
+	f, _ := mw.CreateFormFile("csvfile", "records.csv")
+	f.Write([]byte("latitude,longitude\n-41.5,147.0\n-41.6,146.1\n"))
+	mw.Close()
+	req := httptest.NewRequest("POST", "/map", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	newMapStore().mapDisplay(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("merged map gave %d", rec.Code)
+	}
+	page := rec.Body.String()
+
+	fills := map[string]map[string]bool{}
+	for _, m := range sourceStyle.FindAllStringSubmatch(page, -1) {
+		if fills[m[2]] == nil {
+			fills[m[2]] = map[string]bool{}
+		}
+		fills[m[2]][m[1]] = true
+	}
+	if len(fills["csv"]) != 1 || len(fills["typed"]) != 1 {
+		t.Fatalf("points styled %v, want one style for each source", fills)
+	}
+	for fill := range fills["csv"] {
+		if fills["typed"][fill] {
+			t.Errorf("both sources drawn in %s", fill)
+		}
+	}
+
+	counts := map[string]string{}
+	for _, m := range sourceLegend.FindAllStringSubmatch(page, -1) {
+		counts[m[1]] = m[2]
+	}
+	if counts["csv"] != "2" || counts["typed"] != "1" {
+		t.Errorf("legend gives %v, want csv (2) and typed (1)", counts)
+	}
+	if !strings.Contains(page, `<g id="sources">`) {
+		t.Error("no group of source markers")
+	}
+}
+
+func TestSourceRecordsKeepOrigin(t *testing.T) {
+	data := baseMapData("", "source", "", defaultZone)
+	data.mergeSources(dataSource{"csv", "-41.5,147.0"}, dataSource{"typed", ""}, dataSource{"GBIF", "-42.0,146.5\n-42.1,146.6"})
+	if len(data.Sources) != 2 {
+		t.Fatalf("%d sources kept, want the 2 with coordinates", len(data.Sources))
+	}
+	var origins []string
+	for _, rec := range data.sourceRecords() {
+		origins = append(origins, rec.source)
+	}
+	if got := strings.Join(origins, " "); got != "csv GBIF GBIF" {
+		t.Errorf("records came from %s, want csv GBIF GBIF", got)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// staticFiles are the assets that are served as they are, rather than being page templates
+type staticFiles struct{ fs.FS }
+
+// Open opens a static asset, hiding the templates and the directory listing
+func (sf staticFiles) Open(name string) (fs.File, error) {
+	if name == "." || path.Ext(name) == ".html" {
+		return nil, fs.ErrNotExist
+	}
+	return sf.FS.Open(name)
+}
+
+// static serves the stylesheet and other static assets under "/static/", with their content
+// type worked out from their extension. Browsers keep the embedded assets for a day, but
+// check assets given with -assets every time so that changes to a theme show up straight
+// away.
+func static(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if assetsDir != "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	http.StripPrefix("/static/", http.FileServer(http.FS(staticFiles{assetFiles()}))).ServeHTTP(w, r)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStylesheetServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	static(rec, httptest.NewRequest("GET", "/static/style.css", nil))
+	css, _ := fs.ReadFile(embeddedAssets, "assets/style.css")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("stylesheet gave %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.String() != string(css) {
+		t.Error("stylesheet changed on the way out")
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Errorf("embedded stylesheet cached with %q", cc)
+	}
+
+	// Braces that a template would read are sent as they are
+	dir := copyAssets(t)
+	edited := "/* {{ .notATemplate }} */\n" + string(css)
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte(edited), 0o644)
+	assetsDir = dir
+	defer func() { assetsDir = "" }()
+	rec = httptest.NewRecorder()
+	static(rec, httptest.NewRequest("GET", "/static/style.css", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != edited || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("stylesheet from the assets directory gave %d with %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestStaticHidesTemplates(t *testing.T) {
+	for _, path := range []string{"/static/", "/static/header.html", "/static/missing.css"} {
+		rec := httptest.NewRecorder()
+		static(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s gave %d, want 404", path, rec.Code)
+		}
+	}
+}
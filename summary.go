@@ -0,0 +1,61 @@
+package main
+
+import "math"
+
+// recordSummary holds the figures shown beside a map about the records drawn on it
+type recordSummary struct {
+	Total      int     // Records, counting each merged duplicate
+	Vouchered  int     // Records backed by a voucher specimen
+	Anecdotal  int     // Records without a voucher, when the data gives voucher status
+	Localities int     // Places the records fall at once duplicates are merged
+	North      float64 // Bounding box of the records in decimal degrees
+	South      float64
+	East       float64
+	West       float64
+}
+
+// countRecords returns the number of records, counting each one merged into another
+func countRecords(records []record) (n int) {
+	for _, rec := range records {
+		n += rec.weight()
+	}
+	return n
+}
+
+// voucherCount returns the number of vouchered records and of records without a voucher.
+// Records whose voucher status wasn't given are counted in neither.
+func voucherCount(records []record) (vouchered, anecdotal int) {
+	for _, rec := range records {
+		switch {
+		case rec.voucher:
+			vouchered += rec.weight()
+		case rec.hasVoucher:
+			anecdotal += rec.weight()
+		}
+	}
+	return vouchered, anecdotal
+}
+
+// distinctLocalities returns the number of places the records fall at when their
+// coordinates are rounded to the given number of decimal places
+func distinctLocalities(records []record, places int) int {
+	localities, _ := dedupeRecords(records, places)
+	return len(localities)
+}
+
+// summariseRecords works out the summary of records, finding localities to the given
+// number of decimal places
+func summariseRecords(records []record, places int) recordSummary {
+	s := recordSummary{Total: countRecords(records), Localities: distinctLocalities(records, places)}
+	s.Vouchered, s.Anecdotal = voucherCount(records)
+	if len(records) == 0 {
+		return s
+	}
+	s.North, s.South = math.Inf(-1), math.Inf(1)
+	s.East, s.West = math.Inf(-1), math.Inf(1)
+	for _, rec := range records {
+		s.North, s.South = math.Max(s.North, rec.lat), math.Min(s.South, rec.lat)
+		s.East, s.West = math.Max(s.East, rec.lon), math.Min(s.West, rec.lon)
+	}
+	return s
+}
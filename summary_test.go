@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// summaryRecords are four records at three localities, one of them two merged duplicates
+var summaryRecords = []record{
+	{lat: -42.1, lon: 147.2, voucher: true, hasVoucher: true, count: 2},
+	{lat: -42.100001, lon: 147.200001, hasVoucher: true},
+	{lat: -41.5, lon: 146.5, hasVoucher: true},
+	{lat: -43.0, lon: 146.9},
+}
+
+func TestCountRecords(t *testing.T) {
+	if n := countRecords(summaryRecords); n != 5 {
+		t.Errorf("counted %d records, want 5", n)
+	}
+	if n := countRecords(nil); n != 0 {
+		t.Errorf("counted %d records of none", n)
+	}
+}
+
+func TestVoucherCount(t *testing.T) {
+	if v, a := voucherCount(summaryRecords); v != 2 || a != 2 {
+		t.Errorf("counted %d vouchered and %d anecdotal, want 2 and 2", v, a)
+	}
+}
+
+func TestDistinctLocalities(t *testing.T) {
+	for _, tt := range []struct{ places, want int }{{4, 3}, {6, 4}} {
+		if n := distinctLocalities(summaryRecords, tt.places); n != tt.want {
+			t.Errorf("%d localities to %d places, want %d", n, tt.places, tt.want)
+		}
+	}
+}
+
+func TestSummaryOnResultsPage(t *testing.T) {
+	s := summariseRecords(summaryRecords, 4)
+	if want := (recordSummary{Total: 5, Vouchered: 2, Anecdotal: 2, Localities: 3, North: -41.5, South: -43, East: 147.200001, West: 146.5}); s != want {
+		t.Errorf("got summary %+v, want %+v", s, want)
+	}
+
+	page := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "coordinates": {"-42.1,147.2,1\n-42.1,147.2,0\n-41.5,146.5,0"},
+	}).Body.String()
+	for _, want := range []string{"Records: 3", "Vouchered: 1, anecdotal: 2", "Distinct localities: 2",
+		"Extent: -42.1000 to -41.5000 latitude", "146.5000 to 147.2000 longitude"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("results page has no %q", want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// baseMap draws a plain map of the records with the mapper but leaves out its dots, so
+// that the server can draw the records itself in another style
+func baseMap(rl *mapper.RecordList) string {
+	buf := new(bytes.Buffer)
+	mapper.ExactMap(rl, buf)
+	return emptyGroup(buf.String(), "dots")
+}
+
+// emptyGroup removes the contents of the group with the given id from an SVG document
+// generated by the mapper. Groups with that id are not nested, so the contents end at the
+// first closing tag.
+func emptyGroup(doc, id string) string {
+	open := `<g id="` + id + `">`
+	start := strings.Index(doc, open)
+	if start < 0 {
+		return doc
+	}
+	start += len(open)
+
+	end := strings.Index(doc[start:], "</g>")
+	if end < 0 {
+		return doc
+	}
+	return doc[:start] + "\n" + doc[start+end:]
+}
+
+// appendToSVG inserts an SVG fragment just before the closing tag of the document, so
+// that it is drawn on top of everything else
+func appendToSVG(doc, fragment string) string {
+	end := strings.LastIndex(doc, "</svg>")
+	if end < 0 {
+		return doc
+	}
+	return doc[:end] + fragment + doc[end:]
+}
+
+// insertBeforeGroup inserts an SVG fragment just before the group with the given id, so
+// that it is drawn beneath it, or at the end of the document if there is no such group
+func insertBeforeGroup(doc, id, fragment string) string {
+	start := strings.Index(doc, `<g id="`+id+`">`)
+	if start < 0 {
+		return appendToSVG(doc, fragment)
+	}
+	return doc[:start] + fragment + doc[start:]
+}
+
+// addRootAttr adds an attribute to the root svg element of a document
+func addRootAttr(doc, attr string) string {
+	start := strings.Index(doc, "<svg")
+	if start < 0 {
+		return doc
+	}
+	end := strings.Index(doc[start:], ">")
+	if end < 0 {
+		return doc
+	}
+	end += start
+	return doc[:end] + "\n     " + attr + doc[end:]
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	mapper "github.com/kurankat/tasmapper"
+)
+
+// taxonHeader matches a line naming the taxon of the records that follow it, such as
+// "## Eucalyptus gunnii", which lets several taxa be mapped together
+var taxonHeader = regexp.MustCompile(`^##\s*(\S.*)$`)
+
+// taxonHeading returns the taxon named by a header line, with its spacing tidied
+func taxonHeading(line string) (string, bool) {
+	m := taxonHeader.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", false
+	}
+	return strings.Join(strings.Fields(m[1]), " "), true
+}
+
+// taxonNames returns the taxa the records were given under, in the order they first
+// appear. Records before any header have no taxon.
+func taxonNames(records []record) (names []string) {
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		if !seen[rec.taxon] {
+			seen[rec.taxon] = true
+			names = append(names, rec.taxon)
+		}
+	}
+	return names
+}
+
+// multiTaxon reports whether the records belong to more than one taxon
+func multiTaxon(records []record) bool {
+	return len(taxonNames(records)) > 1
+}
+
+// taxaMap draws the Tasmania outline with the records of each taxon in their own colour
+// and shape, and a legend naming the taxa with their record counts
+func taxaMap(reg *baseRegion, rl *mapper.RecordList, records []record, w io.Writer) {
+	groupedMap(reg, rl, records, "taxa", "Taxa", func(rec record) string { return rec.taxon }, nil, w)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var taxonMarker = regexp.MustCompile(`style="fill:(#[0-9a-fA-F]+);[^"]*" data-group="([^"]*)"`)
+
+func TestTwoTaxaInDistinctColours(t *testing.T) {
+	coords := "## Eucalyptus gunnii\n-42.0,146.5\n-41.9,146.6\n##   Eucalyptus  archeri\n-41.5,146.5\n"
+	doc, records, err := mapSVG(context.Background(), baseMapData("", "plain", coords, defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].taxon != "Eucalyptus gunnii" || records[2].taxon != "Eucalyptus archeri" {
+		t.Fatalf("got records %+v", records)
+	}
+
+	fills := make(map[string]string)
+	for _, m := range taxonMarker.FindAllStringSubmatch(doc, -1) {
+		if fill, ok := fills[m[2]]; ok && fill != m[1] {
+			t.Errorf("%s drawn in %s and %s", m[2], fill, m[1])
+		}
+		fills[m[2]] = m[1]
+	}
+	if len(fills) != 2 || fills["Eucalyptus gunnii"] == fills["Eucalyptus archeri"] {
+		t.Errorf("taxa drawn in %v, want two distinct colours", fills)
+	}
+	for _, want := range []string{`<g id="taxa">`, ">Eucalyptus gunnii (2)<", ">Eucalyptus archeri (1)<"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("map has no %q", want)
+		}
+	}
+}
+
+func TestSingleTaxonUnchanged(t *testing.T) {
+	plain, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "plain", "-42.0,146.5\n-41.5,146.5", defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headed, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "plain", "## Aus bus\n-42.0,146.5\n-41.5,146.5", defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(headed, `id="taxa"`) || strings.Count(headed, "<circle") != strings.Count(plain, "<circle") {
+		t.Error("a single named taxon is drawn differently from unnamed records")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const defaultTheme = "default"
+
+// mapTheme is a set of colours that the parts of a map are drawn in together
+type mapTheme struct {
+	outline      string  // Colour of the coastline
+	outlineWidth float64 // Width of the coastline in pixels
+	land         string  // Fill of the land, "none" to leave it clear
+	markers      string  // Colour of the markers unless one is given, "" for the mapper's black
+	graticule    string  // Colour of the lines of latitude and longitude
+	focal        string  // Fill of the star over the focal record
+	greyscale    bool    // Whether every colour on the map is turned to its shade of grey
+}
+
+// mapThemes are the themes a map can be drawn in. The default is the mapper's own look,
+// greyscale is for printing in black and white, such as in journals, and high contrast draws
+// everything in bold black, with a yellow focal record, for those who find faint lines hard
+// to see. Dark land would hide the black gridlines of grid maps.
+var mapThemes = map[string]mapTheme{
+	defaultTheme: {outline: "#000000", outlineWidth: 1, land: "none", graticule: "#808080", focal: "#ffd700"},
+	"greyscale": {outline: "#000000", outlineWidth: 1, land: "#e6e6e6", graticule: "#808080", focal: "#ffffff",
+		greyscale: true},
+	"highcontrast": {outline: "#000000", outlineWidth: 3, land: "none", markers: "#000000", graticule: "#000000",
+		focal: "#ffff00"},
+}
+
+// paintColour matches a colour given to the fill or stroke of a shape, in a style or as an
+// attribute, capturing what comes before it and the colour
+var paintColour = regexp.MustCompile(`((?:fill|stroke|stop-color)(?::|="))(#[0-9a-fA-F]{6}\b|#[0-9a-fA-F]{3}\b|[a-z]+)`)
+
+// parseTheme reads the name of a theme, giving defaultTheme for names it doesn't know
+func parseTheme(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, ok := mapThemes[value]; !ok {
+		return defaultTheme
+	}
+	return value
+}
+
+// theme returns the theme the map is drawn in
+func (data *mapData) theme() mapTheme {
+	if t, ok := mapThemes[data.Theme]; ok {
+		return t
+	}
+	return mapThemes[defaultTheme]
+}
+
+// themeOutline draws the coastline drawn by the mapper in the colours of t. Filled land is
+// moved to the start of the map, so that it lies beneath the gridlines of grid maps, and
+// the coastline stays the first path drawn, where the coastline is looked for.
+func themeOutline(doc string, t mapTheme) string {
+	if t == mapThemes[defaultTheme] {
+		return doc
+	}
+	start := strings.Index(doc, `<path d="`)
+	if start < 0 {
+		return doc
+	}
+	end := strings.Index(doc[start:], "/>")
+	if end < 0 {
+		return doc
+	}
+	end += start + len("/>")
+
+	path := doc[start:end]
+	if i := strings.Index(path, ` style="`); i >= 0 {
+		path = path[:i] + " />"
+	}
+	path = strings.TrimSuffix(path, " />") + fmt.Sprintf(` style="fill:%s;fill-rule:evenodd;stroke:%s;stroke-width:%g" />`,
+		t.land, t.outline, t.outlineWidth)
+	doc = doc[:start] + doc[end:]
+
+	open := `<g id="theLot">`
+	at := strings.Index(doc, open)
+	if t.land == "none" || at < 0 {
+		return doc[:start] + path + doc[start:]
+	}
+	at += len(open)
+	return doc[:at] + "\n" + path + doc[at:]
+}
+
+// greyscaleSVG turns every colour filling or outlining the shapes of a map to the grey of
+// the same lightness, so that colours that differ in lightness can still be told apart when
+// printed in black and white
+func greyscaleSVG(doc string) string {
+	return paintColour.ReplaceAllStringFunc(doc, func(paint string) string {
+		m := paintColour.FindStringSubmatch(paint)
+		c, ok := parseColour(m[2], 1)
+		if !ok { // Such as "none"
+			return paint
+		}
+		grey := uint8(math.Round(0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)))
+		return fmt.Sprintf("%s#%02x%02x%02x", m[1], grey, grey, grey)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// svgColour matches a colour given to any part of a map, in a style or as an attribute
+var svgColour = regexp.MustCompile(`(?:fill|stroke|stop-color|flood-color|color)\s*(?::|=")\s*(#[0-9a-fA-F]+|rgba?\([^)]*\)|[a-zA-Z]+)`)
+
+// chromatic returns the colours of doc that aren't a shade of grey, including any that
+// can't be read
+func chromatic(doc string) []string {
+	var colours []string
+	for _, m := range svgColour.FindAllStringSubmatch(doc, -1) {
+		switch v := strings.ToLower(m[1]); v {
+		case "none", "transparent", "currentcolor", "inherit":
+		default:
+			if c, ok := parseColour(v, 1); !ok || c.R != c.G || c.G != c.B {
+				colours = append(colours, m[0])
+			}
+		}
+	}
+	return colours
+}
+
+func TestGreyscaleThemeAchromatic(t *testing.T) {
+	const coords = "-42.1,147.2,1,wet\n-41.5,146.5,0,dry\n-41.2,146.9,1,alpine\n*-42.9,147.3,1,wet\n" // Categories and a focal record
+	for _, mapType := range []string{"plain", "grid", "web", "region", "heat", "distance", "proportional", "category", "source"} {
+		draw := func(theme string) string {
+			data := baseMapData("Aus bus", mapType, coords, defaultZone)
+			data.Theme, data.MarkerColour, data.Reference = theme, "#00aa33", "-42.0,146.5"
+			data.Legend, data.Graticule, data.ScaleBar, data.NorthArrow, data.Locator = true, true, true, true, true
+			doc, _, err := mapSVG(context.Background(), data)
+			if err != nil {
+				t.Fatalf("%s map in %s: %v", mapType, theme, err)
+			}
+			return doc
+		}
+		if colours := chromatic(draw("greyscale")); len(colours) > 0 {
+			t.Errorf("greyscale %s map has colours %q", mapType, colours)
+		}
+		if len(chromatic(draw(defaultTheme))) == 0 {
+			t.Errorf("%s map in the default theme has no colours to turn grey", mapType)
+		}
+	}
+}
+
+func TestGreyscaleSVG(t *testing.T) {
+	tests := []struct {
+		doc, want string
+	}{
+		{`style="fill:#ff0000;stroke:#00f"`, `style="fill:#4c4c4c;stroke:#1d1d1d"`},
+		{`fill="red" stroke="none"`, `fill="#4c4c4c" stroke="none"`},
+		{`<stop stop-color="#ffffff"/>`, `<stop stop-color="#ffffff"/>`},
+	}
+	for _, tt := range tests {
+		if got := greyscaleSVG(tt.doc); got != tt.want {
+			t.Errorf("greyscaleSVG(%s) = %s, want %s", tt.doc, got, tt.want)
+		}
+	}
+}
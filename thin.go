@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+const (
+	thinThreshold = 500              // Records on a plain map above which points are thinned, when asked for
+	thinCell      = 2 * markerRadius // Side in pixels of the cells points are thinned to one per, about a marker across
+	maxThinCell   = canvasWidth / 4  // Largest cell thinning widens to while trying to fit within maxRecords
+)
+
+// thinRecords keeps one record from each square of the map with the given side in pixels,
+// so that points that would be drawn on top of each other are drawn once. The first record
+// in each square stands for the others, with their count and voucher status merged into it
+// as when merging duplicates, and records of different taxa are never merged.
+func thinRecords(reg *baseRegion, records []record, cell int) []record {
+	type square struct {
+		col, row int
+		taxon    string
+	}
+	index := make(map[square]int)
+	var kept []record
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		key := square{x / cell, y / cell, rec.taxon}
+		if i, ok := index[key]; ok {
+			kept[i].count += rec.weight()
+			kept[i].voucher = kept[i].voucher || rec.voucher
+			kept[i].focal = kept[i].focal || rec.focal
+			continue
+		}
+		rec.count = rec.weight()
+		index[key] = len(kept)
+		kept = append(kept, rec)
+	}
+	return kept
+}
+
+// thinPoints thins the points of a plain map with more than thinThreshold records, leaving
+// smaller data sets as they are. Squares of thinCell pixels are used, widened if need be
+// until the points fit within maxRecords. It returns a warning of how many points are shown.
+func thinPoints(reg *baseRegion, records []record) (thinned []record, warning string) {
+	if len(records) <= thinThreshold {
+		return records, ""
+	}
+	cell := thinCell
+	thinned = thinRecords(reg, records, cell)
+	for maxRecords > 0 && len(thinned) > maxRecords && cell < maxThinCell {
+		cell *= 2
+		thinned = thinRecords(reg, records, cell)
+	}
+	if len(thinned) == len(records) {
+		return records, ""
+	}
+	return thinned, fmt.Sprintf("Showing %d points for %d records, as records closer together than about %g km "+
+		"were drawn as one point", len(thinned), len(records), float64(cell*pixelSize)/1000)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestThinDenseCluster(t *testing.T) {
+	var records []record
+	for i := 0; i < 1000; i++ { // Within about 100 m of each other
+		records = append(records, record{lat: -42.0 + float64(i%10)*0.0001, lon: 146.5 + float64(i/10)*0.00001})
+	}
+	records[10].voucher = true
+	thinned, warning := thinPoints(tasmania, records)
+	if len(thinned) == 0 || len(thinned) > 4 {
+		t.Fatalf("1000 records thinned to %d points", len(thinned))
+	}
+	total, vouchered := 0, false
+	for _, rec := range thinned {
+		total += rec.weight()
+		vouchered = vouchered || rec.voucher
+	}
+	if total != len(records) || !vouchered {
+		t.Errorf("points stand for %d records (vouchered %v)", total, vouchered)
+	}
+	if !strings.HasPrefix(warning, "Showing ") || !strings.Contains(warning, "points for 1000 records") {
+		t.Errorf("got warning %q", warning)
+	}
+}
+
+func TestThinLeavesSparseData(t *testing.T) {
+	sparse := parseRecords(spreadCoords(thinThreshold)) // Points about a kilometre apart
+	if thinned, warning := thinPoints(tasmania, sparse); len(thinned) != len(sparse) || warning != "" {
+		t.Errorf("%d records under the threshold thinned to %d (%q)", len(sparse), len(thinned), warning)
+	}
+	var spread []record
+	for i := 0; i < thinThreshold+100; i++ { // About 10 km apart, more than a marker across
+		spread = append(spread, record{lat: -40.8 - float64(i%25)*0.1, lon: 145.0 + float64(i/25)*0.1})
+	}
+	if thinned, warning := thinPoints(tasmania, spread); len(thinned) != len(spread) || warning != "" {
+		t.Errorf("%d records too far apart to overlap thinned to %d (%q)", len(spread), len(thinned), warning)
+	}
+
+	// Records of different taxa in the same place stay apart
+	taxa := []record{{lat: -42, lon: 146.5, taxon: "Aus bus"}, {lat: -42, lon: 146.5, taxon: "Cus dus"}}
+	if kept := thinRecords(tasmania, taxa, thinCell); len(kept) != 2 {
+		t.Errorf("two taxa thinned to %d points", len(kept))
+	}
+}
+
+func TestThinOnlyWhenAsked(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < thinThreshold+1; i++ {
+		b.WriteString("-42.0,146.5\n")
+	}
+	for _, thin := range []bool{false, true} {
+		data := baseMapData("Aus bus", "plain", b.String(), defaultZone)
+		data.Thin = thin
+		_, records, err := mapSVG(context.Background(), data)
+		if err != nil || (len(records) == 1) != thin {
+			t.Errorf("thinning %v drew %d points (%v)", thin, len(records), err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const thumbnailWidth = 160 // Width in pixels of the thumbnail shown beside the map on the results page
+
+var idAttr = regexp.MustCompile(` id="[^"]*"`)
+
+// thumbnailSVG makes a small copy of a finished map for the results page, so the overall
+// shape of the records can be seen at a glance. It reuses the map already drawn rather than
+// drawing it again, shrinking it to thumbnailWidth pixels across with everything on it,
+// markers included, scaled down to match, and its coastline simplified. The ids of its
+// groups are dropped, so that they aren't repeated in the page alongside the full map.
+func thumbnailSVG(doc string) string {
+	doc = stripSize(doc) // Any size asked for is replaced
+	start := strings.Index(doc, "<svg")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(doc[start:], ">")
+	if end < 0 {
+		return ""
+	}
+	end += start
+	thumb := doc[:end] + idAttr.ReplaceAllString(doc[end:], "")
+	thumb = minifySVG(simplifyOutline(thumb, thumbnailWidth, 0))
+	return addRootAttr(setSize(thumb, thumbnailWidth, 0), `class="thumbnail"`)
+}
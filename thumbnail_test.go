@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var svgRoot = regexp.MustCompile(`<svg\s[^>]*>`)
+
+func TestThumbnailOnResultsPage(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "taxon": {"Aus bus"}, "coordinates": {"-42.1,147.2\n-41.5,146.5"}, "width": {"600"},
+	})
+	page := rec.Body.String()
+	roots := svgRoot.FindAllString(page, -1)
+	if rec.Code != 200 || len(roots) != 2 {
+		t.Fatalf("results page gave %d with %d maps", rec.Code, len(roots))
+	}
+	thumb, full := roots[0], roots[1]
+	if !strings.Contains(thumb, `class="thumbnail"`) || !strings.Contains(thumb, `width="`+strconv.Itoa(thumbnailWidth)+`"`) {
+		t.Errorf("thumbnail drawn as %s", thumb)
+	}
+	if !strings.Contains(full, `width="600"`) || strings.Contains(full, "thumbnail") {
+		t.Errorf("full map drawn as %s", full)
+	}
+	if !strings.Contains(page, `<a class="thumbnail" href="#map"`) {
+		t.Error("thumbnail doesn't link to the full map")
+	}
+	if n := strings.Count(page, `id="dots"`); n != 1 {
+		t.Errorf("dots group id used %d times in the page", n)
+	}
+}
+
+func TestThumbnailSVG(t *testing.T) {
+	doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "plain", "-42.1,147.2\n-41.5,146.5", defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb := thumbnailSVG(doc)
+	if err := wellFormed(thumb); err != nil {
+		t.Fatalf("thumbnail is not well-formed: %v", err)
+	}
+	if idAttr.MatchString(thumb) {
+		t.Error("thumbnail keeps the map's ids")
+	}
+	if viewBoxAttr.FindString(thumb) != viewBoxAttr.FindString(doc) {
+		t.Error("thumbnail shows another area from the map")
+	}
+	if got := len(dotCircle.FindAllString(thumb, -1)); got != len(records) {
+		t.Errorf("thumbnail has %d markers for %d records", got, len(records))
+	}
+	if len(thumb) >= len(doc) {
+		t.Errorf("thumbnail of %d bytes is no smaller than the map's %d", len(thumb), len(doc))
+	}
+	if thumbnailSVG("not a map") != "" {
+		t.Error("thumbnail made of something that isn't a map")
+	}
+}
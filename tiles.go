@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxTiles = 10 // Largest number of tiles allowed across or down a tiled map
+
+// tileMargin is how far in pixels past its shape a marker may be drawn, by its outline
+const tileMargin = 3
+
+var (
+	viewBoxAttr = regexp.MustCompile(`viewBox="([-\d.]+) ([-\d.]+) ([-\d.]+) ([-\d.]+)"`)
+	tilesValue  = regexp.MustCompile(`^(\d+)x(\d+)$`)
+
+	// The shapes that markers are drawn with, on lines of their own or wrapped in the group
+	// or link of a web map point
+	markerLine    = regexp.MustCompile(`^(?:<g class="point">|<a [^>]*>)*<(circle|rect|polygon|path) `)
+	circleShape   = regexp.MustCompile(`<circle cx="(-?[\d.]+)" cy="(-?[\d.]+)" r="([\d.]+)"`)
+	rectShape     = regexp.MustCompile(`<rect x="(-?[\d.]+)" y="(-?[\d.]+)" width="([\d.]+)" height="([\d.]+)"`)
+	polygonShape  = regexp.MustCompile(`<polygon points="([^"]*)"`)
+	pathShape     = regexp.MustCompile(`<path d="([^"]*)"`)
+	translateOnly = regexp.MustCompile(`transform="translate\(\s*(-?[\d.]+)[\s,]+(-?[\d.]+)\s*\)(?: rotate\([-\d.]+\))?"`)
+)
+
+// box is an area of the canvas, from its top left to its bottom right corner
+type box struct {
+	left, top, right, bottom float64
+}
+
+// markerBox gives the area of the canvas covered by a marker drawn on a line of a map, such
+// as a circle, a square or star, or an arrow turned into place. Lines holding anything else,
+// such as the coastline, report false and are kept in every tile.
+func markerBox(line string) (b box, ok bool) {
+	m := markerLine.FindStringSubmatch(line)
+	if m == nil {
+		return box{}, false
+	}
+	num := func(s string) float64 { v, _ := strconv.ParseFloat(s, 64); return v }
+
+	switch m[1] {
+	case "circle":
+		c := circleShape.FindStringSubmatch(line)
+		if c == nil {
+			return box{}, false
+		}
+		x, y, r := num(c[1]), num(c[2]), num(c[3])
+		b = box{x - r, y - r, x + r, y + r}
+	case "rect":
+		c := rectShape.FindStringSubmatch(line)
+		if c == nil {
+			return box{}, false
+		}
+		x, y := num(c[1]), num(c[2])
+		b = box{x, y, x + num(c[3]), y + num(c[4])}
+	case "polygon":
+		c := polygonShape.FindStringSubmatch(line)
+		if c == nil {
+			return box{}, false
+		}
+		b = box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, pt := range strings.Fields(c[1]) {
+			xy := strings.Split(pt, ",")
+			if len(xy) != 2 {
+				return box{}, false
+			}
+			x, y := num(xy[0]), num(xy[1])
+			b = box{math.Min(b.left, x), math.Min(b.top, y), math.Max(b.right, x), math.Max(b.bottom, y)}
+		}
+	case "path": // Only arrows, which are moved and turned into place, are markers
+		t, c := translateOnly.FindStringSubmatch(line), pathShape.FindStringSubmatch(line)
+		if t == nil || c == nil {
+			return box{}, false
+		}
+		reach := 0.0 // However it is turned, the shape stays within this distance of its origin
+		for _, ring := range parsePath(c[1]) {
+			for _, p := range ring {
+				reach = math.Max(reach, math.Hypot(p.x, p.y))
+			}
+		}
+		x, y := num(t[1]), num(t[2])
+		b = box{x - reach, y - reach, x + reach, y + reach}
+	}
+	return box{b.left - tileMargin, b.top - tileMargin, b.right + tileMargin, b.bottom + tileMargin}, true
+}
+
+// tileSVG splits an SVG map into a grid of cols by rows standalone tiles, returned row by
+// row. Every tile keeps the full drawing and views its own part of the canvas through the
+// viewBox, so the tiles line up exactly when put back together. Any size set on the map is
+// dropped, as it is the size of the whole map rather than of a tile. Markers that can't be
+// seen in a tile are left out of it, whatever type of map they are on, while markers
+// straddling a tile edge are kept in each tile they touch so that they are drawn whole
+// across the join.
+func tileSVG(doc string, cols, rows int) []string {
+	m := viewBoxAttr.FindStringSubmatch(doc)
+	if m == nil {
+		return []string{doc}
+	}
+	doc = stripSize(doc)
+	x0, _ := strconv.ParseFloat(m[1], 64)
+	y0, _ := strconv.ParseFloat(m[2], 64)
+	width, _ := strconv.ParseFloat(m[3], 64)
+	height, _ := strconv.ParseFloat(m[4], 64)
+	tileW, tileH := width/float64(cols), height/float64(rows)
+
+	lines := strings.Split(doc, "\n")
+	tiles := make([]string, 0, cols*rows)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			left, top := x0+float64(c)*tileW, y0+float64(r)*tileH
+
+			var sb strings.Builder
+			for _, line := range lines {
+				if b, ok := markerBox(line); ok &&
+					(b.right < left || b.left > left+tileW || b.bottom < top || b.top > top+tileH) {
+					continue
+				}
+				sb.WriteString(line)
+				sb.WriteByte('\n')
+			}
+
+			viewBox := fmt.Sprintf(`viewBox="%g %g %g %g"`, left, top, tileW, tileH)
+			tiles = append(tiles, viewBoxAttr.ReplaceAllLiteralString(strings.TrimSuffix(sb.String(), "\n"), viewBox))
+		}
+	}
+	return tiles
+}
+
+// parseTiles reads a tiling request such as "2x3" as a number of columns and rows
+func parseTiles(value string) (cols, rows int, ok bool) {
+	m := tilesValue.FindStringSubmatch(value)
+	if m == nil {
+		return 0, 0, false
+	}
+	cols, _ = strconv.Atoi(m[1])
+	rows, _ = strconv.Atoi(m[2])
+	if cols < 1 || rows < 1 || cols > maxTiles || rows > maxTiles {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
+
+// serveTiles responds with a zip archive of the map in memory split into tiles, each named
+// after the map with its row and column
+func (svm *svgMap) serveTiles(w http.ResponseWriter, value string) {
+	cols, rows, ok := parseTiles(value)
+	if !ok {
+		serveError(w, http.StatusBadRequest,
+			fmt.Sprintf("Tiles must be given as columns x rows, for example 2x2, with at most %d each way.", maxTiles))
+		return
+	}
+
+	base := strings.TrimSuffix(svm.mapName, ".svg")
+	w.Header().Set("Content-Type", "application/zip")
+	setAttachment(w, base+".tiles.zip")
+
+	zw := zip.NewWriter(w)
+	for i, tile := range tileSVG(svm.svgMap, cols, rows) {
+		f, err := zw.Create(fmt.Sprintf("%s.r%dc%d.svg", base, i/cols+1, i%cols+1))
+		if err != nil {
+			errorLog.Printf("Error writing map tile: %s", err)
+			return
+		}
+		fmt.Fprint(f, tile)
+	}
+	if err := zw.Close(); err != nil {
+		errorLog.Printf("Error writing map tiles: %s", err)
+	}
+}
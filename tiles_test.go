@@ -0,0 +1,95 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+var (
+	rootSize   = regexp.MustCompile(`<svg[^>]* (?:width|height)="`)
+	pointShape = regexp.MustCompile(`<circle cx=`)
+)
+
+// tileRecords is a spread of records over the whole state for tiling
+const tileRecords = "-40.9,144.7\n-41.0,148.2\n-42.0,146.7\n-43.2,146.0\n-42.9,147.9\n-41.46,146.81\n"
+
+func TestTilesShareOutThePoints(t *testing.T) {
+	for _, mapType := range []string{"plain", "web"} {
+		doc, err := renderMap("Aus bus", mapType, tileRecords)
+		if err != nil {
+			t.Fatal(err)
+		}
+		points := len(pointShape.FindAllString(doc, -1))
+		if points != 6 {
+			t.Fatalf("%s map has %d points, want one for each of the 6 records", mapType, points)
+		}
+
+		tiles := tileSVG(doc, 2, 2)
+		if len(tiles) != 4 {
+			t.Fatalf("%s map gave %d tiles, want 4", mapType, len(tiles))
+		}
+		inTiles := 0
+		for _, tile := range tiles {
+			inTiles += len(pointShape.FindAllString(tile, -1))
+		}
+		// Only points straddling a join can be in more than one tile, and none of the records
+		// are near one
+		if inTiles != points {
+			t.Errorf("%s map tiles hold %d points between them, want the %d on the map", mapType, inTiles, points)
+		}
+	}
+}
+
+func TestTilesDropMapSize(t *testing.T) {
+	doc, err := renderMap("Aus bus", "plain", tileRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tile := range tileSVG(setSize(doc, 1200, 0), 2, 2) {
+		if rootSize.MatchString(tile) {
+			t.Errorf("tile %d keeps the size of the whole map", i)
+		}
+	}
+}
+
+func TestMarkerBox(t *testing.T) {
+	tests := []struct {
+		line string
+		want box
+		ok   bool
+	}{
+		{`<circle cx="100" cy="200" r="5" style="fill:black"/>`, box{92, 192, 108, 208}, true},
+		{`<g class="point"><circle cx="100" cy="200" r="5" style="fill:black"><title>x</title></circle></g>`, box{92, 192, 108, 208}, true},
+		{`<rect x="10" y="20" width="6" height="6"/>`, box{7, 17, 19, 29}, true},
+		{`<polygon points="10,20 30,5 20,40"/>`, box{7, 2, 33, 43}, true},
+		{`<path d="M0 -16L8 10L0 4L-8 10Z" transform="translate(100 200) rotate(45)"/>`, box{81, 181, 119, 219}, true},
+		{`<path d="M1 2L3 4Z" style="fill:none"/>`, box{}, false},
+		{`<text x="10" y="20">Aus bus</text>`, box{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := markerBox(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("markerBox(%q) = %v, %v, want %v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTiles(t *testing.T) {
+	tests := []struct {
+		value      string
+		cols, rows int
+		ok         bool
+	}{
+		{"2x2", 2, 2, true},
+		{"1x3", 1, 3, true},
+		{"0x2", 0, 0, false},
+		{"2x", 0, 0, false},
+		{"99x1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		cols, rows, ok := parseTiles(tt.value)
+		if cols != tt.cols || rows != tt.rows || ok != tt.ok {
+			t.Errorf("parseTiles(%q) = %d, %d, %v", tt.value, cols, rows, ok)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// renderTimeout is how long drawing a map may take before it is given up, set by
+// -rendertimeout. 0 lets maps take as long as they need.
+var renderTimeout = 30 * time.Second
+
+// deadlineEvery is how many lines or records go by between checks of the deadline in the
+// loops that read every one of them
+const deadlineEvery = 1000
+
+// errTooComplex is returned when a map couldn't be drawn before the request's deadline
+var errTooComplex = errors.New("map too complex, try fewer points")
+
+// renderContext returns the context maps for a request are drawn under, which is
+// cancelled once renderTimeout has passed or the client has gone away
+func renderContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if renderTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), renderTimeout)
+}
+
+// checkDeadline returns errTooComplex if drawing under ctx should stop
+func checkDeadline(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errTooComplex
+	}
+	return nil
+}
+
+// renderStatus returns the status a request whose map failed with err is answered with
+func renderStatus(err error) int {
+	if errors.Is(err, errTooComplex) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
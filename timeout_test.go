@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLargeInputTimesOut(t *testing.T) {
+	defer func(d time.Duration) { renderTimeout = d }(renderTimeout)
+	renderTimeout = 100 * time.Millisecond
+	coords := spreadCoords(150000) // Too many records to map, but reading them takes longer than the deadline
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{"maptype": {"plain"}, "coordinates": {coords}})
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), errTooComplex.Error()) {
+		t.Errorf("large input gave %d, want 503 saying the map is too complex", rec.Code)
+	}
+
+	api := postJSON(apiMap, "/api/map", `{"coordinates":"`+strings.ReplaceAll(coords, "\n", `\n`)+`"}`)
+	if api.Code != http.StatusServiceUnavailable || !strings.Contains(api.Body.String(), `"error":"`+errTooComplex.Error()) {
+		t.Errorf("large API request gave %d", api.Code)
+	}
+}
+
+func TestParseStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := baseMapData("Aus bus", "plain", spreadCoords(5000), defaultZone)
+	if p := parseMapData(ctx, data); !errors.Is(p.err, errTooComplex) {
+		t.Errorf("parsing under a cancelled context gave %v", p.err)
+	}
+	if _, _, err := mapSVG(ctx, baseMapData("Aus bus", "plain", "-42.1,147.2", defaultZone)); !errors.Is(err, errTooComplex) {
+		t.Errorf("drawing under a cancelled context gave %v", err)
+	}
+	if _, err := validateLines(ctx, tasmania, spreadCoords(deadlineEvery), false, false, false); !errors.Is(err, errTooComplex) {
+		t.Errorf("checking lines under a cancelled context gave %v", err)
+	}
+
+	if renderStatus(errTooComplex) != http.StatusServiceUnavailable || renderStatus(errNoCoordinates) != http.StatusBadRequest {
+		t.Error("render errors given the wrong status")
+	}
+}
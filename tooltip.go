@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// tooltipStyle shows a point's label beside it while the pointer is over it, without any
+// script, for maps viewed in a browser
+const tooltipStyle = `.tip{display:none;font-size:18px;font-family:Arial;fill:#000000;stroke:#ffffff;stroke-width:4px;paint-order:stroke}` +
+	`.point:hover .tip{display:inline}.point:hover circle{fill:#e41a1c}`
+
+// pointLabel describes a record for its tooltip, giving its coordinates and whatever else
+// is known about it
+func pointLabel(rec record) string {
+	parts := []string{fmt.Sprintf("%.5f, %.5f", rec.lat, rec.lon)}
+	if rec.taxon != "" {
+		parts = append(parts, rec.taxon)
+	}
+	if rec.hasVoucher && rec.voucher {
+		parts = append(parts, "vouchered specimen")
+	} else if rec.hasVoucher {
+		parts = append(parts, "observation")
+	}
+	if rec.category != "" {
+		parts = append(parts, rec.category)
+	}
+	if rec.weight() > 1 {
+		parts = append(parts, fmt.Sprintf("%d records", rec.weight()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// webPoints replaces the mapper's points on a web map with points that show a tooltip with
+// the details of their record when hovered over, both as a title that browsers show and as
+// a label drawn beside the point. Points of records with a link to their online record
+// are made links to it. Points are drawn in the style m, and with scaleByCount they are
+// sized like countMarkers.
+func webPoints(reg *baseRegion, doc string, records []record, scaleByCount bool, m markerStyle) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<g id=\"points\">\n<style>%s</style>\n", tooltipStyle)
+	for _, rec := range records {
+		x, y := reg.project(rec.lat, rec.lon)
+		r := m.radius
+		if scaleByCount {
+			r = int(math.Round(float64(m.radius) * math.Sqrt(float64(rec.weight()))))
+		}
+
+		var label bytes.Buffer
+		xml.EscapeText(&label, []byte(pointLabel(rec)))
+		if rec.url != "" { // Clicking a point with a link opens its online record
+			link := html.EscapeString(rec.url)
+			fmt.Fprintf(&buf, `<a xlink:href="%s" href="%s" target="_blank">`, link, link)
+		}
+		fmt.Fprintf(&buf, `<g class="point"><circle cx="%d" cy="%d" r="%d" style="fill:%s"><title>%s</title></circle>`,
+			x, y, r, m.colour, label.String())
+		fmt.Fprintf(&buf, `<text class="tip" x="%d" y="%d">%s</text></g>`, x+r+4, y+6, label.String())
+		if rec.url != "" {
+			buf.WriteString("</a>")
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("</g>\n")
+	return appendToSVG(emptyGroup(doc, "dots"), buf.String())
+}
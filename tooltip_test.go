@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var pointTitle = regexp.MustCompile(`<g class="point"><circle [^>]*><title>([^<]*)</title></circle>`)
+
+// wellFormed reads doc through to the end as XML, returning the first syntax error
+func wellFormed(doc string) error {
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestWebPointsHaveTitles(t *testing.T) {
+	coords := "-42.0,146.5,1,Smith&Jones<1990>\n-41.5,147.0,0\n"
+	doc, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "web", coords, defaultZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := pointTitle.FindAllStringSubmatch(doc, -1)
+	want := []string{
+		"-42.00000, 146.50000, vouchered specimen, Smith&amp;Jones&lt;1990&gt;",
+		"-41.50000, 147.00000, observation",
+	}
+	if len(titles) != len(want) {
+		t.Fatalf("%d points with titles, want %d", len(titles), len(want))
+	}
+	for i := range want {
+		if titles[i][1] != want[i] {
+			t.Errorf("point %d titled %q, want %q", i, titles[i][1], want[i])
+		}
+	}
+	if !strings.Contains(doc, `<text class="tip"`) || !strings.Contains(doc, ".point:hover .tip") {
+		t.Error("web map has no hover labels")
+	}
+
+	if err := wellFormed(doc); err != nil {
+		t.Errorf("web map with tooltips isn't well-formed: %v", err)
+	}
+}
+
+func TestRecordLinks(t *testing.T) {
+	coords := "-42.0,146.5,1,https://example.org/specimen?id=1&set=\"x\"\n" +
+		"-41.5,147.0,1,javascript://alert(1)\n" +
+		"-41.2,146.0,1,HO,https://\n"
+	doc, records, err := mapSVG(context.Background(), baseMapData("Aus bus", "web", coords, defaultZone))
+	if err != nil || len(records) != 3 {
+		t.Fatalf("got %d records (%v)", len(records), err)
+	}
+	if records[0].url == "" || records[1].url != "" || records[2].url != "" || records[2].category != "HO" {
+		t.Errorf("got links %q, %q and %q", records[0].url, records[1].url, records[2].url)
+	}
+
+	if got := strings.Count(doc, "<a xlink:href="); got != 1 {
+		t.Errorf("%d points made links, want 1", got)
+	}
+	if !strings.Contains(doc, `<a xlink:href="https://example.org/specimen?id=1&amp;set=`) || strings.Contains(doc, `set="x"`) {
+		t.Error("the link isn't escaped")
+	}
+	if strings.Contains(doc, "javascript") {
+		t.Error("a link to a script was kept")
+	}
+	if err := wellFormed(doc); err != nil {
+		t.Errorf("web map with links isn't well-formed: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxUploadSize  = 5 << 20   // Maximum size in bytes of a reassembled coordinate file
+	uploadExpiry   = time.Hour // Time after its last chunk that an unfinished upload is discarded
+	maxOpenUploads = 100       // Largest number of unfinished uploads kept at once
+	maxUploadBytes = 64 << 20  // Largest number of bytes held for all unfinished uploads together
+)
+
+var (
+	errUploadGap      = errors.New("chunk offset is past the end of the data received so far")
+	errUploadOverlap  = errors.New("chunk offset overlaps data already received")
+	errUploadTooLarge = fmt.Errorf("upload exceeds the maximum size of %d bytes", maxUploadSize)
+	errUploadUnknown  = errors.New("no upload in progress with that id")
+	errUploadsFull    = errors.New("too many uploads are in progress")
+
+	uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// chunkedUpload holds the data received so far for a single resumable upload
+type chunkedUpload struct {
+	data    []byte
+	updated time.Time
+}
+
+// uploadStore keeps track of resumable uploads in progress, keyed by upload id. It holds at
+// most maxOpenUploads uploads and maxUploadBytes between them, so that uploads which are
+// started and never finished can't use up the server's memory.
+type uploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*chunkedUpload
+	held    int64 // Bytes received for all the uploads in progress
+}
+
+// newUploadStore creates an empty uploadStore
+func newUploadStore() *uploadStore {
+	return &uploadStore{uploads: make(map[string]*chunkedUpload)}
+}
+
+// appendChunk adds chunk to the upload with the given id at offset. Chunks must arrive in
+// order, so an offset that doesn't match the data received so far is rejected as a gap or
+// an overlap. It returns the size of the data received after adding the chunk. Once the
+// store is full, new uploads and chunks are refused with errUploadsFull until others finish
+// or expire.
+func (us *uploadStore) appendChunk(id string, offset int64, chunk []byte) (int64, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.expire()
+
+	up, ok := us.uploads[id]
+	if !ok {
+		if offset != 0 { // A new upload has to start at the beginning
+			return 0, errUploadGap
+		}
+		if len(us.uploads) >= maxOpenUploads {
+			return 0, errUploadsFull
+		}
+		up = new(chunkedUpload)
+		us.uploads[id] = up
+	}
+
+	size := int64(len(up.data))
+	switch {
+	case offset > size:
+		return size, errUploadGap
+	case offset < size:
+		return size, errUploadOverlap
+	case size+int64(len(chunk)) > maxUploadSize:
+		us.remove(id)
+		return 0, errUploadTooLarge
+	case us.held+int64(len(chunk)) > maxUploadBytes:
+		if size == 0 { // Nothing was kept for it, so it isn't left taking a place
+			us.remove(id)
+		}
+		return size, errUploadsFull
+	}
+
+	up.data = append(up.data, chunk...)
+	up.updated = time.Now()
+	us.held += int64(len(chunk))
+	return int64(len(up.data)), nil
+}
+
+// received returns the number of bytes received so far for an upload, so that a client
+// can find the offset to resume from
+func (us *uploadStore) received(id string) (int64, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	up, ok := us.uploads[id]
+	if !ok {
+		return 0, errUploadUnknown
+	}
+	return int64(len(up.data)), nil
+}
+
+// finish removes a finished upload from the store and returns its reassembled data
+func (us *uploadStore) finish(id string) ([]byte, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	up, ok := us.uploads[id]
+	if !ok {
+		return nil, errUploadUnknown
+	}
+	us.remove(id)
+	return up.data, nil
+}
+
+// remove drops an upload from the store, no longer counting the bytes held for it. The
+// caller must hold the lock.
+func (us *uploadStore) remove(id string) {
+	if up, ok := us.uploads[id]; ok {
+		us.held -= int64(len(up.data))
+		delete(us.uploads, id)
+	}
+}
+
+// expire discards uploads that haven't received a chunk for longer than uploadExpiry.
+// The caller must hold the lock.
+func (us *uploadStore) expire() {
+	for id, up := range us.uploads {
+		if time.Since(up.updated) > uploadExpiry {
+			us.remove(id)
+		}
+	}
+}
+
+// uploadChunk handles the resumable upload protocol on "/upload". Chunks are POSTed as
+// the raw request body with the upload id and byte offset as query parameters
+// (/upload?id=abc&offset=0). A GET with only the id returns the number of bytes received
+// so far, which is the offset a client should resume from after a dropped connection.
+// Clients that accept JSON are sent errors as JSON.
+func (us *uploadStore) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !uploadIDPattern.MatchString(id) {
+		writeError(w, r, http.StatusBadRequest, "Missing or invalid upload id.")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		size, err := us.received(id)
+		if err != nil {
+			writeError(w, r, http.StatusNotFound, "There is no upload in progress with that id.")
+			return
+		}
+		fmt.Fprint(w, size)
+	case "POST":
+		offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		if err != nil || offset < 0 {
+			writeError(w, r, http.StatusBadRequest, "Missing or invalid chunk offset.")
+			return
+		}
+
+		chunk, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+		if err != nil {
+			writeError(w, r, http.StatusRequestEntityTooLarge, "")
+			return
+		}
+
+		size, err := us.appendChunk(id, offset, chunk)
+		switch err {
+		case nil:
+			fmt.Fprint(w, size)
+		case errUploadTooLarge:
+			errorLog.Printf("Upload %s discarded: %s", id, err)
+			writeError(w, r, http.StatusRequestEntityTooLarge, "")
+		case errUploadsFull:
+			errorLog.Printf("Upload %s refused: %s", id, err)
+			w.Header().Set("Retry-After", "60")
+			writeError(w, r, http.StatusServiceUnavailable, "The server is busy with other uploads. Please try again later.")
+		default: // Gaps and overlaps report the offset the client should resume from
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("The %s. Please resume from offset %d.", err, size))
+		}
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Chunks must be sent with POST.")
+	}
+}
+
+// uploadComplete handles "/upload/complete?id=abc", which parses the reassembled upload as
+// coordinate data and renders the map using the taxon and maptype form values. Any
+// coordinates in the form are mapped along with the upload.
+func (us *uploadStore) uploadComplete(ms *mapStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+
+		coords, err := us.finish(r.URL.Query().Get("id"))
+		if err != nil {
+			serveError(w, http.StatusNotFound, "There is no upload in progress with that id.")
+			return
+		}
+
+		// Anything typed into the form as well is merged with the upload, keeping track of
+		// where each record came from
+		data := newMapData(r)
+		data.mergeSources(dataSource{"uploaded", data.readCoords(string(coords))}, dataSource{"typed", data.RawCoords})
+		ms.showMap(w, r, data)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAppendChunkReassembles(t *testing.T) {
+	us := newUploadStore()
+	chunks := []string{"-42.1,147.1\n", "-41.5,", "146.5\n"}
+	offset := int64(0)
+	for _, c := range chunks {
+		size, err := us.appendChunk("a", offset, []byte(c))
+		if err != nil {
+			t.Fatalf("chunk at %d: %v", offset, err)
+		}
+		offset = size
+	}
+	if got, _ := us.received("a"); got != offset {
+		t.Errorf("received %d bytes, want %d", got, offset)
+	}
+	data, err := us.finish("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(chunks, ""); string(data) != want {
+		t.Errorf("reassembled %q, want %q", data, want)
+	}
+	if _, err := us.finish("a"); err != errUploadUnknown {
+		t.Errorf("finishing twice gave %v, want errUploadUnknown", err)
+	}
+}
+
+func TestAppendChunkGapsAndOverlaps(t *testing.T) {
+	us := newUploadStore()
+	if _, err := us.appendChunk("a", 5, []byte("late")); err != errUploadGap {
+		t.Errorf("new upload not at 0 gave %v, want errUploadGap", err)
+	}
+	us.appendChunk("a", 0, []byte("01234"))
+
+	tests := []struct {
+		offset int64
+		err    error
+	}{
+		{9, errUploadGap},     // A chunk sent out of order, before the one it follows
+		{3, errUploadOverlap}, // A chunk sent again after a dropped response
+		{0, errUploadOverlap},
+	}
+	for _, tt := range tests {
+		size, err := us.appendChunk("a", tt.offset, []byte("xyz"))
+		if err != tt.err {
+			t.Errorf("offset %d gave %v, want %v", tt.offset, err, tt.err)
+		}
+		if size != 5 {
+			t.Errorf("offset %d reported %d bytes to resume from, want 5", tt.offset, size)
+		}
+	}
+
+	// Out of order chunks are resent from the offset reported, and the data comes out whole
+	if _, err := us.appendChunk("a", 5, []byte("56789")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := us.finish("a"); string(data) != "0123456789" {
+		t.Errorf("reassembled %q, want 0123456789", data)
+	}
+}
+
+func TestAppendChunkTooLarge(t *testing.T) {
+	us := newUploadStore()
+	us.appendChunk("a", 0, make([]byte, maxUploadSize-1))
+	if _, err := us.appendChunk("a", maxUploadSize-1, []byte("xy")); err != errUploadTooLarge {
+		t.Errorf("got %v, want errUploadTooLarge", err)
+	}
+	if _, err := us.received("a"); err != errUploadUnknown {
+		t.Error("an upload over the limit was kept")
+	}
+	if us.held != 0 {
+		t.Errorf("%d bytes still counted after the upload was discarded", us.held)
+	}
+}
+
+func TestUploadStoreLimits(t *testing.T) {
+	us := newUploadStore()
+	for i := 0; i < maxOpenUploads; i++ {
+		if _, err := us.appendChunk(fmt.Sprint(i), 0, []byte("x")); err != nil {
+			t.Fatalf("upload %d refused: %v", i, err)
+		}
+	}
+	if _, err := us.appendChunk("one-too-many", 0, []byte("x")); err != errUploadsFull {
+		t.Errorf("upload past maxOpenUploads gave %v, want errUploadsFull", err)
+	}
+	us.finish("0")
+	if _, err := us.appendChunk("one-too-many", 0, []byte("x")); err != nil {
+		t.Errorf("upload after another finished refused: %v", err)
+	}
+
+	us = newUploadStore()
+	chunk := make([]byte, maxUploadSize)
+	n := 0
+	for ; int64(n+1)*maxUploadSize <= maxUploadBytes; n++ {
+		if _, err := us.appendChunk(fmt.Sprint(n), 0, chunk); err != nil {
+			t.Fatalf("upload %d refused: %v", n, err)
+		}
+	}
+	if _, err := us.appendChunk(fmt.Sprint(n), 0, chunk); err != errUploadsFull {
+		t.Errorf("upload past maxUploadBytes gave %v, want errUploadsFull", err)
+	}
+	if len(us.uploads) != n {
+		t.Errorf("%d uploads kept, want %d without the refused one", len(us.uploads), n)
+	}
+}
+
+func TestUploadHandlers(t *testing.T) {
+	us := newUploadStore()
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		us.uploadChunk(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := send("POST", "/upload?id=up1&offset=0", "-42.1,147.1\n"); rec.Code != http.StatusOK || rec.Body.String() != "12" {
+		t.Fatalf("first chunk gave %d %q", rec.Code, rec.Body)
+	}
+	if rec := send("POST", "/upload?id=up1&offset=20", "x"); rec.Code != http.StatusConflict ||
+		!strings.Contains(rec.Body.String(), "resume from offset 12") {
+		t.Errorf("gap gave %d %q", rec.Code, rec.Body)
+	}
+	if rec := send("GET", "/upload?id=up1", ""); rec.Body.String() != "12" {
+		t.Errorf("resume offset %q, want 12", rec.Body)
+	}
+	send("POST", "/upload?id=up1&offset=12", "-41.5,146.5")
+	if rec := send("POST", "/upload?id=bad/id&offset=0", "x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id gave %d, want 400", rec.Code)
+	}
+
+	rec := postForm(us.uploadComplete(newMapStore()), "/upload/complete?id=up1",
+		url.Values{"maptype": {"plain"}, "taxon": {"Aus bus"}})
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte("<svg")) {
+		t.Fatalf("completing the upload gave %d without a map", rec.Code)
+	}
+	if n := strings.Count(rec.Body.String(), "<circle"); n < 2 {
+		t.Errorf("map of the upload has %d circles, want both records", n)
+	}
+	rec = postForm(us.uploadComplete(newMapStore()), "/upload/complete?id=up1", url.Values{"maptype": {"plain"}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("completing twice gave %d, want 404", rec.Code)
+	}
+}
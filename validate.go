@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const maxLineProblems = 20 // Largest number of problem lines listed individually to the user
+
+// isComment reports whether a line of input is blank or a comment starting with "#", to
+// be skipped rather than read as a record
+func isComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// stripComments removes blank lines and comments from coordinate data, so that the first
+// line is the first record
+func stripComments(coords string) string {
+	return mapLines(coords, func(line string) (string, bool) {
+		return line, !isComment(line)
+	})
+}
+
+// fillVouchers prepares records for a map with voucher status. Records without a voucher
+// status are taken to be observations, and records with anything else in its place are
+// left out.
+func fillVouchers(records []record) []record {
+	kept := records[:0]
+	for _, rec := range records {
+		if !rec.hasVoucher {
+			if rec.hasBearing { // A number other than 0 or 1 where the voucher status goes
+				continue
+			}
+			rec.hasVoucher, rec.voucher = true, false
+		}
+		kept = append(kept, rec)
+	}
+	return kept
+}
+
+// insideMap reports whether a record falls within the area covered by maps of the region
+func insideMap(reg *baseRegion, rec record) bool {
+	return reg.contains(rec.lat, rec.lon)
+}
+
+// validateLines checks every line of the coordinate data, not just the first, and
+// describes each line that won't appear on the map, or that is outside the area covered
+// by the map but plotted anyway. Blank lines and comments are ignored. When the first
+// record has a voucher status every line is expected to have a valid one. On maps that
+// use voucher status, lines without one are then mapped as observations, and when the
+// first record has none the mapper leaves out lines that have one. Checking gives up with
+// errTooComplex once ctx is done.
+func validateLines(ctx context.Context, reg *baseRegion, coords string, vouchered, voucherMap, plotOutside bool) (problems []string, err error) {
+	lines := newTextLines(coords)
+	n, extra := 0, 0
+	for lines.Scan() {
+		if n++; n%deadlineEvery == 0 {
+			if err := checkDeadline(ctx); err != nil {
+				return nil, err
+			}
+		}
+		line := strings.TrimSpace(lines.Text())
+		if isComment(line) {
+			continue
+		}
+
+		var problem string
+		rec, ok := parseFields(line)
+		fields, _, _, _ := splitExtras(line) // The voucher status comes before any category or link
+		switch {
+		case !ok:
+			problem = "could not be parsed"
+		case impossibleCoords(rec) != "":
+			problem = impossibleCoords(rec) + ", which is impossible, so it was left off the map"
+		case vouchered && rec.hasBearing && !rec.hasVoucher:
+			problem = fmt.Sprintf("has a voucher flag of `%s`, which must be 0 or 1, so it was left off the map", fields[strings.LastIndex(fields, ",")+1:])
+		case voucherMap && vouchered && !rec.hasVoucher:
+			problem = "has no voucher status, unlike the first record, so it was mapped as an observation"
+		case voucherMap && !vouchered && (strings.HasSuffix(fields, ",a") || strings.HasSuffix(fields, ",v")):
+			problem = "has a voucher status, unlike the first record, and was left off the map"
+		case !insideMap(reg, rec) && plotOutside:
+			problem = "is outside the area covered by the map, and was plotted anyway"
+		case !insideMap(reg, rec):
+			problem = "is outside the area covered by the map, and was left off it"
+		default:
+			continue
+		}
+
+		if len(problems) < maxLineProblems {
+			problems = append(problems, fmt.Sprintf("line %d: `%s` %s", n, line, problem))
+		} else {
+			extra++
+		}
+	}
+	if extra > 0 {
+		problems = append(problems, fmt.Sprintf("%d more line(s) could not be mapped", extra))
+	}
+	return problems, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateLinesMixedInput(t *testing.T) {
+	coords := "-42.1,147.2\n# a comment\n-4x.1,147\n-41.5,146.5\n\ngarbage\n\n\n"
+	problems, _ := validateLines(context.Background(), tasmania, coords, false, false, false)
+	want := []string{
+		"line 3: `-4x.1,147` could not be parsed",
+		"line 6: `garbage` could not be parsed",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateLinesMixedVouchers(t *testing.T) {
+	tests := []struct {
+		name       string
+		coords     string
+		vouchered  bool
+		voucherMap bool
+		want       string
+	}{
+		{"missing voucher", "-42.1,147.2,1\n-41.5,146.5", true, true,
+			"line 2: `-41.5,146.5` has no voucher status, unlike the first record, so it was mapped as an observation"},
+		{"bad voucher flag", "-42.1,147.2,1\n-41.5,146.5,7", true, true,
+			"line 2: `-41.5,146.5,7` has a voucher flag of `7`, which must be 0 or 1, so it was left off the map"},
+		{"unexpected voucher", "-42.1,147.2\n-41.5,146.5,v", false, true,
+			"line 2: `-41.5,146.5,v` has a voucher status, unlike the first record, and was left off the map"},
+		{"vouchers ignored", "-42.1,147.2\n-41.5,146.5,v", false, false, ""},
+		{"outside the map", "-42.1,147.2\n-30.0,140.0", false, false,
+			"line 2: `-30.0,140.0` is outside the area covered by the map, and was left off it"},
+	}
+	for _, tt := range tests {
+		problems, _ := validateLines(context.Background(), tasmania, tt.coords, tt.vouchered, tt.voucherMap, false)
+		if got := strings.Join(problems, "\n"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateLinesLimit(t *testing.T) {
+	coords := "-42.1,147.2\n" + strings.Repeat("bad\n", maxLineProblems+5)
+	problems, _ := validateLines(context.Background(), tasmania, coords, false, false, false)
+	if len(problems) != maxLineProblems+1 || problems[maxLineProblems] != "5 more line(s) could not be mapped" {
+		t.Errorf("got %d problems ending %q", len(problems), problems[len(problems)-1])
+	}
+}
+
+func TestLineProblemsShownToUser(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"plain"}, "coordinates": {"-42.1,147.2\n-4x.1,147\n"},
+	})
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "line 2: `-4x.1,147` could not be parsed") {
+		t.Errorf("results page gave %d without the problem line", rec.Code)
+	}
+}
+
+func TestInsideMapEdges(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     bool
+	}{
+		{-39.21, 146.0, true}, {-39.19, 146.0, false}, // North
+		{-43.89, 146.0, true}, {-43.91, 146.0, false}, // South
+		{-42.0, 143.51, true}, {-42.0, 143.49, false}, // West
+		{-42.0, 148.89, true}, {-42.0, 148.91, false}, // East
+		{-4.12, 147.2, false}, // A digit missing
+	}
+	for _, tt := range tests {
+		if got := insideMap(tasmania, record{lat: tt.lat, lon: tt.lon}); got != tt.want {
+			t.Errorf("insideMap(tasmania, %g, %g) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestOutsidePointsPlottedOnlyWhenAsked(t *testing.T) {
+	coords := "-42.0,146.5\n-39.19,146.0\n"
+	for _, plot := range []bool{false, true} {
+		values := url.Values{"maptype": {"plain"}, "coordinates": {coords}}
+		if plot {
+			values.Set("plotoutside", "1")
+		}
+		page := postForm(newMapStore().mapDisplay, "/map", values).Body.String()
+		if !strings.Contains(page, "line 2: `-39.19,146.0` is outside the area covered by the map") {
+			t.Errorf("plotting outside %v: point past the north edge not reported", plot)
+		}
+
+		data := baseMapData("", "plain", coords, defaultZone)
+		data.PlotOutside, data.PlotSea = plot, true // The point is also at sea
+		_, records, err := mapSVG(context.Background(), data)
+		if err != nil || (len(records) == 2) != plot {
+			t.Errorf("plotting outside %v: %d records drawn (%v)", plot, len(records), err)
+		}
+	}
+}
+
+func TestCommentsAndBlankLines(t *testing.T) {
+	tests := []struct {
+		name, coords string
+		vouchered    bool
+	}{
+		{"leading comments", "# collected 2019\n\n# HO sheets\n-42.1,147.2,1\n-41.5,146.5,0", true},
+		{"interleaved comments", "-42.1,147.2\n# a note\n\n-41.5,146.5\n  # indented note", false},
+	}
+	for _, tt := range tests {
+		if first := firstLine(tt.coords); strings.HasPrefix(first, "#") || first == "" {
+			t.Errorf("%s: first record taken to be %q", tt.name, first)
+		}
+		data := baseMapData("Aus bus", "grid", tt.coords, defaultZone)
+		_, records, err := mapSVG(context.Background(), data)
+		if err != nil || len(records) != 2 || records[0].hasVoucher != tt.vouchered {
+			t.Errorf("%s: got %d records (%v)", tt.name, len(records), err)
+		}
+		if total := summariseRecords(records, defaultDedupePlaces).Total; total != 2 {
+			t.Errorf("%s: %d records counted", tt.name, total)
+		}
+	}
+
+	_, _, err := mapSVG(context.Background(), baseMapData("Aus bus", "grid", "# nothing yet\n\n# still nothing", defaultZone))
+	if err == nil || !strings.Contains(err.Error(), "No coordinates were found") {
+		t.Errorf("input of only comments gave %v", err)
+	}
+}
+
+func TestVoucherFlagChecked(t *testing.T) {
+	rec := postForm(newMapStore().mapDisplay, "/map", url.Values{
+		"maptype": {"grid"}, "coordinates": {"-42.1,147.4,1\n-42.1,147.4,2\n-41.5,146.5"},
+	})
+	page := rec.Body.String()
+	for _, want := range []string{
+		"line 2: `-42.1,147.4,2` has a voucher flag of `2`, which must be 0 or 1, so it was left off the map",
+		"line 3: `-41.5,146.5` has no voucher status, unlike the first record, so it was mapped as an observation",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("results page has no %q", want)
+		}
+	}
+
+	// Lines without a flag are mapped as observations, and lines with a bad one left off
+	_, records, err := mapSVG(context.Background(), baseMapData("", "grid", "-42.1,147.4,1\n-42.1,147.4,2\n-41.5,146.5", defaultZone))
+	if err != nil || len(records) != 2 || !records[0].voucher || records[1].voucher || !records[1].hasVoucher {
+		t.Errorf("got records %+v (%v)", records, err)
+	}
+}
+
+func TestImpossibleCoordsRefused(t *testing.T) {
+	tests := []struct {
+		line, problem string
+	}{
+		{"-99.5,999.9", "has a latitude of -99.5, beyond 90°"},
+		{"-42.1,247.2", "has a longitude of 247.2, beyond 180°"},
+		{"-91,147.2,1", "has a latitude of -91, beyond 90°"},
+		{"-42.1,180.5", "has a longitude of 180.5, beyond 180°"},
+	}
+	for _, tt := range tests {
+		rec, ok := parseFields(tt.line)
+		if !ok {
+			t.Errorf("%s doesn't match the line patterns", tt.line)
+			continue
+		}
+		if got := impossibleCoords(rec); got != tt.problem {
+			t.Errorf("impossibleCoords(%s) = %q, want %q", tt.line, got, tt.problem)
+		}
+		if _, ok := parseLine(tt.line); ok {
+			t.Errorf("parseLine accepted %s", tt.line)
+		}
+	}
+	for _, line := range []string{"-90,180", "-90.0,100.5", "-42.1,147.2"} {
+		if _, ok := parseLine(line); !ok {
+			t.Errorf("parseLine refused %s", line)
+		}
+	}
+
+	coords := "-42.1,147.2\n-99.5,999.9\n-41.5,146.5"
+	problems, _ := validateLines(context.Background(), tasmania, coords, false, false, true)
+	if want := "line 2: `-99.5,999.9` has a latitude of -99.5, beyond 90°, which is impossible, so it was left off the map"; strings.Join(problems, "\n") != want {
+		t.Errorf("got problems %q, want %q", problems, want)
+	}
+	if got := dropImpossible(coords); got != "-42.1,147.2\n-41.5,146.5" {
+		t.Errorf("dropImpossible left %q", got)
+	}
+
+	data := baseMapData("", "plain", coords, defaultZone)
+	data.PlotOutside, data.PlotSea = true, true // Even records off the map are plotted if they can exist
+	if _, records, err := mapSVG(context.Background(), data); err != nil || len(records) != 2 {
+		t.Errorf("got %d records (%v), want 2", len(records), err)
+	}
+}
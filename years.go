@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Years that collection dates can fall in, for telling them apart from other numbers
+const minYear, maxYear = 1600, 2100
+
+// dateField matches a collection year or date given as an extra field of a record: a year
+// on its own, an ISO date such as 1998-03-12 or 1998-03, or a day first date such as
+// 12/03/1998
+var dateField = regexp.MustCompile(`^(?:(\d{4})(?:-\d{1,2}(?:-\d{1,2})?)?|\d{1,2}/\d{1,2}/(\d{4}))$`)
+
+// fieldYear returns the year of a field holding a collection date, if it is one
+func fieldYear(field string) (int, bool) {
+	m := dateField.FindStringSubmatch(field)
+	if m == nil {
+		return 0, false
+	}
+	year, _ := strconv.Atoi(m[1] + m[2]) // Only one of them is ever set
+	return year, year >= minYear && year <= maxYear
+}
+
+// parseYear reads a year bounding the records mapped, giving 0 for no bound
+func parseYear(value string) int {
+	year, err := strconv.Atoi(value)
+	if err != nil || year < minYear || year > maxYear {
+		return 0
+	}
+	return year
+}
+
+// filterByYear keeps the records collected from the year from to the year to, either of
+// which can be 0 to leave that end open. Records without a date are kept only if undated
+// is set. It returns a warning about the records left out, if any were.
+func filterByYear(records []record, from, to int, undated bool) (kept []record, warning string) {
+	if from == 0 && to == 0 {
+		return records, ""
+	}
+	if from > to && to != 0 { // The years were given the wrong way round
+		from, to = to, from
+	}
+
+	outside, noDate := 0, 0
+	for _, rec := range records {
+		switch {
+		case rec.year == 0 && !undated:
+			noDate += rec.weight()
+		case rec.year == 0:
+			kept = append(kept, rec)
+		case (from != 0 && rec.year < from) || (to != 0 && rec.year > to):
+			outside += rec.weight()
+		default:
+			kept = append(kept, rec)
+		}
+	}
+
+	var left []string
+	if outside > 0 {
+		left = append(left, fmt.Sprintf("%d record(s) not from %s", outside, yearRange(from, to)))
+	}
+	if noDate > 0 {
+		left = append(left, fmt.Sprintf("%d record(s) without a date", noDate))
+	}
+	if len(left) > 0 {
+		warning = strings.Join(left, " and ") + " were left off the map"
+	}
+	return kept, warning
+}
+
+// yearRange describes a range of years, either end of which can be open
+func yearRange(from, to int) string {
+	switch {
+	case from == 0:
+		return fmt.Sprintf("%d or earlier", to)
+	case to == 0:
+		return fmt.Sprintf("%d or later", from)
+	}
+	return fmt.Sprintf("%d to %d", from, to)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFilterByYear(t *testing.T) {
+	records := []record{
+		{lat: -42.1, lon: 147.2, year: 1890},
+		{lat: -42.2, lon: 147.1, year: 1950},
+		{lat: -42.3, lon: 147.0, year: 2010},
+		{lat: -42.4, lon: 146.9},
+	}
+	tests := []struct {
+		name     string
+		from, to int
+		undated  bool
+		want     []int // Years of the records kept
+		warning  string
+	}{
+		{"no range", 0, 0, false, []int{1890, 1950, 2010, 0}, ""},
+		{"in range", 1900, 2000, false, []int{1950},
+			"2 record(s) not from 1900 to 2000 and 1 record(s) without a date were left off the map"},
+		{"undated kept", 1900, 2000, true, []int{1950, 0}, "2 record(s) not from 1900 to 2000 were left off the map"},
+		{"inclusive ends", 1950, 2010, true, []int{1950, 2010, 0}, "1 record(s) not from 1950 to 2010 were left off the map"},
+		{"open start", 0, 1950, true, []int{1890, 1950, 0}, "1 record(s) not from 1950 or earlier were left off the map"},
+		{"open end", 1950, 0, true, []int{1950, 2010, 0}, "1 record(s) not from 1950 or later were left off the map"},
+		{"reversed", 2000, 1900, true, []int{1950, 0}, "2 record(s) not from 1900 to 2000 were left off the map"},
+		{"none in range", 1600, 1700, false, nil,
+			"3 record(s) not from 1600 to 1700 and 1 record(s) without a date were left off the map"},
+	}
+	for _, tt := range tests {
+		kept, warning := filterByYear(records, tt.from, tt.to, tt.undated)
+		var years []int
+		for _, rec := range kept {
+			years = append(years, rec.year)
+		}
+		if !equalInts(years, tt.want) || warning != tt.warning {
+			t.Errorf("%s: kept %v with %q, want %v with %q", tt.name, years, warning, tt.want, tt.warning)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFieldYear(t *testing.T) {
+	tests := []struct {
+		field string
+		year  int
+		ok    bool
+	}{
+		{"1998", 1998, true},
+		{"1998-03-12", 1998, true},
+		{"1998-03", 1998, true},
+		{"12/03/1998", 1998, true},
+		{"1599", 1599, false},
+		{"v", 0, false},
+		{"19980312", 0, false},
+	}
+	for _, tt := range tests {
+		if year, ok := fieldYear(tt.field); ok != tt.ok || (ok && year != tt.year) {
+			t.Errorf("fieldYear(%q) = %d, %v, want %d, %v", tt.field, year, ok, tt.year, tt.ok)
+		}
+	}
+	for value, want := range map[string]int{"1950": 1950, "": 0, "50": 0, "3000": 0} {
+		if got := parseYear(value); got != want {
+			t.Errorf("parseYear(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestYearRangeMapped(t *testing.T) {
+	data := baseMapData("Aus bus", "plain", "-42.1,147.2,,1890\n-41.5,146.5,,1998-03-12\n-41.8,145.9", defaultZone)
+	data.YearFrom, data.YearTo = 1950, 2020
+	_, records, err := mapSVG(context.Background(), data)
+	if err != nil || len(records) != 1 || records[0].year != 1998 {
+		t.Errorf("got records %+v (%v)", records, err)
+	}
+	if want := "1 record(s) not from 1950 to 2020 and 1 record(s) without a date were left off the map"; !strings.Contains(strings.Join(data.Warnings, "\n"), want) {
+		t.Errorf("got warnings %q", data.Warnings)
+	}
+}